@@ -0,0 +1,356 @@
+// Package api serves the multimedia items over a JSON REST API
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/metadata"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+	"github.com/alejo-lapix/multimedia-go/service"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	// DefaultFileKey is the multipart field of the uploaded file
+	DefaultFileKey = "file"
+	// DefaultMaxMBInMemory is the part of the multipart body kept in memory, the rest is stored in temporary files
+	DefaultMaxMBInMemory = 32
+)
+
+// Handler serves the items of the repository relative to the path it is mounted on, e.g. with
+// http.StripPrefix("/items", handler):
+//
+//	POST   /items            uploads the multipart file field, 201 or 200 with the item of a duplicate
+//	GET    /items            lists the items, see ListOptions for the query parameters
+//	GET    /items?ids=a,b    returns the existing items with the given IDs
+//	GET    /items/{id}       returns an item
+//	DELETE /items/{id}       removes an item and its files
+type Handler struct {
+	Uploader   service.Uploader
+	Repository persistence.BasicRepository
+	// FileKey is the multipart field of the uploaded file, DefaultFileKey when empty
+	FileKey string
+	// MaxMBInMemory is passed to ParseMultipartForm, DefaultMaxMBInMemory when zero
+	MaxMBInMemory int64
+	// MaxRequestSize is the maximum amount of bytes of the upload requests, service.DefaultMaxRequestSize of
+	// MaxSizes when zero and there is no limit when negative
+	MaxRequestSize int64
+	// MaxSizes overrides service.DefaultMaxSizes per persistence type
+	MaxSizes map[string]int64
+	// Keys names the uploaded files, service.DefaultKeyStrategy when nil
+	Keys service.KeyStrategy
+	// Logger receives the errors answered with 500, they are not logged when nil
+	Logger *log.Logger
+}
+
+// ErrorBody is the JSON body of the failed requests, {"error": {"code": "not_found", "message": "..."}}
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// NewHandler returns a Handler with the default multipart settings
+func NewHandler(uploader service.Uploader, repository persistence.BasicRepository) *Handler {
+	return &Handler{Uploader: uploader, Repository: repository}
+}
+
+func (handler *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	ID := strings.Trim(request.URL.Path, "/")
+
+	switch {
+	case strings.Contains(ID, "/"):
+		handler.writeError(writer, service.NotFoundError{Message: fmt.Sprintf("The path %v does not exists", request.URL.Path)})
+	case ID == "" && request.Method == http.MethodPost:
+		handler.upload(writer, request)
+	case ID == "" && request.Method == http.MethodGet && request.URL.Query().Get("ids") != "":
+		handler.findMany(writer, request)
+	case ID == "" && request.Method == http.MethodGet:
+		handler.list(writer, request)
+	case ID != "" && request.Method == http.MethodGet:
+		handler.find(writer, ID)
+	case ID != "" && request.Method == http.MethodDelete:
+		handler.delete(writer, ID)
+	default:
+		allowed := "GET, POST"
+
+		if ID != "" {
+			allowed = "GET, DELETE"
+		}
+
+		writer.Header().Set("Allow", allowed)
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: ErrorBody{
+			Code:    "method_not_allowed",
+			Message: fmt.Sprintf("The method %v is not allowed, use %v", request.Method, allowed),
+		}})
+	}
+}
+
+// upload validates the multipart form before moving the file so the malformed requests are answered with 400
+func (handler *Handler) upload(writer http.ResponseWriter, request *http.Request) {
+	key := handler.fileKey()
+	uploader := &service.HttpFileUploader{
+		Uploader:       handler.Uploader,
+		MaxMBUploaded:  handler.maxMBInMemory(),
+		MaxRequestSize: handler.maxRequestSize(),
+		MaxSizes:       handler.MaxSizes,
+		Keys:           handler.Keys,
+	}
+
+	if err := uploader.ParseForm(request); err != nil {
+		if _, ok := err.(service.TooLargeError); !ok {
+			err = service.InvalidArgumentError{Message: fmt.Sprintf("The body is not a valid multipart form: %v", err)}
+		}
+
+		handler.writeError(writer, err)
+		return
+	}
+
+	file, _, err := request.FormFile(key)
+
+	if err != nil {
+		handler.writeError(writer, service.InvalidArgumentError{Message: fmt.Sprintf("The multipart field %v is required", key)})
+		return
+	}
+
+	_ = file.Close()
+
+	item, duplicate, err := uploader.MoveFileDeduplicated(request, &key)
+
+	if err != nil {
+		handler.writeError(writer, err)
+		return
+	}
+
+	// the item stored before with the same content is not created by the request
+	if duplicate {
+		writeJSON(writer, http.StatusOK, item)
+		return
+	}
+
+	writeJSON(writer, http.StatusCreated, item)
+}
+
+func (handler *Handler) find(writer http.ResponseWriter, ID string) {
+	item, err := handler.Repository.Find(&ID)
+
+	if err == nil && item == nil {
+		err = persistence.NotFoundError{ID: ID}
+	}
+
+	if err != nil {
+		handler.writeError(writer, err)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, item)
+}
+
+// findMany answers a page without cursor, the missing IDs are ignored
+func (handler *Handler) findMany(writer http.ResponseWriter, request *http.Request) {
+	var ids []*string
+
+	for _, value := range strings.Split(request.URL.Query().Get("ids"), ",") {
+		if ID := strings.TrimSpace(value); ID != "" {
+			ids = append(ids, &ID)
+		}
+	}
+
+	if len(ids) > persistence.MaxPageSize {
+		handler.writeError(writer, service.InvalidArgumentError{Message: fmt.Sprintf("At most %v ids can be requested", persistence.MaxPageSize)})
+		return
+	}
+
+	items, err := handler.Repository.FindMany(ids)
+
+	if err != nil {
+		handler.writeError(writer, err)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, newPage(items, ""))
+}
+
+func (handler *Handler) list(writer http.ResponseWriter, request *http.Request) {
+	repository, ok := handler.Repository.(persistence.Listable)
+
+	if !ok {
+		writeJSON(writer, http.StatusNotImplemented, errorResponse{Error: ErrorBody{
+			Code:    "not_implemented",
+			Message: "The repository can not list items",
+		}})
+		return
+	}
+
+	options, err := ListOptions(request)
+
+	if err != nil {
+		handler.writeError(writer, err)
+		return
+	}
+
+	page, err := repository.List(*options)
+
+	if err != nil {
+		handler.writeError(writer, err)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, newPage(page.Items, page.Cursor))
+}
+
+func (handler *Handler) delete(writer http.ResponseWriter, ID string) {
+	if err := handler.Uploader.Delete(&ID); err != nil {
+		handler.writeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// ListOptions reads the type, createdAfter, createdBefore (RFC 3339), order (asc or desc), limit and cursor
+// query parameters, the invalid values return an InvalidArgumentError
+func ListOptions(request *http.Request) (*persistence.ListOptions, error) {
+	query := request.URL.Query()
+	options := &persistence.ListOptions{Type: query.Get("type"), Cursor: query.Get("cursor")}
+
+	if options.Type != "" && !isItemType(options.Type) {
+		return nil, service.InvalidArgumentError{Message: fmt.Sprintf("The type %v is not valid", options.Type)}
+	}
+
+	for name, value := range map[string]*time.Time{"createdAfter": &options.CreatedAfter, "createdBefore": &options.CreatedBefore} {
+		if query.Get(name) == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, query.Get(name))
+
+		if err != nil {
+			return nil, service.InvalidArgumentError{Message: fmt.Sprintf("The %v parameter must be a RFC 3339 date", name)}
+		}
+
+		*value = parsed
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		options.Descending = true
+	default:
+		return nil, service.InvalidArgumentError{Message: "The order parameter must be asc or desc"}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+
+		if err != nil || parsed < 1 {
+			return nil, service.InvalidArgumentError{Message: "The limit parameter must be a positive number"}
+		}
+
+		options.Limit = parsed
+	}
+
+	return options, nil
+}
+
+func isItemType(fileType string) bool {
+	for _, itemType := range persistence.ItemTypes {
+		if itemType == fileType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newPage never has nil items so they are encoded as an empty array
+func newPage(items []*persistence.MultimediaItem, cursor string) *persistence.Page {
+	if items == nil {
+		items = []*persistence.MultimediaItem{}
+	}
+
+	return &persistence.Page{Items: items, Cursor: cursor}
+}
+
+// StatusCode returns the HTTP status and the error code of an error, the unknown errors are 500. The
+// service.RollbackError has the status of the error that caused the rollback
+func StatusCode(err error) (int, string) {
+	switch typed := err.(type) {
+	case service.RollbackError:
+		return StatusCode(typed.Err)
+	case service.InvalidArgumentError, persistence.InvalidCursorError:
+		return http.StatusBadRequest, "invalid_argument"
+	case service.NotFoundError, persistence.NotFoundError:
+		return http.StatusNotFound, "not_found"
+	case validator.ValidationErrors, service.InvalidDocumentError, service.UnsupportedFileTypeError, service.VerificationError,
+		metadata.InvalidFormatError, metadata.UnstrippableFormatError:
+		return http.StatusUnprocessableEntity, "validation_failed"
+	case service.TooLargeError:
+		return http.StatusRequestEntityTooLarge, "too_large"
+	}
+
+	return http.StatusInternalServerError, "internal_error"
+}
+
+// writeError hides the message of the unknown errors and of the failed rollbacks since they may expose
+// internal details, both are logged
+func (handler *Handler) writeError(writer http.ResponseWriter, err error) {
+	status, code := StatusCode(err)
+	message := err.Error()
+
+	rollback, failedRollback := err.(service.RollbackError)
+
+	if failedRollback {
+		message = rollback.Err.Error()
+	}
+
+	if (failedRollback || status == http.StatusInternalServerError) && handler.Logger != nil {
+		handler.Logger.Printf("multimedia api: %v", err)
+	}
+
+	if status == http.StatusInternalServerError {
+		message = "The request could not be processed"
+	}
+
+	writeJSON(writer, status, errorResponse{Error: ErrorBody{Code: code, Message: message}})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(body)
+}
+
+func (handler *Handler) fileKey() string {
+	if handler.FileKey == "" {
+		return DefaultFileKey
+	}
+
+	return handler.FileKey
+}
+
+func (handler *Handler) maxMBInMemory() int64 {
+	if handler.MaxMBInMemory <= 0 {
+		return DefaultMaxMBInMemory
+	}
+
+	return handler.MaxMBInMemory
+}
+
+func (handler *Handler) maxRequestSize() int64 {
+	if handler.MaxRequestSize == 0 {
+		return service.DefaultMaxRequestSize(handler.MaxSizes)
+	}
+
+	return handler.MaxRequestSize
+}
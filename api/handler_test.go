@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/metadata"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+	"github.com/alejo-lapix/multimedia-go/service"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// MemoryUploader records the uploaded items in the repository without storing files
+type MemoryUploader struct {
+	Repository *persistence.MemoryRepository
+	Type       string
+	Err        error
+}
+
+func (uploader *MemoryUploader) Upload(filename *string, destination *string) (*persistence.MultimediaItem, error) {
+	if uploader.Err != nil {
+		return nil, uploader.Err
+	}
+
+	item, err := persistence.NewMultimediaItem(aws.String("https://any-bucket.dev"), destination, aws.String(uploader.Type))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return item, uploader.Repository.Store(item)
+}
+
+func (uploader *MemoryUploader) Delete(ID *string) error {
+	if item, _ := uploader.Repository.Find(ID); item == nil {
+		return service.NotFoundError{Message: fmt.Sprintf("The multimedia item %v does not exists", *ID)}
+	}
+
+	return uploader.Repository.Remove(ID)
+}
+
+// DuplicateUploader answers every upload with the stored Item as a duplicate
+type DuplicateUploader struct {
+	MemoryUploader
+	Item *persistence.MultimediaItem
+}
+
+func (uploader *DuplicateUploader) UploadHashed(filename, destination *string, hash string) (*persistence.MultimediaItem, bool, error) {
+	return uploader.Item, true, nil
+}
+
+func (uploader *DuplicateUploader) Deduplicates() bool {
+	return true
+}
+
+// NotListableRepository hides the List method of the memory repository
+type NotListableRepository struct {
+	persistence.BasicRepository
+}
+
+func newUploadRequest(field string, content string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile(field, "photo.png")
+	_, _ = io.WriteString(part, content)
+	_ = writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return request
+}
+
+func storeItems(t *testing.T, repository *persistence.MemoryRepository, types ...string) []*persistence.MultimediaItem {
+	items := make([]*persistence.MultimediaItem, len(types))
+
+	for index, fileType := range types {
+		item, err := persistence.NewMultimediaItem(aws.String("https://any-bucket.dev"), aws.String(fmt.Sprintf("file-%v", index)), aws.String(fileType))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		item.CreatedAt = aws.String(fmt.Sprintf("2019-08-0%vT10:00:00Z", index+1))
+
+		if err = repository.Store(item); err != nil {
+			t.Fatal(err)
+		}
+
+		items[index] = item
+	}
+
+	return items
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	repository := persistence.NewMemoryRepository()
+	items := storeItems(t, repository, persistence.IMAGE, persistence.VIDEO, persistence.IMAGE)
+	missing := "00000000-0000-0000-0000-000000000000"
+
+	tests := []struct {
+		name      string
+		handler   *Handler
+		request   *http.Request
+		want      int
+		wantCode  string
+		wantItems []*persistence.MultimediaItem
+	}{
+		{
+			name:    "Uploads the multipart file",
+			request: newUploadRequest(DefaultFileKey, "content"),
+			want:    http.StatusCreated,
+		},
+		{
+			name:      "Returns 200 with the stored item if the upload is a duplicate",
+			handler:   &Handler{Uploader: &DuplicateUploader{Item: items[0]}, Repository: repository},
+			request:   newUploadRequest(DefaultFileKey, "content"),
+			want:      http.StatusOK,
+			wantItems: items[0:1],
+		},
+		{
+			name:     "Error 400 if the file field is missing",
+			request:  newUploadRequest("other", "content"),
+			want:     http.StatusBadRequest,
+			wantCode: "invalid_argument",
+		},
+		{
+			name:     "Error 400 if the body is not a multipart form",
+			request:  httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")),
+			want:     http.StatusBadRequest,
+			wantCode: "invalid_argument",
+		},
+		{
+			name:     "Error 413 if the request is too large",
+			handler:  &Handler{Uploader: &MemoryUploader{Repository: repository, Type: persistence.IMAGE}, Repository: repository, MaxRequestSize: 64},
+			request:  newUploadRequest(DefaultFileKey, strings.Repeat("content", 20)),
+			want:     http.StatusRequestEntityTooLarge,
+			wantCode: "too_large",
+		},
+		{
+			name:     "Error 413 if the file is too large for its type",
+			handler:  &Handler{Uploader: &MemoryUploader{Repository: repository, Type: persistence.IMAGE}, Repository: repository, MaxSizes: map[string]int64{persistence.IMAGE: 16}},
+			request:  newUploadRequest(DefaultFileKey, "\x89PNG\r\n\x1a\n"+strings.Repeat("content", 20)),
+			want:     http.StatusRequestEntityTooLarge,
+			wantCode: "too_large",
+		},
+		{
+			name:     "Error 422 if the uploaded item is not valid",
+			handler:  &Handler{Uploader: &MemoryUploader{Repository: repository, Type: "spreadsheet"}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusUnprocessableEntity,
+			wantCode: "validation_failed",
+		},
+		{
+			name:     "Error 422 if the file type is not supported",
+			handler:  &Handler{Uploader: &MemoryUploader{Err: service.UnsupportedFileTypeError{Filename: "photo.png"}}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusUnprocessableEntity,
+			wantCode: "validation_failed",
+		},
+		{
+			name:     "Error 422 if the file format can not be parsed",
+			handler:  &Handler{Uploader: &MemoryUploader{Err: metadata.InvalidFormatError{Message: "The JPEG file is truncated"}}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusUnprocessableEntity,
+			wantCode: "validation_failed",
+		},
+		{
+			name:     "Error 422 if the metadata of the image can not be removed",
+			handler:  &Handler{Uploader: &MemoryUploader{Err: metadata.UnstrippableFormatError{Format: "TIFF"}}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusUnprocessableEntity,
+			wantCode: "validation_failed",
+		},
+		{
+			name:     "Error 422 if the direct upload does not match",
+			handler:  &Handler{Uploader: &MemoryUploader{Err: service.VerificationError{ID: "any", Message: "The file is empty"}}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusUnprocessableEntity,
+			wantCode: "validation_failed",
+		},
+		{
+			name:     "Error of the cause without the rollback details if the rollback fails",
+			handler:  &Handler{Uploader: &MemoryUploader{Err: service.RollbackError{Err: service.InvalidArgumentError{Message: "Invalid visibility"}, RollbackErr: errors.New("secret bucket")}}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusBadRequest,
+			wantCode: "invalid_argument",
+		},
+		{
+			name:     "Error 500 without details if the upload fails",
+			handler:  &Handler{Uploader: &MemoryUploader{Err: errors.New("secret connection string")}, Repository: repository},
+			request:  newUploadRequest(DefaultFileKey, "content"),
+			want:     http.StatusInternalServerError,
+			wantCode: "internal_error",
+		},
+		{
+			name:      "Returns an item",
+			request:   httptest.NewRequest(http.MethodGet, "/"+*items[1].ID, nil),
+			want:      http.StatusOK,
+			wantItems: items[1:2],
+		},
+		{
+			name:     "Error 404 if the item does not exist",
+			request:  httptest.NewRequest(http.MethodGet, "/"+missing, nil),
+			want:     http.StatusNotFound,
+			wantCode: "not_found",
+		},
+		{
+			name:      "Returns many items ignoring the missing IDs",
+			request:   httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?ids=%v,%v,%v", *items[2].ID, missing, *items[0].ID), nil),
+			want:      http.StatusOK,
+			wantItems: []*persistence.MultimediaItem{items[2], items[0]},
+		},
+		{
+			name:      "Lists the items of a type",
+			request:   httptest.NewRequest(http.MethodGet, "/?type=image&order=desc&createdBefore=2019-12-31T00:00:00Z", nil),
+			want:      http.StatusOK,
+			wantItems: []*persistence.MultimediaItem{items[2], items[0]},
+		},
+		{
+			name:      "Lists the items created in a range",
+			request:   httptest.NewRequest(http.MethodGet, "/?createdAfter=2019-08-01T12:00:00Z&createdBefore=2019-08-03T00:00:00Z", nil),
+			want:      http.StatusOK,
+			wantItems: items[1:2],
+		},
+		{
+			name:     "Error 400 if a list parameter is not valid",
+			request:  httptest.NewRequest(http.MethodGet, "/?limit=-1", nil),
+			want:     http.StatusBadRequest,
+			wantCode: "invalid_argument",
+		},
+		{
+			name:     "Error 400 if the cursor is not valid",
+			request:  httptest.NewRequest(http.MethodGet, "/?cursor=invalid", nil),
+			want:     http.StatusBadRequest,
+			wantCode: "invalid_argument",
+		},
+		{
+			name:     "Error 501 if the repository can not list",
+			handler:  &Handler{Repository: &NotListableRepository{repository}},
+			request:  httptest.NewRequest(http.MethodGet, "/", nil),
+			want:     http.StatusNotImplemented,
+			wantCode: "not_implemented",
+		},
+		{
+			name:    "Deletes an item",
+			request: httptest.NewRequest(http.MethodDelete, "/"+*items[0].ID, nil),
+			want:    http.StatusNoContent,
+		},
+		{
+			name:     "Error 404 if the deleted item does not exist",
+			request:  httptest.NewRequest(http.MethodDelete, "/"+missing, nil),
+			want:     http.StatusNotFound,
+			wantCode: "not_found",
+		},
+		{
+			name:     "Error 405 if the method is not allowed",
+			request:  httptest.NewRequest(http.MethodPut, "/"+*items[1].ID, nil),
+			want:     http.StatusMethodNotAllowed,
+			wantCode: "method_not_allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.handler
+
+			if handler == nil {
+				handler = NewHandler(&MemoryUploader{Repository: repository, Type: persistence.IMAGE}, repository)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, tt.request)
+
+			if recorder.Code != tt.want {
+				t.Fatalf("ServeHTTP() status = %v, want %v, body %v", recorder.Code, tt.want, recorder.Body)
+			}
+
+			if tt.wantCode != "" {
+				body := &errorResponse{}
+
+				if err := json.Unmarshal(recorder.Body.Bytes(), body); err != nil || body.Error.Code != tt.wantCode {
+					t.Errorf("ServeHTTP() body = %v, want the error code %v", recorder.Body, tt.wantCode)
+				}
+
+				if strings.Contains(recorder.Body.String(), "secret") {
+					t.Errorf("ServeHTTP() body = %v, must not expose internal errors", recorder.Body)
+				}
+			}
+
+			if tt.wantItems != nil {
+				assertItems(t, recorder.Body.Bytes(), tt.wantItems)
+			}
+		})
+	}
+}
+
+// assertItems compares the IDs of an item or a page of items
+func assertItems(t *testing.T, body []byte, want []*persistence.MultimediaItem) {
+	page := &persistence.Page{}
+
+	if err := json.Unmarshal(body, page); err != nil || page.Items == nil {
+		item := &persistence.MultimediaItem{}
+
+		if err = json.Unmarshal(body, item); err != nil {
+			t.Fatalf("ServeHTTP() body = %s, error = %v", body, err)
+		}
+
+		page.Items = []*persistence.MultimediaItem{item}
+	}
+
+	var got, wantIDs []string
+
+	for _, item := range page.Items {
+		got = append(got, aws.StringValue(item.ID))
+	}
+
+	for _, item := range want {
+		wantIDs = append(wantIDs, *item.ID)
+	}
+
+	if strings.Join(got, ",") != strings.Join(wantIDs, ",") {
+		t.Errorf("ServeHTTP() items = %v, want %v", got, wantIDs)
+	}
+}
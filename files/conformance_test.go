@@ -0,0 +1,41 @@
+package files_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/files/filestest"
+	"github.com/alejo-lapix/multimedia-go/files/testdata/src"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestAWSProvider_Conformance(t *testing.T) {
+	filestest.RunProviderSuite(t, func(t *testing.T) files.Provider {
+		return &files.AWSProvider{S3: &src.MemoryMockS3{}, Opener: &files.OSFileOpener{}, Bucket: aws.String("example")}
+	})
+}
+
+func TestLocalProvider_Conformance(t *testing.T) {
+	var roots []string
+
+	defer func() {
+		for _, root := range roots {
+			os.RemoveAll(root)
+		}
+	}()
+
+	filestest.RunProviderSuite(t, func(t *testing.T) files.Provider {
+		root, err := ioutil.TempDir("", "local-provider-*")
+
+		if err != nil {
+			t.Fatalf("TempDir() error = %v", err)
+		}
+
+		roots = append(roots, root)
+
+		return files.NewLocalProvider(root)
+	})
+}
@@ -0,0 +1,142 @@
+package files
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// DefaultRegion is used by S3 compatible endpoints that do not have regions
+const DefaultRegion = "us-east-1"
+
+// URLResolver builds the public URLs of the stored objects
+type URLResolver interface {
+	// BaseURL is the URL the object keys are appended to, it is stored as the bucket of the items
+	BaseURL() string
+	ObjectURL(key string) string
+}
+
+// Endpoint describes where a bucket is served, the zero values address a bucket of AWS S3
+type Endpoint struct {
+	Bucket string
+	Region string
+	// URL is a S3 compatible endpoint e.g. "http://localhost:9000" for MinIO, AWS S3 when empty
+	URL string
+	// PathStyle addresses the bucket as URL/bucket instead of bucket.URL, MinIO and most local stand-ins require it
+	PathStyle bool
+	// PublicURL is the base URL of the public objects e.g. a CDN host, the bucket URL when empty
+	PublicURL string
+}
+
+// BucketURL returns the URL of the bucket in the S3 API
+func (endpoint Endpoint) BucketURL() (string, error) {
+	if endpoint.URL == "" {
+		return endpoint.awsURL(), nil
+	}
+
+	base, err := url.Parse(endpoint.URL)
+
+	if err != nil {
+		return "", err
+	}
+
+	if base.Scheme == "" || base.Host == "" {
+		return "", fmt.Errorf("the endpoint %q must be an absolute URL", endpoint.URL)
+	}
+
+	if endpoint.PathStyle {
+		base.Path = strings.TrimRight(base.Path, "/") + "/" + endpoint.Bucket
+	} else {
+		base.Host = endpoint.Bucket + "." + base.Host
+		base.Path = strings.TrimRight(base.Path, "/")
+	}
+
+	return base.String(), nil
+}
+
+// BaseURL returns the PublicURL or the bucket URL when it is empty, invalid endpoints return an empty URL
+func (endpoint Endpoint) BaseURL() string {
+	if endpoint.PublicURL != "" {
+		return strings.TrimRight(endpoint.PublicURL, "/")
+	}
+
+	bucketURL, _ := endpoint.BucketURL()
+
+	return bucketURL
+}
+
+// ObjectURL returns the public URL of the object, every segment of the key is escaped
+func (endpoint Endpoint) ObjectURL(key string) string {
+	segments := strings.Split(key, "/")
+
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+
+	return endpoint.BaseURL() + "/" + strings.Join(segments, "/")
+}
+
+// awsURL returns the virtual hosted URL of an AWS S3 bucket, regions other than us-east-1 use the legacy
+// dash format so the stored items keep the same URLs
+func (endpoint Endpoint) awsURL() string {
+	if endpoint.PathStyle {
+		return fmt.Sprintf("https://s3.%v.amazonaws.com/%v", endpoint.region(), endpoint.Bucket)
+	}
+
+	if endpoint.region() == DefaultRegion {
+		return fmt.Sprintf("https://%v.s3.amazonaws.com", endpoint.Bucket)
+	}
+
+	return fmt.Sprintf("https://%v.s3-%v.amazonaws.com", endpoint.Bucket, endpoint.region())
+}
+
+func (endpoint Endpoint) region() string {
+	if endpoint.Region == "" {
+		return DefaultRegion
+	}
+
+	return endpoint.Region
+}
+
+// NewS3Client returns a S3 client for the endpoint, nil credentials use the default AWS credential chain
+func NewS3Client(endpoint Endpoint, creds *credentials.Credentials) (*s3.S3, error) {
+	config := &aws.Config{
+		Region:           aws.String(endpoint.region()),
+		Credentials:      creds,
+		S3ForcePathStyle: aws.Bool(endpoint.PathStyle),
+	}
+
+	if endpoint.URL != "" {
+		config.Endpoint = aws.String(endpoint.URL)
+	}
+
+	sess, err := session.NewSession(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.New(sess), nil
+}
+
+// NewS3CompatibleProvider returns an AWSProvider that stores the objects in the bucket of the endpoint, the objects
+// are stored without canned ACL nor server side encryption by default because many S3 compatible stores
+// reject them e.g. MinIO without KMS
+func NewS3CompatibleProvider(endpoint Endpoint, creds *credentials.Credentials) (*AWSProvider, error) {
+	client, err := NewS3Client(endpoint, creds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewAWSProvider(aws.String(endpoint.Bucket), client)
+	provider.PathStyle = endpoint.PathStyle
+	provider.Defaults = &StoreOptions{Disposition: DispositionAttachment}
+
+	return provider, nil
+}
@@ -0,0 +1,70 @@
+package files
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestEndpoint_BaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		want     string
+	}{
+		{name: "AWS in us-east-1", endpoint: Endpoint{Bucket: "media"}, want: "https://media.s3.amazonaws.com"},
+		{name: "AWS in other regions", endpoint: Endpoint{Bucket: "media", Region: "us-west-2"}, want: "https://media.s3-us-west-2.amazonaws.com"},
+		{name: "AWS with path style", endpoint: Endpoint{Bucket: "media", Region: "eu-west-1", PathStyle: true}, want: "https://s3.eu-west-1.amazonaws.com/media"},
+		{name: "Custom endpoint", endpoint: Endpoint{Bucket: "media", URL: "https://storage.example.com/"}, want: "https://media.storage.example.com"},
+		{name: "MinIO with path style", endpoint: Endpoint{Bucket: "media", URL: "http://localhost:9000", PathStyle: true}, want: "http://localhost:9000/media"},
+		{name: "Public URL", endpoint: Endpoint{Bucket: "media", URL: "http://localhost:9000", PublicURL: "https://cdn.example.com/media/"}, want: "https://cdn.example.com/media"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.BaseURL(); got != tt.want {
+				t.Errorf("BaseURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpoint_ObjectURL(t *testing.T) {
+	endpoint := Endpoint{Bucket: "media", URL: "http://localhost:9000", PathStyle: true}
+
+	if got := endpoint.ObjectURL("2019/logo one.png"); got != "http://localhost:9000/media/2019/logo%20one.png" {
+		t.Errorf("ObjectURL() = %v", got)
+	}
+
+	if _, err := (Endpoint{Bucket: "media", URL: "localhost:9000"}).BucketURL(); err == nil {
+		t.Errorf("BucketURL() expects an error for relative endpoints")
+	}
+}
+
+func TestNewS3CompatibleProvider(t *testing.T) {
+	endpoint := Endpoint{Bucket: "media", URL: "http://localhost:9000", PathStyle: true}
+	provider, err := NewS3CompatibleProvider(endpoint, credentials.NewStaticCredentials("minio", "minio123", ""))
+
+	if err != nil {
+		t.Errorf("NewS3CompatibleProvider() error = %v", err)
+		return
+	}
+
+	if provider.Region != DefaultRegion || !provider.PathStyle {
+		t.Errorf("NewS3CompatibleProvider() region = %v, path style = %v", provider.Region, provider.PathStyle)
+	}
+
+	post, err := provider.PresignPost(&PostPolicy{Key: "image.png"})
+
+	if err != nil || post.URL != "http://localhost:9000/media/" {
+		t.Errorf("PresignPost() URL = %v, error = %v, want the path style URL", post, err)
+		return
+	}
+
+	if _, ok := post.Fields["acl"]; ok {
+		t.Errorf("PresignPost() fields = %v, want no canned ACL by default", post.Fields)
+	}
+
+	if _, ok := post.Fields["x-amz-server-side-encryption"]; ok {
+		t.Errorf("PresignPost() fields = %v, want no server side encryption by default", post.Fields)
+	}
+}
@@ -0,0 +1,209 @@
+// Package filestest verifies that files.Provider implementations behave the same way
+package filestest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ProviderFactory returns an empty provider, it is called once per test
+type ProviderFactory func(t *testing.T) files.Provider
+
+// RunProviderSuite runs the conformance tests against the providers returned by the factory
+func RunProviderSuite(t *testing.T, factory ProviderFactory) {
+	t.Run("StoreStream", func(t *testing.T) { testStoreStream(t, factory(t)) })
+	t.Run("Store", func(t *testing.T) { testStore(t, factory(t)) })
+	t.Run("ReadStream", func(t *testing.T) { testReadStream(t, factory(t)) })
+	t.Run("ReadRange", func(t *testing.T) { testReadRange(t, factory(t)) })
+	t.Run("Remove", func(t *testing.T) { testRemove(t, factory(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, factory(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory(t)) })
+}
+
+// content returns size bytes that are different for every seed
+func content(size int, seed byte) []byte {
+	result := make([]byte, size)
+
+	for index := range result {
+		result[index] = byte(index%251) + seed
+	}
+
+	return result
+}
+
+func testStoreStream(t *testing.T, provider files.Provider) {
+	path := aws.String("conformance/stream.bin")
+	first := content(64<<10, 1)
+
+	if err := provider.StoreStream(bytes.NewReader(first), path, nil); err != nil {
+		t.Fatalf("StoreStream() error = %v", err)
+	}
+
+	if got, err := provider.Read(path); err != nil || !bytes.Equal(got, first) {
+		t.Fatalf("Read() got %v bytes, error = %v, want the %v stored bytes", len(got), err, len(first))
+	}
+
+	second := []byte("replaced content")
+
+	if err := provider.StoreStream(ioutil.NopCloser(bytes.NewReader(second)), path, nil); err != nil {
+		t.Fatalf("StoreStream() error = %v, storing a reader that can not seek", err)
+	}
+
+	if got, err := provider.Read(path); err != nil || !bytes.Equal(got, second) {
+		t.Errorf("Read() got = %q, error = %v, storing an existing path must replace it", got, err)
+	}
+}
+
+func testStore(t *testing.T, provider files.Provider) {
+	file, err := ioutil.TempFile("", "filestest-*")
+
+	if err != nil {
+		t.Fatalf("TempFile() error = %v", err)
+	}
+
+	defer os.Remove(file.Name())
+
+	expected := content(1024, 2)
+	_, _ = file.Write(expected)
+	_ = file.Close()
+
+	if err = provider.Store(aws.String(file.Name()), aws.String("conformance/local.bin")); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if got, err := provider.Read(aws.String("conformance/local.bin")); err != nil || !bytes.Equal(got, expected) {
+		t.Errorf("Read() got %v bytes, error = %v, want the content of the local file", len(got), err)
+	}
+}
+
+func testReadStream(t *testing.T, provider files.Provider) {
+	expected := content(4096, 3)
+	_ = provider.StoreStream(bytes.NewReader(expected), aws.String("conformance/read.bin"), nil)
+
+	body, info, err := provider.ReadStream(aws.String("conformance/read.bin"))
+
+	if err != nil {
+		t.Fatalf("ReadStream() error = %v", err)
+	}
+
+	defer body.Close()
+
+	got, err := ioutil.ReadAll(body)
+
+	if err != nil || !bytes.Equal(got, expected) {
+		t.Errorf("ReadStream() got %v bytes, error = %v, want %v bytes", len(got), err, len(expected))
+	}
+
+	if info.ContentLength != -1 && info.ContentLength != int64(len(expected)) {
+		t.Errorf("ReadStream() ContentLength = %v, want %v", info.ContentLength, len(expected))
+	}
+}
+
+func testReadRange(t *testing.T, provider files.Provider) {
+	expected := content(1000, 4)
+	_ = provider.StoreStream(bytes.NewReader(expected), aws.String("conformance/range.bin"), nil)
+
+	ranges := []struct {
+		byteRange  string
+		start, end int
+	}{
+		{byteRange: "bytes=0-511", start: 0, end: 511},
+		{byteRange: "bytes=100-199", start: 100, end: 199},
+		{byteRange: "bytes=900-999", start: 900, end: 999},
+	}
+
+	for _, tt := range ranges {
+		body, info, err := provider.ReadRange(aws.String("conformance/range.bin"), tt.byteRange)
+
+		if err != nil {
+			t.Errorf("ReadRange(%v) error = %v", tt.byteRange, err)
+			continue
+		}
+
+		got, err := ioutil.ReadAll(body)
+		body.Close()
+
+		if err != nil || !bytes.Equal(got, expected[tt.start:tt.end+1]) {
+			t.Errorf("ReadRange(%v) got %v bytes, error = %v, want bytes %v to %v", tt.byteRange, len(got), err, tt.start, tt.end)
+		}
+
+		wantRange := fmt.Sprintf("bytes %v-%v/%v", tt.start, tt.end, len(expected))
+
+		if info.ContentRange != wantRange {
+			t.Errorf("ReadRange(%v) ContentRange = %q, want %q", tt.byteRange, info.ContentRange, wantRange)
+		}
+	}
+}
+
+func testRemove(t *testing.T, provider files.Provider) {
+	path := aws.String("conformance/remove.bin")
+	_ = provider.StoreStream(bytes.NewReader(content(10, 5)), path, nil)
+
+	if err := provider.Remove(path); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	if _, err := provider.Read(path); !files.IsNotFound(err) {
+		t.Errorf("Read() error = %v, want a not found error after Remove()", err)
+	}
+
+	if err := provider.Remove(path); err != nil {
+		t.Errorf("Remove() error = %v, removing a missing object is not an error", err)
+	}
+}
+
+func testNotFound(t *testing.T, provider files.Provider) {
+	path := aws.String("conformance/missing.bin")
+
+	if _, err := provider.Read(path); !files.IsNotFound(err) {
+		t.Errorf("Read() error = %v, want a not found error", err)
+	}
+
+	if _, _, err := provider.ReadStream(path); !files.IsNotFound(err) {
+		t.Errorf("ReadStream() error = %v, want a not found error", err)
+	}
+
+	if _, _, err := provider.ReadRange(path, "bytes=0-9"); !files.IsNotFound(err) {
+		t.Errorf("ReadRange() error = %v, want a not found error", err)
+	}
+}
+
+func testConcurrency(t *testing.T, provider files.Provider) {
+	var group sync.WaitGroup
+	errors := make(chan error, 16)
+
+	for index := 0; index < 16; index++ {
+		group.Add(1)
+
+		go func(index int) {
+			defer group.Done()
+
+			path := aws.String(fmt.Sprintf("conformance/concurrent-%v.bin", index))
+			expected := content(8192, byte(index))
+
+			if err := provider.StoreStream(bytes.NewReader(expected), path, nil); err != nil {
+				errors <- err
+				return
+			}
+
+			if got, err := provider.Read(path); err != nil || !bytes.Equal(got, expected) {
+				errors <- fmt.Errorf("%v does not have the stored content, error = %v", *path, err)
+			}
+		}(index)
+	}
+
+	group.Wait()
+	close(errors)
+
+	for err := range errors {
+		t.Errorf("concurrent StoreStream() and Read() error = %v", err)
+	}
+}
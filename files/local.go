@@ -0,0 +1,267 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// InvalidPathError is returned when a path is empty or points outside of the root directory
+type InvalidPathError struct {
+	Path string
+}
+
+func (err InvalidPathError) Error() string {
+	return fmt.Sprintf("The path %q is not valid", err.Path)
+}
+
+// InvalidRangeError is returned when a byte range can not be satisfied
+type InvalidRangeError struct {
+	Range string
+}
+
+func (err InvalidRangeError) Error() string {
+	return fmt.Sprintf("The range %q is not valid", err.Range)
+}
+
+// LocalProvider stores the objects as files under the Root directory, it is meant for local development
+// and tests so the store options are ignored
+type LocalProvider struct {
+	Root   string
+	Opener FileOpener
+}
+
+// NewLocalProvider returns a LocalProvider that stores the objects under the given directory
+func NewLocalProvider(root string) *LocalProvider {
+	return &LocalProvider{
+		Root:   root,
+		Opener: &OSFileOpener{},
+	}
+}
+
+// Store copies the local file to the given path of the root directory
+func (provider *LocalProvider) Store(filename *string, destination *string) error {
+	file, err := provider.Opener.Open(*filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return provider.StoreStream(file, destination, nil)
+}
+
+// StoreStream writes the content of the reader to a temporary file that replaces the object once it is complete
+func (provider *LocalProvider) StoreStream(reader io.Reader, destination *string, options *StoreOptions) error {
+	target, err := provider.resolve(destination)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	temporal, err := ioutil.TempFile(filepath.Dir(target), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temporal.Name())
+
+	if _, err = io.Copy(temporal, reader); err != nil {
+		temporal.Close()
+
+		return err
+	}
+
+	if err = temporal.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temporal.Name(), target)
+}
+
+// Read reads a whole object
+func (provider *LocalProvider) Read(path *string) ([]byte, error) {
+	target, err := provider.resolve(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(target)
+}
+
+// ReadStream returns the content of an object, the caller must close it
+func (provider *LocalProvider) ReadStream(path *string) (io.ReadCloser, *ObjectInfo, error) {
+	file, info, err := provider.open(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, info, nil
+}
+
+// ReadRange returns a part of an object, byteRange uses the HTTP Range header format e.g. "bytes=0-1023"
+func (provider *LocalProvider) ReadRange(path *string, byteRange string) (io.ReadCloser, *ObjectInfo, error) {
+	file, info, err := provider.open(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start, end, err := parseByteRange(byteRange, info.ContentLength)
+
+	if err != nil {
+		file.Close()
+
+		return nil, nil, err
+	}
+
+	info.ContentRange = fmt.Sprintf("bytes %v-%v/%v", start, end, info.ContentLength)
+	info.ContentLength = end - start + 1
+
+	return sectionReadCloser{
+		Reader: io.NewSectionReader(file, start, info.ContentLength),
+		Closer: file,
+	}, info, nil
+}
+
+// Stat returns the information of an object without reading its content
+func (provider *LocalProvider) Stat(path *string) (*ObjectInfo, error) {
+	file, info, err := provider.open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info, file.Close()
+}
+
+// Remove deletes an object, removing an object that does not exist is not an error
+func (provider *LocalProvider) Remove(filename *string) error {
+	target, err := provider.resolve(filename)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (provider *LocalProvider) open(path *string) (*os.File, *ObjectInfo, error) {
+	target, err := provider.resolve(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(target)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+
+		return nil, nil, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(target))
+
+	if contentType == "" {
+		if contentType, err = sniffContentType(file); err != nil {
+			file.Close()
+
+			return nil, nil, err
+		}
+	}
+
+	return file, &ObjectInfo{
+		ContentType:   contentType,
+		ContentLength: stat.Size(),
+		ETag:          fmt.Sprintf("\"%x-%x\"", stat.ModTime().UnixNano(), stat.Size()),
+	}, nil
+}
+
+// resolve returns the file of the given object path, paths that escape the root directory are rejected
+func (provider *LocalProvider) resolve(path *string) (string, error) {
+	if path == nil || *path == "" {
+		return "", InvalidPathError{}
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(*path))
+	parent := ".." + string(filepath.Separator)
+
+	if filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, parent) || filepath.VolumeName(cleaned) != "" {
+		return "", InvalidPathError{Path: *path}
+	}
+
+	return filepath.Join(provider.Root, cleaned), nil
+}
+
+// parseByteRange parses a single range of the HTTP Range header and returns its inclusive limits
+func parseByteRange(byteRange string, size int64) (int64, int64, error) {
+	invalid := InvalidRangeError{Range: byteRange}
+	limits := strings.SplitN(strings.TrimPrefix(byteRange, "bytes="), "-", 2)
+
+	if !strings.HasPrefix(byteRange, "bytes=") || len(limits) != 2 || size == 0 {
+		return 0, 0, invalid
+	}
+
+	if limits[0] == "" {
+		suffix, err := strconv.ParseInt(limits[1], 10, 64)
+
+		if err != nil || suffix <= 0 {
+			return 0, 0, invalid
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+
+		return size - suffix, size - 1, nil
+	}
+
+	start, err := strconv.ParseInt(limits[0], 10, 64)
+
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, invalid
+	}
+
+	end := size - 1
+
+	if limits[1] != "" {
+		if end, err = strconv.ParseInt(limits[1], 10, 64); err != nil || end < start {
+			return 0, 0, invalid
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, nil
+}
+
+type sectionReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,126 @@
+package files
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func newLocalProvider(t *testing.T) (*LocalProvider, func()) {
+	root, err := ioutil.TempDir("", "local-provider-*")
+
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+
+	return NewLocalProvider(root), func() { os.RemoveAll(root) }
+}
+
+func TestLocalProvider_StoreStream(t *testing.T) {
+	provider, clean := newLocalProvider(t)
+	defer clean()
+
+	content := []byte("%PDF-1.4 local content")
+
+	if err := provider.StoreStream(bytes.NewReader(content), aws.String("documents/report.pdf"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v", err)
+		return
+	}
+
+	got, err := provider.Read(aws.String("documents/report.pdf"))
+
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Read() got = %q, error = %v, want %q", got, err, content)
+	}
+
+	info, err := provider.Stat(aws.String("documents/report.pdf"))
+
+	if err != nil || info.ContentType != "application/pdf" || info.ContentLength != int64(len(content)) {
+		t.Errorf("Stat() got = %+v, error = %v", info, err)
+	}
+
+	if err = provider.Remove(aws.String("documents/report.pdf")); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+
+	if _, err = provider.Read(aws.String("documents/report.pdf")); !os.IsNotExist(err) {
+		t.Errorf("Read() error = %v, want a not exist error", err)
+	}
+
+	if err = provider.Remove(aws.String("documents/report.pdf")); err != nil {
+		t.Errorf("Remove() error = %v, removing a missing object is not an error", err)
+	}
+}
+
+func TestLocalProvider_PathTraversal(t *testing.T) {
+	provider, clean := newLocalProvider(t)
+	defer clean()
+
+	outside := filepath.Join(filepath.Dir(provider.Root), "outside.txt")
+	defer os.Remove(outside)
+
+	paths := []string{"", ".", "..", "../outside.txt", "documents/../../outside.txt", "/etc/passwd"}
+
+	for _, path := range paths {
+		err := provider.StoreStream(bytes.NewReader([]byte("content")), aws.String(path), nil)
+
+		if _, ok := err.(InvalidPathError); !ok {
+			t.Errorf("StoreStream(%q) error = %v, want InvalidPathError", path, err)
+		}
+
+		if _, err = provider.Read(aws.String(path)); err == nil {
+			t.Errorf("Read(%q) expects an error", path)
+		}
+	}
+
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("StoreStream() wrote a file outside of the root directory")
+	}
+
+	if err := provider.StoreStream(bytes.NewReader([]byte("content")), aws.String("documents/../inside.txt"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v, paths that stay inside the root are valid", err)
+	}
+}
+
+func TestLocalProvider_ReadRange(t *testing.T) {
+	provider, clean := newLocalProvider(t)
+	defer clean()
+
+	_ = provider.StoreStream(bytes.NewReader([]byte("0123456789")), aws.String("numbers.txt"), nil)
+
+	tests := []struct {
+		name      string
+		byteRange string
+		want      string
+		wantRange string
+		wantErr   bool
+	}{
+		{name: "Reads a closed range", byteRange: "bytes=2-4", want: "234", wantRange: "bytes 2-4/10"},
+		{name: "Reads an open range", byteRange: "bytes=7-", want: "789", wantRange: "bytes 7-9/10"},
+		{name: "Reads a suffix", byteRange: "bytes=-2", want: "89", wantRange: "bytes 8-9/10"},
+		{name: "Truncates the end", byteRange: "bytes=8-20", want: "89", wantRange: "bytes 8-9/10"},
+		{name: "Error if the start is out of the file", byteRange: "bytes=10-", wantErr: true},
+		{name: "Error if the range is malformed", byteRange: "items=0-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, info, err := provider.ReadRange(aws.String("numbers.txt"), tt.byteRange)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			defer body.Close()
+			got, _ := ioutil.ReadAll(body)
+			if string(got) != tt.want || info.ContentRange != tt.wantRange || info.ContentLength != int64(len(tt.want)) {
+				t.Errorf("ReadRange() got = %q %+v, want %q %v", got, info, tt.want, tt.wantRange)
+			}
+		})
+	}
+}
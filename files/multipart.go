@@ -0,0 +1,347 @@
+package files
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// MinPartSize is the smallest part accepted by S3, except for the last one
+	MinPartSize        = 5 << 20
+	DefaultPartSize    = 8 << 20
+	DefaultConcurrency = 4
+	// MaxUploadParts is the largest amount of parts of a multipart upload accepted by S3
+	MaxUploadParts = 10000
+	// MaxObjectSize is the size of the largest object accepted by S3
+	MaxObjectSize = 5 << 40
+)
+
+// UploadCheckpoint persists the IDs of the multipart uploads in progress so an interrupted upload
+// can be resumed, the same PartSize must be used to resume an upload. The uploads that are never
+// resumed must be removed with AbortUpload or expired by a lifecycle rule of the bucket
+type UploadCheckpoint interface {
+	// Load returns the upload ID stored for the given key or an empty string
+	Load(key string) (string, error)
+	Save(key, uploadID string) error
+	Delete(key string) error
+}
+
+type MultipartUploadError struct {
+	UploadID string
+	Err      error
+	// Resumable reports if the upload and its checkpoint were kept, storing the same key again resumes it
+	Resumable bool
+}
+
+func (err MultipartUploadError) Error() string {
+	return fmt.Sprintf("Multipart upload %v failed: %v", err.UploadID, err.Err)
+}
+
+func (provider *AWSProvider) partSize() int64 {
+	if provider.PartSize < MinPartSize {
+		return DefaultPartSize
+	}
+
+	return provider.PartSize
+}
+
+// multipartPartSize returns the part size of an object of the given size, the PartSize grows in whole MiB
+// when the object would need more than MaxUploadParts parts. The objects larger than MaxObjectSize return
+// an error
+func (provider *AWSProvider) multipartPartSize(size int64) (int64, error) {
+	if size > MaxObjectSize {
+		return 0, fmt.Errorf("The object of %v bytes exceeds the limit of %v bytes of S3", size, int64(MaxObjectSize))
+	}
+
+	partSize := provider.partSize()
+
+	if size <= partSize*MaxUploadParts {
+		return partSize, nil
+	}
+
+	partSize = (size + MaxUploadParts - 1) / MaxUploadParts
+
+	return (partSize + 1<<20 - 1) &^ (1<<20 - 1), nil
+}
+
+func (provider *AWSProvider) concurrency() int {
+	if provider.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+
+	return provider.Concurrency
+}
+
+// storeMultipart uploads the body in parts, the parts already uploaded by a checkpointed upload are reused
+// when they match the body. A checkpointed upload that fails with a retryable error is kept to be resumed,
+// otherwise the upload is aborted
+func (provider *AWSProvider) storeMultipart(body *io.SectionReader, input *s3.PutObjectInput) error {
+	partSize, err := provider.multipartPartSize(body.Size())
+
+	if err != nil {
+		return err
+	}
+
+	uploadID, uploaded, err := provider.startMultipart(input)
+
+	if err != nil {
+		return err
+	}
+
+	parts, err := provider.uploadParts(body, partSize, input.Key, uploadID, uploaded)
+
+	if err == nil {
+		_, err = provider.S3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          provider.Bucket,
+			Key:             input.Key,
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err != nil && provider.Checkpoints != nil && request.IsErrorRetryable(err) {
+		return MultipartUploadError{UploadID: uploadID, Err: err, Resumable: true}
+	}
+
+	if err != nil {
+		_, _ = provider.S3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   provider.Bucket,
+			Key:      input.Key,
+			UploadId: aws.String(uploadID),
+		})
+	}
+
+	if provider.Checkpoints != nil {
+		if checkpointErr := provider.Checkpoints.Delete(*input.Key); checkpointErr != nil && err == nil {
+			return checkpointErr
+		}
+	}
+
+	if err != nil {
+		return MultipartUploadError{UploadID: uploadID, Err: err}
+	}
+
+	return nil
+}
+
+// AbortUpload aborts the checkpointed upload of the key and deletes its checkpoint, it does nothing when
+// the key does not have a checkpoint
+func (provider *AWSProvider) AbortUpload(key *string) error {
+	if provider.Checkpoints == nil {
+		return nil
+	}
+
+	uploadID, err := provider.Checkpoints.Load(*key)
+
+	if err != nil || uploadID == "" {
+		return err
+	}
+
+	_, err = provider.S3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   provider.Bucket,
+		Key:      key,
+		UploadId: aws.String(uploadID),
+	})
+
+	// the upload may have been completed, aborted or expired already
+	if awsErr, ok := err.(awserr.Error); err != nil && (!ok || awsErr.Code() != s3.ErrCodeNoSuchUpload) {
+		return err
+	}
+
+	return provider.Checkpoints.Delete(*key)
+}
+
+// startMultipart resumes the checkpointed upload of the key returning its uploaded parts or creates a new one
+func (provider *AWSProvider) startMultipart(input *s3.PutObjectInput) (string, map[int64]*s3.Part, error) {
+	if provider.Checkpoints != nil {
+		uploadID, err := provider.Checkpoints.Load(*input.Key)
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		if uploadID != "" {
+			uploaded, err := provider.listParts(input.Key, uploadID)
+
+			// the upload may have been aborted or expired, in that case a new one is created
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != s3.ErrCodeNoSuchUpload {
+				return uploadID, uploaded, err
+			}
+		}
+	}
+
+	output, err := provider.S3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ContentType:          input.ContentType,
+		ACL:                  input.ACL,
+		ContentDisposition:   input.ContentDisposition,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		CacheControl:         input.CacheControl,
+		StorageClass:         input.StorageClass,
+		Metadata:             input.Metadata,
+	})
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if provider.Checkpoints != nil {
+		if err = provider.Checkpoints.Save(*input.Key, *output.UploadId); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return *output.UploadId, map[int64]*s3.Part{}, nil
+}
+
+func (provider *AWSProvider) listParts(key *string, uploadID string) (map[int64]*s3.Part, error) {
+	uploaded := make(map[int64]*s3.Part)
+	input := &s3.ListPartsInput{Bucket: provider.Bucket, Key: key, UploadId: aws.String(uploadID)}
+
+	for {
+		output, err := provider.S3.ListParts(input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range output.Parts {
+			uploaded[*part.PartNumber] = part
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return uploaded, nil
+		}
+
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+// uploadParts uploads the parts that were not uploaded yet or do not match the body with a bounded amount
+// of workers, it stops at the first error
+func (provider *AWSProvider) uploadParts(body *io.SectionReader, partSize int64, key *string, uploadID string, uploaded map[int64]*s3.Part) ([]*s3.CompletedPart, error) {
+	total := (body.Size() + partSize - 1) / partSize
+	completed := make(map[int64]*s3.CompletedPart, total)
+
+	pending := make(chan int64)
+	failed := make(chan struct{})
+
+	var mutex sync.Mutex
+	var firstErr error
+	var workers sync.WaitGroup
+
+	for worker := 0; worker < provider.concurrency(); worker++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for number := range pending {
+				offset := (number - 1) * partSize
+				length := partSize
+
+				if offset+length > body.Size() {
+					length = body.Size() - offset
+				}
+
+				etag, err := provider.uploadPart(io.NewSectionReader(body, offset, length), key, uploadID, number, uploaded[number])
+
+				mutex.Lock()
+
+				if err != nil && firstErr == nil {
+					firstErr = err
+					close(failed)
+				} else if err == nil {
+					completed[number] = &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: etag}
+				}
+
+				mutex.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for number := int64(1); number <= total; number++ {
+		select {
+		case pending <- number:
+		case <-failed:
+			break dispatch
+		}
+	}
+
+	close(pending)
+	workers.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	parts := make([]*s3.CompletedPart, 0, total)
+
+	for _, part := range completed {
+		parts = append(parts, part)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+
+	return parts, nil
+}
+
+// uploadPart returns the ETag of the uploaded part when it matches the section, otherwise the section
+// is uploaded
+func (provider *AWSProvider) uploadPart(section *io.SectionReader, key *string, uploadID string, number int64, uploaded *s3.Part) (*string, error) {
+	matches, err := matchesPart(section, uploaded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if matches {
+		return uploaded.ETag, nil
+	}
+
+	output, err := provider.S3.UploadPart(&s3.UploadPartInput{
+		Bucket:        provider.Bucket,
+		Key:           key,
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(number),
+		Body:          io.NewSectionReader(section, 0, section.Size()),
+		ContentLength: aws.Int64(section.Size()),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output.ETag, nil
+}
+
+// matchesPart compares the size and the MD5 of the section with the ones of an uploaded part, the parts
+// encrypted with SSE-KMS do not have the MD5 as ETag so they never match and are uploaded again
+func matchesPart(section *io.SectionReader, part *s3.Part) (bool, error) {
+	if part == nil || aws.Int64Value(part.Size) != section.Size() {
+		return false, nil
+	}
+
+	hash := md5.New()
+
+	if _, err := io.Copy(hash, io.NewSectionReader(section, 0, section.Size())); err != nil {
+		return false, err
+	}
+
+	return strings.Trim(aws.StringValue(part.ETag), `"`) == hex.EncodeToString(hash.Sum(nil)), nil
+}
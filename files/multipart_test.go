@@ -0,0 +1,271 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/files/testdata/src"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type MemoryCheckpoint map[string]string
+
+func (checkpoint MemoryCheckpoint) Load(key string) (string, error) {
+	return checkpoint[key], nil
+}
+
+func (checkpoint MemoryCheckpoint) Save(key, uploadID string) error {
+	checkpoint[key] = uploadID
+
+	return nil
+}
+
+func (checkpoint MemoryCheckpoint) Delete(key string) error {
+	delete(checkpoint, key)
+
+	return nil
+}
+
+func multipartContent() []byte {
+	content := make([]byte, 2*MinPartSize+1024)
+
+	for index := range content {
+		content[index] = byte(index % 251)
+	}
+
+	return content
+}
+
+func TestAWSProvider_StoreMultipart(t *testing.T) {
+	content := multipartContent()
+	client := &src.MultipartMockS3{}
+	checkpoint := MemoryCheckpoint{}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Concurrency: 2, Checkpoints: checkpoint}
+
+	if err := provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v", err)
+		return
+	}
+
+	if !bytes.Equal(client.Objects["video.mp4"], content) {
+		t.Errorf("StoreStream() stored %v bytes, want the %v bytes of the content", len(client.Objects["video.mp4"]), len(content))
+	}
+
+	if len(client.Uploaded) != 3 {
+		t.Errorf("StoreStream() uploaded %v parts, want 3", len(client.Uploaded))
+	}
+
+	if len(checkpoint) != 0 {
+		t.Errorf("StoreStream() did not delete the checkpoint")
+	}
+}
+
+func TestAWSProvider_StoreMultipartFailure(t *testing.T) {
+	content := multipartContent()
+	client := &src.MultipartMockS3{FailPart: 2}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Concurrency: 1}
+
+	err := provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil)
+	multipartErr, ok := err.(MultipartUploadError)
+
+	if !ok || multipartErr.Resumable {
+		t.Errorf("StoreStream() error = %#v, want a MultipartUploadError that is not resumable", err)
+		return
+	}
+
+	if !reflect.DeepEqual(client.Aborted, []string{multipartErr.UploadID}) {
+		t.Errorf("StoreStream() aborted = %v, want %v", client.Aborted, multipartErr.UploadID)
+	}
+
+	if _, stored := client.Objects["video.mp4"]; stored {
+		t.Errorf("StoreStream() must not store the object")
+	}
+}
+
+func TestAWSProvider_StoreMultipartRetry(t *testing.T) {
+	content := multipartContent()
+	client := &src.MultipartMockS3{FailPart: 3}
+	checkpoint := MemoryCheckpoint{}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Concurrency: 1, Checkpoints: checkpoint}
+
+	err := provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil)
+	multipartErr, ok := err.(MultipartUploadError)
+
+	if !ok || !multipartErr.Resumable {
+		t.Errorf("StoreStream() error = %#v, want a resumable MultipartUploadError", err)
+		return
+	}
+
+	if len(client.Aborted) != 0 || checkpoint["video.mp4"] != multipartErr.UploadID {
+		t.Errorf("StoreStream() aborted = %v, checkpoint = %v, want to keep the upload %v", client.Aborted, checkpoint, multipartErr.UploadID)
+	}
+
+	client.FailPart = 0
+	client.Uploaded = nil
+
+	if err = provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v, retrying the upload", err)
+		return
+	}
+
+	if !reflect.DeepEqual(client.Uploaded, []int64{3}) {
+		t.Errorf("StoreStream() uploaded parts = %v, want only the missing part 3", client.Uploaded)
+	}
+
+	if !bytes.Equal(client.Objects["video.mp4"], content) || len(checkpoint) != 0 {
+		t.Errorf("StoreStream() must store the content and delete the checkpoint")
+	}
+}
+
+func TestAWSProvider_AbortUpload(t *testing.T) {
+	client := &src.MultipartMockS3{FailPart: 1}
+	checkpoint := MemoryCheckpoint{}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Checkpoints: checkpoint}
+
+	err := provider.StoreStream(bytes.NewReader(multipartContent()), aws.String("video.mp4"), nil)
+	multipartErr, _ := err.(MultipartUploadError)
+
+	if err = provider.AbortUpload(aws.String("video.mp4")); err != nil {
+		t.Errorf("AbortUpload() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(client.Aborted, []string{multipartErr.UploadID}) || len(checkpoint) != 0 {
+		t.Errorf("AbortUpload() aborted = %v, checkpoint = %v, want to abort %v", client.Aborted, checkpoint, multipartErr.UploadID)
+	}
+
+	if err = provider.AbortUpload(aws.String("video.mp4")); err != nil {
+		t.Errorf("AbortUpload() error = %v, want nothing to abort", err)
+	}
+}
+
+func TestAWSProvider_StoreMultipartResume(t *testing.T) {
+	content := multipartContent()
+	client := &src.MultipartMockS3{PageSize: 1}
+	output, _ := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Key: aws.String("video.mp4")})
+
+	for number := int64(1); number <= 2; number++ {
+		part := content[(number-1)*MinPartSize : number*MinPartSize]
+		_, _ = client.UploadPart(&s3.UploadPartInput{UploadId: output.UploadId, PartNumber: aws.Int64(number), Body: bytes.NewReader(part)})
+	}
+
+	client.Uploaded = nil
+	checkpoint := MemoryCheckpoint{"video.mp4": *output.UploadId}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Checkpoints: checkpoint}
+
+	if err := provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(client.Uploaded, []int64{3}) {
+		t.Errorf("StoreStream() uploaded parts = %v, want only the missing part 3", client.Uploaded)
+	}
+
+	if !bytes.Equal(client.Objects["video.mp4"], content) {
+		t.Errorf("StoreStream() resumed object does not match the content")
+	}
+}
+
+func TestAWSProvider_StoreMultipartResumeChangedBody(t *testing.T) {
+	content := multipartContent()
+	client := &src.MultipartMockS3{}
+	output, _ := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Key: aws.String("video.mp4")})
+	stale := append([]byte(nil), content[:MinPartSize]...)
+	stale[0]++
+
+	_, _ = client.UploadPart(&s3.UploadPartInput{UploadId: output.UploadId, PartNumber: aws.Int64(1), Body: bytes.NewReader(stale)})
+	_, _ = client.UploadPart(&s3.UploadPartInput{UploadId: output.UploadId, PartNumber: aws.Int64(2), Body: bytes.NewReader(content[MinPartSize : MinPartSize+10])})
+
+	client.Uploaded = nil
+	checkpoint := MemoryCheckpoint{"video.mp4": *output.UploadId}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Concurrency: 1, Checkpoints: checkpoint}
+
+	if err := provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(client.Uploaded, []int64{1, 2, 3}) {
+		t.Errorf("StoreStream() uploaded parts = %v, want the parts that do not match the body", client.Uploaded)
+	}
+
+	if !bytes.Equal(client.Objects["video.mp4"], content) {
+		t.Errorf("StoreStream() resumed object does not match the content")
+	}
+}
+
+func TestAWSProvider_StoreMultipartExpiredCheckpoint(t *testing.T) {
+	content := multipartContent()
+	client := &src.MultipartMockS3{}
+	checkpoint := MemoryCheckpoint{"video.mp4": "expired-upload"}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example"), PartSize: MinPartSize, Checkpoints: checkpoint}
+
+	if err := provider.StoreStream(bytes.NewReader(content), aws.String("video.mp4"), nil); err != nil {
+		t.Errorf("StoreStream() error = %v", err)
+		return
+	}
+
+	if !bytes.Equal(client.Objects["video.mp4"], content) {
+		t.Errorf("StoreStream() object does not match the content")
+	}
+}
+
+func TestAWSProvider_MultipartPartSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		partSize int64
+		size     int64
+		want     int64
+		wantErr  bool
+	}{
+		{name: "Uses the PartSize", partSize: MinPartSize, size: 3 * MinPartSize, want: MinPartSize},
+		{name: "Uses the PartSize up to the limit of parts", size: DefaultPartSize * MaxUploadParts, want: DefaultPartSize},
+		{name: "Grows the PartSize beyond the limit of parts", size: DefaultPartSize*MaxUploadParts + 1, want: DefaultPartSize + 1<<20},
+		{name: "Grows the PartSize of the largest object", size: MaxObjectSize, want: 525 << 20},
+		{name: "Rejects the objects larger than S3 accepts", size: MaxObjectSize + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &AWSProvider{PartSize: tt.partSize}
+			got, err := provider.multipartPartSize(tt.size)
+
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("multipartPartSize() got = %v, error = %v, want %v", got, err, tt.want)
+			}
+
+			if !tt.wantErr && (tt.size+got-1)/got > MaxUploadParts {
+				t.Errorf("multipartPartSize() got = %v, the object needs more than %v parts", got, MaxUploadParts)
+			}
+		})
+	}
+}
+
+// zeroReaderAt reads zeros
+type zeroReaderAt struct{}
+
+func (reader zeroReaderAt) ReadAt(data []byte, offset int64) (int, error) {
+	for index := range data {
+		data[index] = 0
+	}
+
+	return len(data), nil
+}
+
+func TestAWSProvider_StoreMultipartTooLarge(t *testing.T) {
+	client := &src.MultipartMockS3{}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example")}
+	body := io.NewSectionReader(zeroReaderAt{}, 0, MaxObjectSize+1)
+
+	if err := provider.StoreStream(body, aws.String("video.mp4"), nil); err == nil {
+		t.Errorf("StoreStream() expects an error for the objects larger than %v bytes", int64(MaxObjectSize))
+	}
+
+	if len(client.Uploaded) != 0 || client.Objects["video.mp4"] != nil {
+		t.Errorf("StoreStream() uploaded %v parts, want the upload rejected before it starts", len(client.Uploaded))
+	}
+}
@@ -0,0 +1,121 @@
+package files
+
+import (
+	"mime"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+)
+
+// StoreOptions configures how an object is stored, empty values fall back to the provider defaults
+type StoreOptions struct {
+	// ACL is a S3 canned ACL e.g. s3.ObjectCannedACLPrivate or s3.ObjectCannedACLPublicRead
+	ACL string
+	// Disposition is DispositionInline or DispositionAttachment
+	Disposition string
+	// Filename is suggested to the browsers in the Content-Disposition header
+	Filename string
+	// ServerSideEncryption is s3.ServerSideEncryptionAes256 or s3.ServerSideEncryptionAwsKms
+	ServerSideEncryption string
+	// KMSKeyID is the key used with s3.ServerSideEncryptionAwsKms, the AWS managed key is used when empty
+	KMSKeyID     string
+	CacheControl string
+	StorageClass string
+	// Metadata is stored as x-amz-meta-* headers
+	Metadata map[string]string
+}
+
+// DefaultStoreOptions returns the options used by providers without defaults, objects are public attachments
+func DefaultStoreOptions() *StoreOptions {
+	return &StoreOptions{
+		ACL:                  s3.ObjectCannedACLPublicRead,
+		Disposition:          DispositionAttachment,
+		ServerSideEncryption: s3.ServerSideEncryptionAes256,
+	}
+}
+
+// Merge returns a copy of the defaults overridden by the non empty values of the options
+func (defaults *StoreOptions) Merge(options *StoreOptions) *StoreOptions {
+	result := *defaults
+	result.Metadata = make(map[string]string, len(defaults.Metadata))
+
+	for key, value := range defaults.Metadata {
+		result.Metadata[key] = value
+	}
+
+	if options == nil {
+		return &result
+	}
+
+	override(&result.ACL, options.ACL)
+	override(&result.Disposition, options.Disposition)
+	override(&result.Filename, options.Filename)
+	override(&result.ServerSideEncryption, options.ServerSideEncryption)
+	override(&result.KMSKeyID, options.KMSKeyID)
+	override(&result.CacheControl, options.CacheControl)
+	override(&result.StorageClass, options.StorageClass)
+
+	for key, value := range options.Metadata {
+		result.Metadata[key] = value
+	}
+
+	return &result
+}
+
+// ContentDisposition returns the Content-Disposition header, nil when there is no disposition
+func (options *StoreOptions) ContentDisposition() *string {
+	if options.Disposition == "" {
+		return nil
+	}
+
+	if options.Filename == "" {
+		return aws.String(options.Disposition)
+	}
+
+	return aws.String(mime.FormatMediaType(options.Disposition, map[string]string{"filename": options.Filename}))
+}
+
+func (options *StoreOptions) applyPut(input *s3.PutObjectInput) {
+	input.ACL = optionalString(options.ACL)
+	input.ContentDisposition = options.ContentDisposition()
+	input.ServerSideEncryption = optionalString(options.ServerSideEncryption)
+	input.SSEKMSKeyId = optionalString(options.KMSKeyID)
+
+	if options.KMSKeyID != "" {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+	}
+
+	input.CacheControl = optionalString(options.CacheControl)
+	input.StorageClass = optionalString(options.StorageClass)
+
+	if len(options.Metadata) > 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+}
+
+func override(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return aws.String(value)
+}
+
+func (provider *AWSProvider) storeOptions(options *StoreOptions) *StoreOptions {
+	if provider.Defaults == nil {
+		return DefaultStoreOptions().Merge(options)
+	}
+
+	return provider.Defaults.Merge(options)
+}
@@ -0,0 +1,111 @@
+package files
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/files/testdata/src"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestStoreOptions_Merge(t *testing.T) {
+	defaults := &StoreOptions{
+		ACL:          s3.ObjectCannedACLPrivate,
+		Disposition:  DispositionAttachment,
+		CacheControl: "max-age=60",
+		Metadata:     map[string]string{"owner": "multimedia", "source": "api"},
+	}
+	got := defaults.Merge(&StoreOptions{
+		Disposition: DispositionInline,
+		Filename:    "report.pdf",
+		Metadata:    map[string]string{"source": "admin"},
+	})
+	want := &StoreOptions{
+		ACL:          s3.ObjectCannedACLPrivate,
+		Disposition:  DispositionInline,
+		Filename:     "report.pdf",
+		CacheControl: "max-age=60",
+		Metadata:     map[string]string{"owner": "multimedia", "source": "admin"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() got = %+v, want %+v", got, want)
+	}
+
+	if defaults.Metadata["source"] != "api" {
+		t.Errorf("Merge() must not modify the defaults")
+	}
+}
+
+func TestAWSProvider_StoreStreamOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults *StoreOptions
+		options  *StoreOptions
+		want     *s3.PutObjectInput
+	}{
+		{
+			name: "Uses the public attachment defaults",
+			want: &s3.PutObjectInput{
+				ACL:                  aws.String(s3.ObjectCannedACLPublicRead),
+				ContentDisposition:   aws.String(DispositionAttachment),
+				ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+			},
+		},
+		{
+			name:     "Uses the provider defaults",
+			defaults: &StoreOptions{ACL: s3.ObjectCannedACLPrivate, StorageClass: s3.StorageClassStandardIa},
+			want: &s3.PutObjectInput{
+				ACL:          aws.String(s3.ObjectCannedACLPrivate),
+				StorageClass: aws.String(s3.StorageClassStandardIa),
+			},
+		},
+		{
+			name: "Overrides the defaults per call",
+			options: &StoreOptions{
+				ACL:          s3.ObjectCannedACLPrivate,
+				Disposition:  DispositionInline,
+				Filename:     "cover.png",
+				KMSKeyID:     "key-id",
+				CacheControl: "public, max-age=31536000",
+				Metadata:     map[string]string{"owner": "gallery"},
+			},
+			want: &s3.PutObjectInput{
+				ACL:                  aws.String(s3.ObjectCannedACLPrivate),
+				ContentDisposition:   aws.String("inline; filename=cover.png"),
+				ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+				SSEKMSKeyId:          aws.String("key-id"),
+				CacheControl:         aws.String("public, max-age=31536000"),
+				Metadata:             map[string]*string{"owner": aws.String("gallery")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &src.CountingMockS3{}
+			provider := &AWSProvider{S3: client, Bucket: aws.String("example"), Defaults: tt.defaults}
+
+			if err := provider.StoreStream(strings.NewReader("content"), aws.String("key"), tt.options); err != nil {
+				t.Errorf("StoreStream() error = %v", err)
+				return
+			}
+
+			got := &s3.PutObjectInput{
+				ACL:                  client.Input.ACL,
+				ContentDisposition:   client.Input.ContentDisposition,
+				ServerSideEncryption: client.Input.ServerSideEncryption,
+				SSEKMSKeyId:          client.Input.SSEKMSKeyId,
+				CacheControl:         client.Input.CacheControl,
+				StorageClass:         client.Input.StorageClass,
+				Metadata:             client.Input.Metadata,
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StoreStream() input = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package files
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	postAlgorithm  = "AWS4-HMAC-SHA256"
+	postDateFormat = "20060102T150405Z"
+	postDayFormat  = "20060102"
+)
+
+// PostPolicy are the constraints of an upload made by a browser with a HTML form
+type PostPolicy struct {
+	Key string
+	// ContentType pins the Content-Type field, it is returned with the fields of the form
+	ContentType string
+	// ContentTypePrefix restricts the Content-Type field e.g. "image/"
+	ContentTypePrefix string
+	MinSize           int64
+	MaxSize           int64
+	Expires           time.Duration
+	// Options are merged with the provider defaults, only the ACL and the encryption are used
+	Options *StoreOptions
+}
+
+// PresignedPost is the URL and the form fields a browser must send to upload a file,
+// the file must be the last field of the form
+type PresignedPost struct {
+	URL        string            `json:"url"`
+	Fields     map[string]string `json:"fields"`
+	Expiration time.Time         `json:"expiration"`
+}
+
+type MissingCredentialsError struct {
+	Message string
+}
+
+func (err MissingCredentialsError) Error() string {
+	return err.Message
+}
+
+// PresignPost signs a POST policy that allows browsers to upload a file directly to the bucket
+func (provider *AWSProvider) PresignPost(policy *PostPolicy) (*PresignedPost, error) {
+	if provider.Credentials == nil || provider.Region == "" {
+		return nil, MissingCredentialsError{Message: "Credentials and Region are required to sign a POST policy"}
+	}
+
+	credentials, err := provider.Credentials.Get()
+
+	if err != nil {
+		return nil, err
+	}
+
+	postURL, err := provider.bucketEndpoint()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expiration := now.Add(policy.Expires)
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", now.Format(postDayFormat), provider.Region)
+	options := provider.storeOptions(policy.Options)
+
+	fields := map[string]string{
+		"key":              policy.Key,
+		"x-amz-algorithm":  postAlgorithm,
+		"x-amz-credential": fmt.Sprintf("%v/%v", credentials.AccessKeyID, scope),
+		"x-amz-date":       now.Format(postDateFormat),
+	}
+
+	if options.ACL != "" {
+		fields["acl"] = options.ACL
+	}
+
+	if options.ServerSideEncryption != "" {
+		fields["x-amz-server-side-encryption"] = options.ServerSideEncryption
+	}
+
+	if options.KMSKeyID != "" {
+		fields["x-amz-server-side-encryption"] = s3.ServerSideEncryptionAwsKms
+		fields["x-amz-server-side-encryption-aws-kms-key-id"] = options.KMSKeyID
+	}
+
+	if credentials.SessionToken != "" {
+		fields["x-amz-security-token"] = credentials.SessionToken
+	}
+
+	if policy.ContentType != "" {
+		fields["Content-Type"] = policy.ContentType
+	}
+
+	conditions := []interface{}{map[string]string{"bucket": aws.StringValue(provider.Bucket)}}
+
+	names := make([]string, 0, len(fields))
+
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		conditions = append(conditions, map[string]string{name: fields[name]})
+	}
+
+	if policy.ContentTypePrefix != "" {
+		conditions = append(conditions, []interface{}{"starts-with", "$Content-Type", policy.ContentTypePrefix})
+	}
+
+	if policy.MaxSize > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", policy.MinSize, policy.MaxSize})
+	}
+
+	document, err := json.Marshal(map[string]interface{}{
+		"expiration": expiration.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPolicy := base64.StdEncoding.EncodeToString(document)
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = hex.EncodeToString(
+		hmacSHA256(postSigningKey(credentials.SecretAccessKey, now, provider.Region), encodedPolicy),
+	)
+
+	return &PresignedPost{URL: postURL, Fields: fields, Expiration: expiration}, nil
+}
+
+// bucketEndpoint returns the URL of the bucket the POST forms are sent to
+func (provider *AWSProvider) bucketEndpoint() (string, error) {
+	endpoint := Endpoint{
+		Bucket:    aws.StringValue(provider.Bucket),
+		Region:    provider.Region,
+		URL:       provider.Endpoint,
+		PathStyle: provider.PathStyle,
+	}
+
+	if endpoint.URL == "" {
+		endpoint.URL = "https://s3." + provider.Region + ".amazonaws.com"
+	}
+
+	bucketURL, err := endpoint.BucketURL()
+
+	if err != nil {
+		return "", err
+	}
+
+	return bucketURL + "/", nil
+}
+
+func postSigningKey(secret string, date time.Time, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date.Format(postDayFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, s3.ServiceName)
+
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+
+	return hash.Sum(nil)
+}
@@ -0,0 +1,133 @@
+package files
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/files/testdata/src"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestAWSProvider_PresignPost(t *testing.T) {
+	provider := &AWSProvider{
+		S3:          &src.SuccessMockS3{},
+		Bucket:      aws.String("example"),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", ""),
+		Region:      "us-west-2",
+		Endpoint:    "https://s3.us-west-2.amazonaws.com",
+	}
+	got, err := provider.PresignPost(&PostPolicy{
+		Key:               "uploads/image.png",
+		ContentTypePrefix: "image/",
+		MaxSize:           1024,
+		Expires:           10 * time.Minute,
+		Options:           &StoreOptions{ACL: s3.ObjectCannedACLPrivate},
+	})
+
+	if err != nil {
+		t.Errorf("PresignPost() error = %v", err)
+		return
+	}
+
+	if got.URL != "https://example.s3.us-west-2.amazonaws.com/" {
+		t.Errorf("PresignPost() URL = %v", got.URL)
+	}
+
+	if got.Fields["key"] != "uploads/image.png" || got.Fields["acl"] != s3.ObjectCannedACLPrivate {
+		t.Errorf("PresignPost() fields = %v", got.Fields)
+	}
+
+	if !strings.HasPrefix(got.Fields["x-amz-credential"], "AKIDEXAMPLE/") || !strings.HasSuffix(got.Fields["x-amz-credential"], "/us-west-2/s3/aws4_request") {
+		t.Errorf("PresignPost() credential = %v", got.Fields["x-amz-credential"])
+	}
+
+	document, _ := base64.StdEncoding.DecodeString(got.Fields["policy"])
+	var policy struct {
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+
+	if err = json.Unmarshal(document, &policy); err != nil {
+		t.Errorf("PresignPost() invalid policy = %s", document)
+		return
+	}
+
+	conditions := string(document)
+
+	for _, condition := range []string{`{"bucket":"example"}`, `["starts-with","$Content-Type","image/"]`, `["content-length-range",0,1024]`} {
+		if !strings.Contains(conditions, condition) {
+			t.Errorf("PresignPost() policy %s does not contain %s", document, condition)
+		}
+	}
+
+	date, _ := time.Parse(postDateFormat, got.Fields["x-amz-date"])
+	signature := hex.EncodeToString(hmacSHA256(postSigningKey("SECRET", date, "us-west-2"), got.Fields["policy"]))
+
+	if got.Fields["x-amz-signature"] != signature {
+		t.Errorf("PresignPost() signature = %v, want %v", got.Fields["x-amz-signature"], signature)
+	}
+}
+
+func TestAWSProvider_PresignPostWithKMSKey(t *testing.T) {
+	provider := &AWSProvider{
+		S3:          &src.SuccessMockS3{},
+		Bucket:      aws.String("example"),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", ""),
+		Region:      "us-west-2",
+	}
+	got, err := provider.PresignPost(&PostPolicy{Key: "image.png", Options: &StoreOptions{KMSKeyID: "alias/uploads"}})
+
+	if err != nil {
+		t.Errorf("PresignPost() error = %v", err)
+		return
+	}
+
+	if got.Fields["x-amz-server-side-encryption"] != s3.ServerSideEncryptionAwsKms || got.Fields["x-amz-server-side-encryption-aws-kms-key-id"] != "alias/uploads" {
+		t.Errorf("PresignPost() fields = %v, want the KMS key", got.Fields)
+	}
+
+	document, _ := base64.StdEncoding.DecodeString(got.Fields["policy"])
+
+	if !strings.Contains(string(document), `{"x-amz-server-side-encryption-aws-kms-key-id":"alias/uploads"}`) {
+		t.Errorf("PresignPost() policy %s does not contain the KMS key", document)
+	}
+}
+
+func TestAWSProvider_PresignPostWithContentType(t *testing.T) {
+	provider := &AWSProvider{
+		S3:          &src.SuccessMockS3{},
+		Bucket:      aws.String("example"),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", ""),
+		Region:      "us-west-2",
+	}
+	got, err := provider.PresignPost(&PostPolicy{Key: "image.png", ContentType: "image/png"})
+
+	if err != nil {
+		t.Errorf("PresignPost() error = %v", err)
+		return
+	}
+
+	if got.Fields["Content-Type"] != "image/png" {
+		t.Errorf("PresignPost() fields = %v, want the Content-Type", got.Fields)
+	}
+
+	document, _ := base64.StdEncoding.DecodeString(got.Fields["policy"])
+
+	if !strings.Contains(string(document), `{"Content-Type":"image/png"}`) {
+		t.Errorf("PresignPost() policy %s does not pin the Content-Type", document)
+	}
+}
+
+func TestAWSProvider_PresignPostWithoutCredentials(t *testing.T) {
+	provider := &AWSProvider{S3: &src.SuccessMockS3{}, Bucket: aws.String("example")}
+
+	if _, err := provider.PresignPost(&PostPolicy{Key: "key"}); err == nil {
+		t.Errorf("PresignPost() expects an error without credentials")
+	}
+}
@@ -0,0 +1,42 @@
+package files
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// PresignGet returns a time-limited URL to download an object, a non empty disposition overrides
+// the Content-Disposition of the response e.g. "attachment; filename=report.pdf"
+func (provider *AWSProvider) PresignGet(path *string, expires time.Duration, disposition string) (string, error) {
+	request, _ := provider.S3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:                     provider.Bucket,
+		Key:                        path,
+		ResponseContentDisposition: optionalString(disposition),
+	})
+
+	return request.Presign(expires)
+}
+
+// PresignPut returns a time-limited URL that browsers can use to upload an object directly to S3,
+// the returned headers are signed and must be sent with the upload request
+func (provider *AWSProvider) PresignPut(path *string, expires time.Duration, contentType string, options *StoreOptions) (string, http.Header, error) {
+	input := &s3.PutObjectInput{
+		Bucket:      provider.Bucket,
+		Key:         path,
+		ContentType: aws.String(contentType),
+	}
+	provider.storeOptions(options).applyPut(input)
+
+	request, _ := provider.S3.PutObjectRequest(input)
+
+	return request.PresignRequest(expires)
+}
+
+// AttachmentDisposition returns a Content-Disposition value that downloads the object with the given filename
+func AttachmentDisposition(filename string) string {
+	return mime.FormatMediaType(DispositionAttachment, map[string]string{"filename": filename})
+}
@@ -0,0 +1,65 @@
+package files
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/files/testdata/src"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestAWSProvider_PresignGet(t *testing.T) {
+	provider := &AWSProvider{S3: &src.SuccessMockS3{}, Bucket: aws.String("example")}
+	got, err := provider.PresignGet(aws.String("private/report.pdf"), 15*time.Minute, AttachmentDisposition("report.pdf"))
+
+	if err != nil {
+		t.Errorf("PresignGet() error = %v", err)
+		return
+	}
+
+	signed, err := url.Parse(got)
+
+	if err != nil {
+		t.Errorf("PresignGet() returned an invalid URL %v", got)
+		return
+	}
+
+	query := signed.Query()
+
+	if signed.Path != "/example/private/report.pdf" && signed.Path != "/private/report.pdf" {
+		t.Errorf("PresignGet() path = %v", signed.Path)
+	}
+
+	if query.Get("X-Amz-Expires") != "900" || query.Get("X-Amz-Signature") == "" {
+		t.Errorf("PresignGet() query = %v, want a signature that expires in 900 seconds", query)
+	}
+
+	if query.Get("response-content-disposition") != "attachment; filename=report.pdf" {
+		t.Errorf("PresignGet() disposition = %v", query.Get("response-content-disposition"))
+	}
+}
+
+func TestAWSProvider_PresignPut(t *testing.T) {
+	provider := &AWSProvider{S3: &src.SuccessMockS3{}, Bucket: aws.String("example")}
+	got, headers, err := provider.PresignPut(aws.String("upload.png"), time.Hour, "image/png", &StoreOptions{ACL: s3.ObjectCannedACLPrivate})
+
+	if err != nil {
+		t.Errorf("PresignPut() error = %v", err)
+		return
+	}
+
+	signed, _ := url.Parse(got)
+
+	if signed.Query().Get("X-Amz-Expires") != "3600" {
+		t.Errorf("PresignPut() query = %v, want a signature that expires in 3600 seconds", signed.Query())
+	}
+
+	// the signed headers keep the lower case names used by the signature
+	if !reflect.DeepEqual(headers["content-type"], []string{"image/png"}) || !reflect.DeepEqual(headers["x-amz-acl"], []string{s3.ObjectCannedACLPrivate}) {
+		t.Errorf("PresignPut() headers = %v, want the content type and the ACL signed", headers)
+	}
+}
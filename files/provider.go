@@ -1,12 +1,15 @@
 package files
 
 import (
-	"bytes"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -14,14 +17,64 @@ type S3Client interface {
 	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
 	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
 	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	CreateMultipartUpload(*s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(*s3.UploadPartInput) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(*s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(*s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error)
+	ListParts(*s3.ListPartsInput) (*s3.ListPartsOutput, error)
+	GetObjectRequest(*s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
+	PutObjectRequest(*s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput)
+	HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
 }
 
 type Provider interface {
 	Store(currentPath *string, newPath *string) error
+	// StoreStream stores the content of the reader, nil options use the provider defaults
+	StoreStream(reader io.Reader, newPath *string, options *StoreOptions) error
 	Read(path *string) ([]byte, error)
+	ReadStream(path *string) (io.ReadCloser, *ObjectInfo, error)
+	ReadRange(path *string, byteRange string) (io.ReadCloser, *ObjectInfo, error)
 	Remove(filename *string) error
 }
 
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	ContentType string
+	// ContentLength is the amount of bytes of the body, -1 when it is unknown
+	ContentLength int64
+	// ContentRange is the Content-Range header of ranged reads
+	ContentRange string
+	ETag         string
+}
+
+// IsNotFound reports if the error was returned because an object does not exist
+func IsNotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound"
+	}
+
+	return os.IsNotExist(err)
+}
+
+// IsForbidden reports if the error was returned because the credentials can not access an object, S3 returns it
+// for the objects that do not exist as well when the credentials can not list the bucket
+func IsForbidden(err error) bool {
+	if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == http.StatusForbidden {
+		return true
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == "AccessDenied" || awsErr.Code() == "Forbidden"
+	}
+
+	return os.IsPermission(err)
+}
+
+// Stater is implemented by the providers that read the information of an object without its content
+type Stater interface {
+	Stat(path *string) (*ObjectInfo, error)
+}
+
 type FileOpener interface {
 	Open(string) (*os.File, error)
 }
@@ -30,14 +83,31 @@ type AWSProvider struct {
 	S3     S3Client
 	Opener FileOpener
 	Bucket *string
+	// PartSize is the size of the multipart upload parts, objects up to this size are stored with a single request
+	PartSize int64
+	// Concurrency is the amount of parts uploaded at the same time
+	Concurrency int
+	Checkpoints UploadCheckpoint
+	// Defaults are the options used when a store call does not set them, DefaultStoreOptions when nil
+	Defaults *StoreOptions
+	// Credentials, Region and Endpoint are used to sign POST policies
+	Credentials *credentials.Credentials
+	Region      string
+	Endpoint    string
+	// PathStyle addresses the bucket as Endpoint/bucket, it must match the S3ForcePathStyle of the client
+	PathStyle bool
 }
 
 // NewProvider return a new AWSProvider
 func NewAWSProvider(bucket *string, s3 *s3.S3) *AWSProvider {
 	return &AWSProvider{
-		S3:     s3,
-		Opener: &OSFileOpener{},
-		Bucket: bucket,
+		S3:          s3,
+		Opener:      &OSFileOpener{},
+		Bucket:      bucket,
+		Credentials: s3.Config.Credentials,
+		Region:      aws.StringValue(s3.Config.Region),
+		Endpoint:    s3.Endpoint,
+		PathStyle:   aws.BoolValue(s3.Config.S3ForcePathStyle),
 	}
 }
 
@@ -47,7 +117,10 @@ func (opener *OSFileOpener) Open(filename string) (*os.File, error) {
 	return os.Open(filename)
 }
 
-// Store put an object in the given S3 Bucket
+// sniffLength is the amount of bytes used to detect the content type
+const sniffLength = 512
+
+// Store put an object in the given S3 Bucket streaming it from the local file
 func (provider *AWSProvider) Store(filename *string, destination *string) error {
 	file, err := provider.Opener.Open(*filename)
 
@@ -57,38 +130,161 @@ func (provider *AWSProvider) Store(filename *string, destination *string) error
 
 	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	return provider.StoreStream(file, destination, nil)
+}
+
+// StoreStream put an object in the given S3 Bucket reading it from the given reader, objects bigger
+// than the part size use a multipart upload and readers that can not seek are spooled to a temporary file
+func (provider *AWSProvider) StoreStream(reader io.Reader, destination *string, options *StoreOptions) error {
+	source, ok := reader.(readSeekerAt)
+
+	if !ok {
+		spool, err := ioutil.TempFile(os.TempDir(), "stream-*")
+
+		if err != nil {
+			return err
+		}
+
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if _, err = io.Copy(spool, reader); err != nil {
+			return err
+		}
+
+		if _, err = spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		source = spool
+	}
+
+	offset, err := source.Seek(0, io.SeekCurrent)
 
 	if err != nil {
 		return err
 	}
 
-	var size = fileInfo.Size()
-	buffer := make([]byte, size)
-	_, err = file.Read(buffer)
+	size, err := remainingSize(source)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = provider.S3.PutObject(&s3.PutObjectInput{
+	body := io.NewSectionReader(source, offset, size)
+	contentType, err := sniffContentType(body)
+
+	if err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
 		Bucket:        provider.Bucket,
 		Key:           destination,
-		Body:          bytes.NewReader(buffer),
+		Body:          body,
 		ContentLength: aws.Int64(size),
-		ContentType:   aws.String(http.DetectContentType(buffer)),
-		// TODO This parameters must be dynamic, maybe permissions
-		ACL:                  aws.String("public-read"),
-		ContentDisposition:   aws.String("attachment"),
-		ServerSideEncryption: aws.String("AES256"),
-	})
+		ContentType:   aws.String(contentType),
+	}
+	provider.storeOptions(options).applyPut(input)
+
+	if size > provider.partSize() {
+		return provider.storeMultipart(body, input)
+	}
+
+	_, err = provider.S3.PutObject(input)
 
 	return err
 }
 
-// Read reads an element from aws
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// remainingSize returns the amount of bytes between the current offset and the end of the reader
+func remainingSize(reader io.Seeker) (int64, error) {
+	current, err := reader.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := reader.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = reader.Seek(current, io.SeekStart)
+
+	return end - current, err
+}
+
+// sniffContentType detects the content type from the first bytes and rewinds the reader
+func sniffContentType(reader io.ReadSeeker) (string, error) {
+	current, err := reader.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return "", err
+	}
+
+	header := make([]byte, sniffLength)
+	read, err := io.ReadFull(reader, header)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	if _, err = reader.Seek(current, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return http.DetectContentType(header[:read]), nil
+}
+
+// Read reads a whole element from aws
 func (provider *AWSProvider) Read(path *string) ([]byte, error) {
-	output, err := provider.S3.GetObject(&s3.GetObjectInput{
+	body, info, err := provider.ReadStream(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer body.Close()
+
+	if info.ContentLength < 0 {
+		return ioutil.ReadAll(body)
+	}
+
+	buffer := make([]byte, info.ContentLength)
+
+	if _, err = io.ReadFull(body, buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer, nil
+}
+
+// ReadStream returns the body of an element from aws, the caller must close it
+func (provider *AWSProvider) ReadStream(path *string) (io.ReadCloser, *ObjectInfo, error) {
+	return provider.getObject(&s3.GetObjectInput{
+		Bucket: provider.Bucket,
+		Key:    path,
+	})
+}
+
+// ReadRange returns a part of an element from aws, byteRange uses the HTTP Range header format e.g. "bytes=0-1023"
+func (provider *AWSProvider) ReadRange(path *string, byteRange string) (io.ReadCloser, *ObjectInfo, error) {
+	return provider.getObject(&s3.GetObjectInput{
+		Bucket: provider.Bucket,
+		Key:    path,
+		Range:  aws.String(byteRange),
+	})
+}
+
+// Stat returns the information of an object without reading its content
+func (provider *AWSProvider) Stat(path *string) (*ObjectInfo, error) {
+	output, err := provider.S3.HeadObject(&s3.HeadObjectInput{
 		Bucket: provider.Bucket,
 		Key:    path,
 	})
@@ -97,16 +293,32 @@ func (provider *AWSProvider) Read(path *string) ([]byte, error) {
 		return nil, err
 	}
 
-	buffer := make([]byte, *output.ContentLength)
-	_, err = output.Body.Read(buffer)
+	return &ObjectInfo{
+		ContentType:   aws.StringValue(output.ContentType),
+		ContentLength: aws.Int64Value(output.ContentLength),
+		ETag:          aws.StringValue(output.ETag),
+	}, nil
+}
 
-	if err == io.EOF || err == nil {
-		return buffer, nil
+func (provider *AWSProvider) getObject(input *s3.GetObjectInput) (io.ReadCloser, *ObjectInfo, error) {
+	output, err := provider.S3.GetObject(input)
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	buffer = nil
+	info := &ObjectInfo{
+		ContentType:   aws.StringValue(output.ContentType),
+		ContentLength: -1,
+		ContentRange:  aws.StringValue(output.ContentRange),
+		ETag:          aws.StringValue(output.ETag),
+	}
+
+	if output.ContentLength != nil {
+		info.ContentLength = *output.ContentLength
+	}
 
-	return buffer, err
+	return output.Body, info, nil
 }
 
 func (provider *AWSProvider) Remove(filename *string) error {
@@ -1,11 +1,18 @@
 package files
 
 import (
-	"multimedia/pkg/files/testdata/src"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"runtime"
 	"testing"
 
+	"github.com/alejo-lapix/multimedia-go/files/testdata/src"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
 func TestAwsProvider_Read(t *testing.T) {
@@ -93,6 +100,18 @@ func TestAwsProvider_Store(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Streams an existing file",
+			fields: fields{
+				S3:     &src.CountingMockS3{},
+				Bucket: aws.String("Example"),
+			},
+			args: args{
+				currentPath: &filenameToStore,
+				newPath:     aws.String("provider_integration_test.go"),
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -109,3 +128,152 @@ func TestAwsProvider_Store(t *testing.T) {
 		})
 	}
 }
+
+// syntheticReader produces size bytes without holding them in memory, it does not implement io.Seeker
+type syntheticReader struct {
+	header    []byte
+	remaining int64
+	read      int64
+}
+
+func (reader *syntheticReader) Read(p []byte) (int, error) {
+	if reader.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > reader.remaining {
+		p = p[:reader.remaining]
+	}
+
+	for index := range p {
+		if position := reader.read + int64(index); position < int64(len(reader.header)) {
+			p[index] = reader.header[position]
+		} else {
+			p[index] = byte(position)
+		}
+	}
+
+	reader.read += int64(len(p))
+	reader.remaining -= int64(len(p))
+
+	return len(p), nil
+}
+
+func TestAwsProvider_StoreStream(t *testing.T) {
+	const size = 64 << 20
+	const memoryBudget = 8 << 20
+
+	client := &src.CountingMockS3{}
+	provider := &AWSProvider{S3: client, Bucket: aws.String("example")}
+	reader := &syntheticReader{header: []byte("%PDF-1.7\n"), remaining: size}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	err := provider.StoreStream(reader, aws.String("large.pdf"), nil)
+
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Errorf("StoreStream() error = %v", err)
+		return
+	}
+
+	if client.Bytes != size {
+		t.Errorf("StoreStream() stored %v bytes, want %v", client.Bytes, size)
+	}
+
+	if client.ContentType != "application/pdf" {
+		t.Errorf("StoreStream() content type = %v, want application/pdf", client.ContentType)
+	}
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > memoryBudget {
+		t.Errorf("StoreStream() allocated %v bytes, budget %v", allocated, memoryBudget)
+	}
+}
+
+func TestAwsProvider_ReadChunkedBody(t *testing.T) {
+	content := []byte("an object that is returned one byte at a time")
+	provider := &AWSProvider{S3: &src.ContentMockS3{Content: content}, Bucket: aws.String("example")}
+
+	got, err := provider.Read(aws.String("object"))
+
+	if err != nil {
+		t.Errorf("Read() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, content) {
+		t.Errorf("Read() got = %s, want %s", got, content)
+	}
+}
+
+func TestAwsProvider_ReadStream(t *testing.T) {
+	content := []byte("0123456789")
+	provider := &AWSProvider{S3: &src.ContentMockS3{Content: content}, Bucket: aws.String("example")}
+	tests := []struct {
+		name      string
+		byteRange string
+		want      string
+		wantInfo  ObjectInfo
+	}{
+		{
+			name:     "Reads the whole object",
+			want:     "0123456789",
+			wantInfo: ObjectInfo{ContentType: "audio/mpeg", ContentLength: 10, ETag: "\"etag\""},
+		},
+		{
+			name:      "Reads a range of the object",
+			byteRange: "bytes=2-5",
+			want:      "2345",
+			wantInfo:  ObjectInfo{ContentType: "audio/mpeg", ContentLength: 4, ContentRange: "bytes 2-5/10", ETag: "\"etag\""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.ReadCloser
+			var info *ObjectInfo
+			var err error
+
+			if tt.byteRange == "" {
+				body, info, err = provider.ReadStream(aws.String("object"))
+			} else {
+				body, info, err = provider.ReadRange(aws.String("object"), tt.byteRange)
+			}
+
+			if err != nil {
+				t.Errorf("ReadStream() error = %v", err)
+				return
+			}
+
+			defer body.Close()
+			got, _ := ioutil.ReadAll(body)
+
+			if string(got) != tt.want || !reflect.DeepEqual(*info, tt.wantInfo) {
+				t.Errorf("ReadStream() got = %s %+v, want %s %+v", got, *info, tt.want, tt.wantInfo)
+			}
+		})
+	}
+}
+
+func TestIsForbidden(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "S3 HEAD without permissions", err: awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), 403, "id"), want: true},
+		{name: "S3 access denied", err: awserr.New("AccessDenied", "Access Denied", nil), want: true},
+		{name: "S3 not found", err: awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "id"), want: false},
+		{name: "Local permissions", err: &os.PathError{Op: "open", Path: "file", Err: os.ErrPermission}, want: true},
+		{name: "Other errors", err: errors.New("timeout"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsForbidden(tt.err); got != tt.want {
+				t.Errorf("IsForbidden() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
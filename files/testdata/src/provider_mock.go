@@ -1,9 +1,21 @@
 package src
 
 import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing/iotest"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -25,8 +37,26 @@ func (error ClientError) Error() string {
 	return error.Message
 }
 
+// offlineS3 is only used to build and presign requests, it never sends them
+var offlineS3 = s3.New(session.Must(session.NewSession(&aws.Config{
+	Region:      aws.String("us-east-1"),
+	Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", ""),
+})))
+
 type SuccessMockS3 struct{}
 
+func (c *SuccessMockS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(5), ContentType: aws.String("text/plain")}, nil
+}
+
+func (c *SuccessMockS3) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	return offlineS3.GetObjectRequest(input)
+}
+
+func (c *SuccessMockS3) PutObjectRequest(input *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	return offlineS3.PutObjectRequest(input)
+}
+
 func (c *SuccessMockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 	return &s3.PutObjectOutput{}, nil
 }
@@ -38,12 +68,334 @@ func (c *SuccessMockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput
 	}, nil
 }
 
+// ContentMockS3 serves Content from GetObject honoring the Range parameter
+type ContentMockS3 struct {
+	SuccessMockS3
+	Content []byte
+}
+
+func (c *ContentMockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	output := &s3.GetObjectOutput{
+		ContentType: aws.String("audio/mpeg"),
+		ETag:        aws.String("\"etag\""),
+	}
+	start, end := int64(0), int64(len(c.Content)-1)
+
+	if input.Range != nil {
+		if _, err := fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, ClientError{Message: "Invalid Range"}
+		}
+
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %v-%v/%v", start, end, len(c.Content)))
+	}
+
+	// the body is returned in small chunks like a network stream would do
+	output.Body = ioutil.NopCloser(iotest.OneByteReader(bytes.NewReader(c.Content[start : end+1])))
+	output.ContentLength = aws.Int64(end - start + 1)
+
+	return output, nil
+}
+
+func (c *ContentMockS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(c.Content))),
+		ContentType:   aws.String("audio/mpeg"),
+		ETag:          aws.String("\"etag\""),
+	}, nil
+}
+
 func (c *SuccessMockS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
 	return &s3.DeleteObjectOutput{}, nil
 }
 
+func (c *SuccessMockS3) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (c *SuccessMockS3) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%v", *input.PartNumber))}, nil
+}
+
+func (c *SuccessMockS3) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *SuccessMockS3) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (c *SuccessMockS3) ListParts(input *s3.ListPartsInput) (*s3.ListPartsOutput, error) {
+	return &s3.ListPartsOutput{}, nil
+}
+
+// CountingMockS3 consumes the body of the stored objects keeping only its size
+type CountingMockS3 struct {
+	SuccessMockS3
+	Bytes       int64
+	ContentType string
+	Input       *s3.PutObjectInput
+}
+
+func (c *CountingMockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	read, err := io.Copy(ioutil.Discard, input.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&c.Bytes, read)
+	c.ContentType = aws.StringValue(input.ContentType)
+	c.Input = input
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *CountingMockS3) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	c.ContentType = aws.StringValue(input.ContentType)
+
+	return c.SuccessMockS3.CreateMultipartUpload(input)
+}
+
+func (c *CountingMockS3) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	read, err := io.Copy(ioutil.Discard, input.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&c.Bytes, read)
+
+	return c.SuccessMockS3.UploadPart(input)
+}
+
+// partETag is the quoted MD5 returned by S3 for the parts without SSE-KMS
+func partETag(content []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(content)))
+}
+
+// MultipartMockS3 keeps the uploaded parts in memory, FailPart makes the upload of that part number fail
+type MultipartMockS3 struct {
+	SuccessMockS3
+	FailPart  int64
+	Uploads   map[string]map[int64][]byte
+	Objects   map[string][]byte
+	Aborted   []string
+	Uploaded  []int64
+	PageSize  int
+	mutex     sync.Mutex
+	uploadIDs int
+}
+
+func (c *MultipartMockS3) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.uploadIDs++
+	uploadID := fmt.Sprintf("upload-%v", c.uploadIDs)
+
+	if c.Uploads == nil {
+		c.Uploads = make(map[string]map[int64][]byte)
+	}
+
+	c.Uploads[uploadID] = make(map[int64][]byte)
+
+	return &s3.CreateMultipartUploadOutput{UploadId: &uploadID}, nil
+}
+
+func (c *MultipartMockS3) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	content, err := ioutil.ReadAll(input.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if *input.PartNumber == c.FailPart {
+		return nil, ClientError{Message: "Upload Part Error"}
+	}
+
+	parts, ok := c.Uploads[*input.UploadId]
+
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "The upload does not exists", nil)
+	}
+
+	parts[*input.PartNumber] = content
+	c.Uploaded = append(c.Uploaded, *input.PartNumber)
+
+	return &s3.UploadPartOutput{ETag: aws.String(partETag(content))}, nil
+}
+
+func (c *MultipartMockS3) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	parts, ok := c.Uploads[*input.UploadId]
+
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "The upload does not exists", nil)
+	}
+
+	var content []byte
+
+	for index, part := range input.MultipartUpload.Parts {
+		if *part.PartNumber != int64(index+1) {
+			return nil, ClientError{Message: "Parts must be consecutive and sorted"}
+		}
+
+		content = append(content, parts[*part.PartNumber]...)
+	}
+
+	if c.Objects == nil {
+		c.Objects = make(map[string][]byte)
+	}
+
+	c.Objects[*input.Key] = content
+	delete(c.Uploads, *input.UploadId)
+
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *MultipartMockS3) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Aborted = append(c.Aborted, *input.UploadId)
+	delete(c.Uploads, *input.UploadId)
+
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (c *MultipartMockS3) ListParts(input *s3.ListPartsInput) (*s3.ListPartsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	parts, ok := c.Uploads[*input.UploadId]
+
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchUpload, "The upload does not exists", nil)
+	}
+
+	output := &s3.ListPartsOutput{IsTruncated: aws.Bool(false)}
+	numbers := make([]int64, 0, len(parts))
+
+	for number := range parts {
+		if number > aws.Int64Value(input.PartNumberMarker) {
+			numbers = append(numbers, number)
+		}
+	}
+
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	if c.PageSize > 0 && len(numbers) > c.PageSize {
+		numbers = numbers[:c.PageSize]
+		output.IsTruncated = aws.Bool(true)
+		output.NextPartNumberMarker = aws.Int64(numbers[len(numbers)-1])
+	}
+
+	for _, number := range numbers {
+		output.Parts = append(output.Parts, &s3.Part{
+			PartNumber: aws.Int64(number),
+			ETag:       aws.String(partETag(parts[number])),
+			Size:       aws.Int64(int64(len(parts[number]))),
+		})
+	}
+
+	return output, nil
+}
+
+// MemoryMockS3 keeps the objects in memory like a real bucket would do
+type MemoryMockS3 struct {
+	MultipartMockS3
+}
+
+func (c *MemoryMockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	content, err := ioutil.ReadAll(input.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Objects == nil {
+		c.Objects = make(map[string][]byte)
+	}
+
+	c.Objects[*input.Key] = content
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *MemoryMockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	c.mutex.Lock()
+	content, ok := c.Objects[*input.Key]
+	c.mutex.Unlock()
+
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+
+	output := &s3.GetObjectOutput{ETag: aws.String(fmt.Sprintf("\"%x\"", len(content)))}
+	start, end := int64(0), int64(len(content)-1)
+
+	if input.Range != nil {
+		if _, err := fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end); err != nil || start > end || start >= int64(len(content)) {
+			return nil, awserr.New("InvalidRange", "The requested range is not satisfiable", nil)
+		}
+
+		if end >= int64(len(content)) {
+			end = int64(len(content)) - 1
+		}
+
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %v-%v/%v", start, end, len(content)))
+	}
+
+	output.Body = ioutil.NopCloser(bytes.NewReader(content[start : end+1]))
+	output.ContentLength = aws.Int64(end - start + 1)
+
+	return output, nil
+}
+
+func (c *MemoryMockS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	content, ok := c.Objects[*input.Key]
+
+	if !ok {
+		return nil, awserr.New("NotFound", "Not Found", nil)
+	}
+
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(content)))}, nil
+}
+
+func (c *MemoryMockS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.Objects, *input.Key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
 type FailMockS3 struct{}
 
+func (c *FailMockS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return nil, awserr.New("NotFound", "Not Found", nil)
+}
+
+func (c *FailMockS3) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	return offlineS3.GetObjectRequest(input)
+}
+
+func (c *FailMockS3) PutObjectRequest(input *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+	return offlineS3.PutObjectRequest(input)
+}
+
 func (c FailMockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 	return &s3.PutObjectOutput{}, ClientError{Message: "Put Object Error"}
 }
@@ -55,3 +407,23 @@ func (c *FailMockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, e
 func (c *FailMockS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
 	return nil, ClientError{Message: "Delete Object Error"}
 }
+
+func (c *FailMockS3) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, ClientError{Message: "Create Multipart Upload Error"}
+}
+
+func (c *FailMockS3) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return nil, ClientError{Message: "Upload Part Error"}
+}
+
+func (c *FailMockS3) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, ClientError{Message: "Complete Multipart Upload Error"}
+}
+
+func (c *FailMockS3) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, ClientError{Message: "Abort Multipart Upload Error"}
+}
+
+func (c *FailMockS3) ListParts(input *s3.ListPartsInput) (*s3.ListPartsOutput, error) {
+	return nil, ClientError{Message: "List Parts Error"}
+}
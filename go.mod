@@ -9,6 +9,8 @@ require (
 	github.com/go-playground/universal-translator v0.16.0 // indirect
 	github.com/google/uuid v1.1.1
 	github.com/leodido/go-urn v1.1.0 // indirect
+	github.com/lib/pq v1.2.0
+	github.com/mattn/go-sqlite3 v1.11.0
 	golang.org/x/net v0.0.0-20190813141303-74dc4d7220e7 // indirect
 	gopkg.in/go-playground/validator.v9 v9.29.1
 )
@@ -0,0 +1,115 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sync"
+
+	// registers the GIF decoder for image.Decode
+	_ "image/gif"
+)
+
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+)
+
+// Encoder writes an image in a format
+type Encoder interface {
+	Encode(writer io.Writer, img image.Image) error
+	ContentType() string
+	// Extension includes the leading dot e.g. ".jpg"
+	Extension() string
+}
+
+type JPEGEncoder struct {
+	// Quality goes from 1 to 100, jpeg.DefaultQuality when zero
+	Quality int
+}
+
+// Encode writes the image composited onto white, JPEG does not have transparency
+func (encoder JPEGEncoder) Encode(writer io.Writer, img image.Image) error {
+	quality := encoder.Quality
+
+	if quality <= 0 {
+		quality = jpeg.DefaultQuality
+	}
+
+	return jpeg.Encode(writer, flatten(img), &jpeg.Options{Quality: quality})
+}
+
+// flatten composites an image with transparency onto a white background, the opaque images are returned
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	flattened := image.NewRGBA(bounds)
+	draw.Draw(flattened, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, bounds, img, bounds.Min, draw.Over)
+
+	return flattened
+}
+
+func (encoder JPEGEncoder) ContentType() string {
+	return "image/jpeg"
+}
+
+func (encoder JPEGEncoder) Extension() string {
+	return ".jpg"
+}
+
+type PNGEncoder struct{}
+
+func (encoder PNGEncoder) Encode(writer io.Writer, img image.Image) error {
+	return png.Encode(writer, img)
+}
+
+func (encoder PNGEncoder) ContentType() string {
+	return "image/png"
+}
+
+func (encoder PNGEncoder) Extension() string {
+	return ".png"
+}
+
+// UnsupportedFormatError is returned when a format does not have an encoder
+type UnsupportedFormatError struct {
+	Format string
+}
+
+func (err UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("There is no encoder for the %v format", err.Format)
+}
+
+var (
+	encodersMutex sync.RWMutex
+	encoders      = map[string]Encoder{JPEG: JPEGEncoder{}, PNG: PNGEncoder{}}
+)
+
+// RegisterEncoder adds or replaces the encoder of a format
+func RegisterEncoder(format string, encoder Encoder) {
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+
+	encoders[format] = encoder
+}
+
+// EncoderFor returns the encoder registered for the format
+func EncoderFor(format string) (Encoder, error) {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+
+	encoder, ok := encoders[format]
+
+	if !ok {
+		return nil, UnsupportedFormatError{Format: format}
+	}
+
+	return encoder, nil
+}
@@ -0,0 +1,53 @@
+package imaging
+
+import "image"
+
+// Orient applies an EXIF orientation so the image is displayed upright, orientations 5 to 8 swap the
+// width and the height and the invalid orientations return the image unchanged
+func Orient(source image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return source
+	}
+
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	src := ToRGBA(source)
+
+	dstWidth, dstHeight := width, height
+
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			srcX, srcY := orientedPoint(orientation, x, y, width, height)
+			srcOffset := src.PixOffset(srcX, srcY)
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[srcOffset:srcOffset+4])
+		}
+	}
+
+	return dst
+}
+
+// orientedPoint returns the source pixel of a destination pixel, width and height are the ones of the source
+func orientedPoint(orientation, x, y, width, height int) (int, int) {
+	switch orientation {
+	case 2:
+		return width - 1 - x, y
+	case 3:
+		return width - 1 - x, height - 1 - y
+	case 4:
+		return x, height - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, height - 1 - x
+	case 7:
+		return width - 1 - y, height - 1 - x
+	}
+
+	return width - 1 - y, x
+}
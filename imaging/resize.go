@@ -0,0 +1,96 @@
+// Package imaging resizes and encodes images using only the standard library
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit returns the largest size within the bounds that keeps the aspect ratio, a zero bound does not
+// limit its dimension and images are never enlarged
+func Fit(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+
+	return atLeastOne(float64(width) * scale), atLeastOne(float64(height) * scale)
+}
+
+func atLeastOne(value float64) int {
+	if rounded := int(value + 0.5); rounded > 0 {
+		return rounded
+	}
+
+	return 1
+}
+
+// ToRGBA returns the image as RGBA with its origin at zero, the images that already are are not copied.
+// Converting once is cheaper when an image is resized several times
+func ToRGBA(source image.Image) *image.RGBA {
+	bounds := source.Bounds()
+
+	if rgba, ok := source.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), source, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// Resize scales the image to the given size, every destination pixel is the average of the source
+// pixels it covers so it is meant for downscaling. The source is converted by ToRGBA
+func Resize(source image.Image, width, height int) *image.RGBA {
+	src := ToRGBA(source)
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	destination := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		top, bottom := span(y, height, srcHeight)
+
+		for x := 0; x < width; x++ {
+			left, right := span(x, width, srcWidth)
+			var r, g, b, a, count uint64
+
+			for sy := top; sy < bottom; sy++ {
+				offset := src.PixOffset(left, sy)
+
+				for sx := left; sx < right; sx++ {
+					r += uint64(src.Pix[offset])
+					g += uint64(src.Pix[offset+1])
+					b += uint64(src.Pix[offset+2])
+					a += uint64(src.Pix[offset+3])
+					count++
+					offset += 4
+				}
+			}
+
+			offset := destination.PixOffset(x, y)
+			destination.Pix[offset] = uint8(r / count)
+			destination.Pix[offset+1] = uint8(g / count)
+			destination.Pix[offset+2] = uint8(b / count)
+			destination.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return destination
+}
+
+// span returns the source pixels covered by a destination pixel, it covers at least one pixel
+func span(position, size, sourceSize int) (int, int) {
+	start := position * sourceSize / size
+	end := (position + 1) * sourceSize / size
+
+	if end <= start {
+		end = start + 1
+	}
+
+	return start, end
+}
@@ -0,0 +1,187 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		maxWidth   int
+		maxHeight  int
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "landscape", width: 1600, height: 900, maxWidth: 800, maxHeight: 800, wantWidth: 800, wantHeight: 450},
+		{name: "portrait", width: 900, height: 1600, maxWidth: 200, maxHeight: 200, wantWidth: 113, wantHeight: 200},
+		{name: "smaller", width: 100, height: 50, maxWidth: 200, maxHeight: 200, wantWidth: 100, wantHeight: 50},
+		{name: "only width", width: 1000, height: 3000, maxWidth: 100, wantWidth: 100, wantHeight: 300},
+		{name: "only height", width: 3000, height: 1000, maxHeight: 100, wantWidth: 300, wantHeight: 100},
+		{name: "thin", width: 5000, height: 2, maxWidth: 100, maxHeight: 100, wantWidth: 100, wantHeight: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height := Fit(tt.width, tt.height, tt.maxWidth, tt.maxHeight)
+
+			if width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("Fit() got = %vx%v, want %vx%v", width, height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestResize(t *testing.T) {
+	source := image.NewNRGBA(image.Rect(10, 10, 50, 30))
+	draw.Draw(source, image.Rect(10, 10, 30, 30), &image.Uniform{C: color.NRGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(source, image.Rect(30, 10, 50, 30), &image.Uniform{C: color.NRGBA{B: 255, A: 255}}, image.Point{}, draw.Src)
+
+	got := Resize(source, 4, 2)
+
+	if got.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("Resize() bounds = %v, want 4x2", got.Bounds())
+	}
+
+	if left, right := got.RGBAAt(0, 0), got.RGBAAt(3, 1); left != (color.RGBA{R: 255, A: 255}) || right != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("Resize() must keep the colors of each half, got %v and %v", left, right)
+	}
+
+	if bigger := Resize(image.NewRGBA(image.Rect(0, 0, 2, 2)), 4, 4); bigger.Bounds().Dx() != 4 {
+		t.Errorf("Resize() bounds = %v, want 4x4", bigger.Bounds())
+	}
+}
+
+func TestOrient(t *testing.T) {
+	source := image.NewNRGBA(image.Rect(5, 5, 8, 7))
+	draw.Draw(source, source.Bounds(), &image.Uniform{C: color.NRGBA{B: 255, A: 255}}, image.Point{}, draw.Src)
+	source.Set(5, 5, color.NRGBA{R: 255, A: 255})
+
+	tests := []struct {
+		orientation int
+		wantBounds  image.Rectangle
+		wantRed     image.Point
+	}{
+		{orientation: 0, wantBounds: source.Bounds(), wantRed: image.Pt(5, 5)},
+		{orientation: 1, wantBounds: source.Bounds(), wantRed: image.Pt(5, 5)},
+		{orientation: 2, wantBounds: image.Rect(0, 0, 3, 2), wantRed: image.Pt(2, 0)},
+		{orientation: 3, wantBounds: image.Rect(0, 0, 3, 2), wantRed: image.Pt(2, 1)},
+		{orientation: 4, wantBounds: image.Rect(0, 0, 3, 2), wantRed: image.Pt(0, 1)},
+		{orientation: 5, wantBounds: image.Rect(0, 0, 2, 3), wantRed: image.Pt(0, 0)},
+		{orientation: 6, wantBounds: image.Rect(0, 0, 2, 3), wantRed: image.Pt(1, 0)},
+		{orientation: 7, wantBounds: image.Rect(0, 0, 2, 3), wantRed: image.Pt(1, 2)},
+		{orientation: 8, wantBounds: image.Rect(0, 0, 2, 3), wantRed: image.Pt(0, 2)},
+	}
+
+	for _, tt := range tests {
+		got := Orient(source, tt.orientation)
+
+		if got.Bounds() != tt.wantBounds {
+			t.Errorf("Orient(%v) bounds = %v, want %v", tt.orientation, got.Bounds(), tt.wantBounds)
+			continue
+		}
+
+		if red, _, _, _ := got.At(tt.wantRed.X, tt.wantRed.Y).RGBA(); red != 0xFFFF {
+			t.Errorf("Orient(%v) the top left pixel must be at %v", tt.orientation, tt.wantRed)
+		}
+	}
+}
+
+func TestJPEGEncoder_Transparency(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	buffer := &bytes.Buffer{}
+
+	if err := (JPEGEncoder{}).Encode(buffer, transparent); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	decoded, _, err := image.Decode(buffer)
+
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if r, g, b, _ := decoded.At(4, 4).RGBA(); r < 0xF000 || g < 0xF000 || b < 0xF000 {
+		t.Errorf("Encode() transparent pixel = %v, want white", decoded.At(4, 4))
+	}
+}
+
+func TestToRGBA(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	if got := ToRGBA(rgba); got != rgba {
+		t.Errorf("ToRGBA() copied an RGBA image")
+	}
+
+	offset := image.NewRGBA(image.Rect(1, 1, 3, 4))
+	offset.Set(1, 1, color.White)
+
+	if got := ToRGBA(offset); got.Bounds() != image.Rect(0, 0, 2, 3) || got.RGBAAt(0, 0) != (color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}) {
+		t.Errorf("ToRGBA() = %v, want the image moved to the origin", got.Bounds())
+	}
+}
+
+type RecordingEncoder struct {
+	Encoded int
+}
+
+func (encoder *RecordingEncoder) Encode(writer io.Writer, img image.Image) error {
+	encoder.Encoded++
+
+	_, err := writer.Write([]byte("RIFF"))
+
+	return err
+}
+
+func (encoder *RecordingEncoder) ContentType() string {
+	return "image/webp"
+}
+
+func (encoder *RecordingEncoder) Extension() string {
+	return ".webp"
+}
+
+func TestEncoderFor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	for _, format := range []string{JPEG, PNG} {
+		encoder, err := EncoderFor(format)
+
+		if err != nil {
+			t.Fatalf("EncoderFor(%v) error = %v", format, err)
+		}
+
+		buffer := &bytes.Buffer{}
+
+		if err = encoder.Encode(buffer, img); err != nil {
+			t.Fatalf("Encode(%v) error = %v", format, err)
+		}
+
+		if _, decoded, err := image.Decode(buffer); err != nil || decoded != format {
+			t.Errorf("Encode(%v) wrote a %v image, error = %v", format, decoded, err)
+		}
+	}
+
+	if _, err := EncoderFor("bmp"); err == nil {
+		t.Errorf("EncoderFor() expects an error for formats without encoder")
+	} else if _, ok := err.(UnsupportedFormatError); !ok {
+		t.Errorf("EncoderFor() error = %v, want UnsupportedFormatError", err)
+	}
+
+	RegisterEncoder("webp", &RecordingEncoder{})
+	defer func() {
+		encodersMutex.Lock()
+		delete(encoders, "webp")
+		encodersMutex.Unlock()
+	}()
+
+	if encoder, err := EncoderFor("webp"); err != nil || encoder.Extension() != ".webp" {
+		t.Errorf("EncoderFor() got = %v, error = %v, want the registered encoder", encoder, err)
+	}
+}
@@ -0,0 +1,239 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// Picture is a picture embedded in the tags of an audio file e.g. the album art
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// frontCover is the picture type of the front cover in ID3 and FLAC
+const frontCover = 3
+
+// ParseAudio reads the headers and the tags of a MP3, Ogg Vorbis/Opus, WAV or FLAC file and returns the
+// embedded picture, preferring the front cover, or nil when there is none. The audio data is skipped
+func ParseAudio(reader io.ReadSeeker) (*persistence.AudioMetadata, *Picture, error) {
+	size, err := reader.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, 12)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, nil, InvalidFormatError{Message: "The audio file is too short to be parsed"}
+	}
+
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case string(header[:4]) == "fLaC":
+		return ParseFLAC(reader, size)
+	case string(header[:4]) == "OggS":
+		return ParseOgg(reader, size)
+	case string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return ParseWAV(reader, size)
+	case string(header[:3]) == "ID3" || (header[0] == 0xFF && header[1]&0xE0 == 0xE0):
+		return ParseMP3(reader, size)
+	}
+
+	return nil, nil, InvalidFormatError{Message: "Unsupported audio format"}
+}
+
+// ParseWAV reads the format, the length of the data and the INFO tags of a RIFF WAVE file
+func ParseWAV(reader io.ReadSeeker, size int64) (*persistence.AudioMetadata, *Picture, error) {
+	if _, err := reader.Seek(12, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	result := &persistence.AudioMetadata{}
+	var byteRate, dataSize int64
+
+	for offset := int64(12); offset+8 <= size; {
+		header := make([]byte, 8)
+
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+
+		kind, length := string(header[:4]), int64(binary.LittleEndian.Uint32(header[4:]))
+		next := offset + 8 + length + length%2
+
+		switch kind {
+		case "fmt ", "LIST":
+			if length > maxTagSize {
+				return nil, nil, InvalidFormatError{Message: "The WAV chunk is too large"}
+			}
+
+			data := make([]byte, length)
+
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, nil, InvalidFormatError{Message: "The WAV chunk is truncated"}
+			}
+
+			if kind == "LIST" {
+				parseWAVInfo(data, result)
+				break
+			}
+
+			if length < 16 {
+				return nil, nil, InvalidFormatError{Message: "The WAV format chunk is too short"}
+			}
+
+			result.Codec = wavCodec(binary.LittleEndian.Uint16(data))
+			result.Channels = int(binary.LittleEndian.Uint16(data[2:]))
+			result.SampleRate = int(binary.LittleEndian.Uint32(data[4:]))
+			byteRate = int64(binary.LittleEndian.Uint32(data[8:]))
+		case "data":
+			dataSize = length
+
+			// the size of streamed files may be unknown
+			if offset+8+length > size || length == 0xFFFFFFFF {
+				dataSize = size - offset - 8
+			}
+		}
+
+		offset = next
+
+		if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if result.SampleRate == 0 || byteRate == 0 {
+		return nil, nil, InvalidFormatError{Message: "The WAV file does not have a format chunk"}
+	}
+
+	result.Bitrate = int(byteRate * 8)
+	result.Duration = float64(dataSize) / float64(byteRate)
+
+	return result, nil, nil
+}
+
+func wavCodec(format uint16) string {
+	switch format {
+	case 1, 0xFFFE:
+		return "pcm"
+	case 3:
+		return "float"
+	case 6:
+		return "alaw"
+	case 7:
+		return "mulaw"
+	}
+
+	return "unknown"
+}
+
+// parseWAVInfo reads the title, the artist and the album of a LIST INFO chunk
+func parseWAVInfo(data []byte, result *persistence.AudioMetadata) {
+	if len(data) < 4 || string(data[:4]) != "INFO" {
+		return
+	}
+
+	for offset := 4; offset+8 <= len(data); {
+		kind, length := string(data[offset:offset+4]), int(binary.LittleEndian.Uint32(data[offset+4:]))
+		start := offset + 8
+
+		if length < 0 || start+length > len(data) {
+			return
+		}
+
+		value := strings.TrimRight(string(data[start:start+length]), "\x00 ")
+
+		switch kind {
+		case "INAM":
+			result.Title = value
+		case "IART":
+			result.Artist = value
+		case "IPRD":
+			result.Album = value
+		}
+
+		offset = start + length + length%2
+	}
+}
+
+// maxTagSize limits the tags and the pictures that are read into memory
+const maxTagSize = 16 << 20
+
+// averageBitrate returns the bits per second of the audio data
+func averageBitrate(bytes int64, duration float64) int {
+	if duration <= 0 {
+		return 0
+	}
+
+	return int(float64(bytes*8)/duration + 0.5)
+}
+
+// decodeText decodes the ISO-8859-1, UTF-16 with byte order mark, UTF-16BE and UTF-8 encodings of ID3
+func decodeText(encoding byte, data []byte) string {
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+
+		if len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF {
+			bigEndian, data = true, data[2:]
+		} else if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+			bigEndian, data = false, data[2:]
+		}
+
+		units := make([]uint16, 0, len(data)/2)
+
+		for index := 0; index+1 < len(data); index += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[index:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[index:]))
+			}
+		}
+
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	case 3:
+		return strings.TrimRight(string(data), "\x00")
+	}
+
+	runes := make([]rune, len(data))
+
+	for index, character := range data {
+		runes[index] = rune(character)
+	}
+
+	return strings.TrimRight(string(runes), "\x00")
+}
+
+// splitTerminated splits the data after the first terminator of the encoding, the terminator is two zero bytes
+// for UTF-16 and a zero byte otherwise
+func splitTerminated(encoding byte, data []byte) ([]byte, []byte) {
+	if encoding == 1 || encoding == 2 {
+		for index := 0; index+1 < len(data); index += 2 {
+			if data[index] == 0 && data[index+1] == 0 {
+				return data[:index], data[index+2:]
+			}
+		}
+
+		return data, nil
+	}
+
+	if index := bytes.IndexByte(data, 0); index >= 0 {
+		return data[:index], data[index+1:]
+	}
+
+	return data, nil
+}
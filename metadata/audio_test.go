@@ -0,0 +1,366 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+var coverArt = []byte("\x89PNG\r\n\x1a\ncover")
+
+// mp3Frames returns MPEG 1 layer III frames of 128 kbps at 44.1 kHz, the first payload is copied at the start of
+// the first frame
+func mp3Frames(count int, first []byte) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	result := make([]byte, 0, count*len(frame))
+
+	for index := 0; index < count; index++ {
+		result = append(result, frame...)
+	}
+
+	copy(result[4:], first)
+
+	return result
+}
+
+func xingHeader(frames, length uint32) []byte {
+	result := make([]byte, 32+16)
+	copy(result[32:], "Xing")
+	binary.BigEndian.PutUint32(result[36:], 3)
+	binary.BigEndian.PutUint32(result[40:], frames)
+	binary.BigEndian.PutUint32(result[44:], length)
+
+	return result
+}
+
+func id3Frame(ID string, data []byte) []byte {
+	header := make([]byte, 10)
+	copy(header, ID)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+
+	return append(header, data...)
+}
+
+func id3Tag(frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	length := len(body)
+
+	return append([]byte{'I', 'D', '3', 3, 0, 0,
+		byte(length >> 21 & 0x7F), byte(length >> 14 & 0x7F), byte(length >> 7 & 0x7F), byte(length & 0x7F)}, body...)
+}
+
+func id3v1Tag(title, artist, album string) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+
+	return tag
+}
+
+func riffChunk(kind string, payload []byte) []byte {
+	header := make([]byte, 8)
+	copy(header, kind)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(payload)))
+
+	if len(payload)%2 != 0 {
+		payload = append(payload, 0)
+	}
+
+	return append(header, payload...)
+}
+
+func newWAV(withFormat bool) []byte {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format, 1)
+	binary.LittleEndian.PutUint16(format[2:], 2)
+	binary.LittleEndian.PutUint32(format[4:], 44100)
+	binary.LittleEndian.PutUint32(format[8:], 176400)
+	binary.LittleEndian.PutUint16(format[12:], 4)
+	binary.LittleEndian.PutUint16(format[14:], 16)
+	var chunks [][]byte
+
+	if withFormat {
+		chunks = append(chunks, riffChunk("fmt ", format))
+	}
+
+	chunks = append(chunks,
+		riffChunk("LIST", append([]byte("INFO"), riffChunk("INAM", []byte("Field Recording\x00"))...)),
+		riffChunk("data", make([]byte, 88200)),
+	)
+	content := bytes.Join(chunks, nil)
+	header := make([]byte, 12)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+len(content)))
+	copy(header[8:], "WAVE")
+
+	return append(header, content...)
+}
+
+func flacPictureBlock(pictureType uint32, mimeType string, data []byte) []byte {
+	field := func(value []byte) []byte {
+		result := make([]byte, 4)
+		binary.BigEndian.PutUint32(result, uint32(len(value)))
+
+		return append(result, value...)
+	}
+	result := make([]byte, 4)
+	binary.BigEndian.PutUint32(result, pictureType)
+
+	return bytes.Join([][]byte{result, field([]byte(mimeType)), field(nil), make([]byte, 16), field(data)}, nil)
+}
+
+func vorbisComment(comments ...string) []byte {
+	field := func(value string) []byte {
+		result := make([]byte, 4)
+		binary.LittleEndian.PutUint32(result, uint32(len(value)))
+
+		return append(result, value...)
+	}
+	count := make([]byte, 4)
+	binary.LittleEndian.PutUint32(count, uint32(len(comments)))
+	result := append(field("multimedia-go"), count...)
+
+	for _, comment := range comments {
+		result = append(result, field(comment)...)
+	}
+
+	return result
+}
+
+func flacBlock(kind byte, last bool, data []byte) []byte {
+	if last {
+		kind |= 0x80
+	}
+
+	return append([]byte{kind, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func newFLAC(blocks ...[]byte) []byte {
+	streamInfo := make([]byte, 34)
+	// 48 kHz, 2 channels, 16 bits per sample and 96000 samples
+	binary.BigEndian.PutUint64(streamInfo[10:], 48000<<44|1<<41|15<<36|96000)
+	blocks = append([][]byte{flacBlock(flacStreamInfo, len(blocks) == 0, streamInfo)}, blocks...)
+
+	return append(append([]byte("fLaC"), bytes.Join(blocks, nil)...), make([]byte, 1000)...)
+}
+
+func oggPage(serial uint32, granule int64, packets ...[]byte) []byte {
+	var lacing, body []byte
+
+	for _, packet := range packets {
+		length := len(packet)
+
+		for ; length >= 255; length -= 255 {
+			lacing = append(lacing, 255)
+		}
+
+		lacing = append(lacing, byte(length))
+		body = append(body, packet...)
+	}
+
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint64(header[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(header[14:], serial)
+	header[26] = byte(len(lacing))
+
+	return bytes.Join([][]byte{header, lacing, body}, nil)
+}
+
+func newOggVorbis(comments ...string) []byte {
+	identification := make([]byte, 30)
+	copy(identification, "\x01vorbis")
+	identification[11] = 2
+	binary.LittleEndian.PutUint32(identification[12:], 44100)
+	comment := append(append([]byte("\x03vorbis"), vorbisComment(comments...)...), 1)
+
+	return bytes.Join([][]byte{
+		oggPage(7, 0, identification),
+		oggPage(7, 0, comment, []byte("\x05vorbis setup")),
+		oggPage(9, 1000, make([]byte, 100)),
+		oggPage(7, 44100, make([]byte, 200)),
+		oggPage(7, 88200, make([]byte, 200)),
+	}, nil)
+}
+
+func newOggOpus(comments ...string) []byte {
+	identification := make([]byte, 19)
+	copy(identification, "OpusHead")
+	identification[8] = 1
+	identification[9] = 1
+	binary.LittleEndian.PutUint16(identification[10:], 312)
+	binary.LittleEndian.PutUint32(identification[12:], 16000)
+	comment := append([]byte("OpusTags"), vorbisComment(comments...)...)
+
+	return bytes.Join([][]byte{
+		oggPage(3, 0, identification),
+		oggPage(3, 0, comment),
+		oggPage(3, 3*48000+312, make([]byte, 300)),
+	}, nil)
+}
+
+func utf16Text(value string) []byte {
+	result := []byte{1, 0xFF, 0xFE}
+
+	for _, character := range value {
+		result = append(result, byte(character), 0)
+	}
+
+	return result
+}
+
+func TestParseAudio(t *testing.T) {
+	vbr := append(id3Tag(
+		id3Frame("TIT2", []byte("\x00Intro\x00")),
+		id3Frame("TPE1", utf16Text("Artist")),
+		id3Frame("TALB", []byte("\x03Álbum")),
+		id3Frame("APIC", append([]byte("\x00image/jpeg\x00\x00back\x00"), []byte("back cover")...)),
+		id3Frame("APIC", append([]byte("\x00image/png\x00\x03front\x00"), coverArt...)),
+	), mp3Frames(10, xingHeader(100, 41700))...)
+	cbr := append(mp3Frames(10, nil), id3v1Tag("Old Title", "Old Artist", "Old Album")...)
+	flac := newFLAC(
+		flacBlock(flacVorbisComment, false, vorbisComment("TITLE=Lossless", "artist=Band", "ALBUM=Live")),
+		flacBlock(1, false, make([]byte, 16)),
+		flacBlock(flacPicture, true, flacPictureBlock(frontCover, "image/png", coverArt)),
+	)
+	vorbis := newOggVorbis("TITLE=Vorbis Song", "ARTIST=Vorbis Artist")
+	opus := newOggOpus("ALBUM=Opus Album", "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(flacPictureBlock(frontCover, "image/png", coverArt)))
+
+	tests := []struct {
+		name        string
+		content     []byte
+		want        *persistence.AudioMetadata
+		wantPicture *Picture
+		wantErr     bool
+	}{
+		{
+			name:    "Parses a variable bitrate MP3 file with ID3v2 tags",
+			content: vbr,
+			want: &persistence.AudioMetadata{
+				Duration:   float64(100*1152) / 44100,
+				Bitrate:    127706,
+				SampleRate: 44100,
+				Channels:   2,
+				Codec:      "mp3",
+				Title:      "Intro",
+				Artist:     "Artist",
+				Album:      "Álbum",
+			},
+			wantPicture: &Picture{MIMEType: "image/png", Data: coverArt},
+		},
+		{
+			name:    "Parses a constant bitrate MP3 file with an ID3v1 tag",
+			content: cbr,
+			want: &persistence.AudioMetadata{
+				Duration:   0.260625,
+				Bitrate:    128000,
+				SampleRate: 44100,
+				Channels:   2,
+				Codec:      "mp3",
+				Title:      "Old Title",
+				Artist:     "Old Artist",
+				Album:      "Old Album",
+			},
+		},
+		{
+			name:    "Parses a WAV file",
+			content: newWAV(true),
+			want: &persistence.AudioMetadata{
+				Duration:   0.5,
+				Bitrate:    1411200,
+				SampleRate: 44100,
+				Channels:   2,
+				Codec:      "pcm",
+				Title:      "Field Recording",
+			},
+		},
+		{
+			name:    "Parses a FLAC file",
+			content: flac,
+			want: &persistence.AudioMetadata{
+				Duration:   2,
+				Bitrate:    4000,
+				SampleRate: 48000,
+				Channels:   2,
+				Codec:      "flac",
+				Title:      "Lossless",
+				Artist:     "Band",
+				Album:      "Live",
+			},
+			wantPicture: &Picture{MIMEType: "image/png", Data: coverArt},
+		},
+		{
+			name:    "Parses an Ogg Vorbis file",
+			content: vorbis,
+			want: &persistence.AudioMetadata{
+				Duration:   2,
+				Bitrate:    len(vorbis) * 4,
+				SampleRate: 44100,
+				Channels:   2,
+				Codec:      "vorbis",
+				Title:      "Vorbis Song",
+				Artist:     "Vorbis Artist",
+			},
+		},
+		{
+			name:    "Parses an Ogg Opus file",
+			content: opus,
+			want: &persistence.AudioMetadata{
+				Duration:   3,
+				Bitrate:    int(float64(len(opus)*8)/3 + 0.5),
+				SampleRate: 16000,
+				Channels:   1,
+				Codec:      "opus",
+				Album:      "Opus Album",
+			},
+			wantPicture: &Picture{MIMEType: "image/png", Data: coverArt},
+		},
+		{
+			name:    "Error if the MP3 file does not have audio frames",
+			content: append(id3Tag(id3Frame("TIT2", []byte("\x00Intro"))), make([]byte, 256)...),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the WAV file does not have a format chunk",
+			content: newWAV(false),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the FLAC metadata is truncated",
+			content: newFLAC(flacBlock(flacVorbisComment, true, vorbisComment("TITLE=Lossless")))[:60],
+			wantErr: true,
+		},
+		{
+			name:    "Error if the Ogg codec is not supported",
+			content: oggPage(1, 0, []byte("Speex   1.2")),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the format is unknown",
+			content: []byte("%PDF-1.4 not audio"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, picture, err := ParseAudio(bytes.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAudio() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAudio() got = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(picture, tt.wantPicture) {
+				t.Errorf("ParseAudio() picture = %+v, want %+v", picture, tt.wantPicture)
+			}
+		})
+	}
+}
@@ -0,0 +1,764 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// orientationTag is the EXIF tag of the orientation
+const orientationTag = 0x0112
+
+const (
+	webpAlphaFlag = 0x10
+	webpEXIFFlag  = 0x08
+	webpXMPFlag   = 0x04
+)
+
+var (
+	jpegMagic  = []byte{0xFF, 0xD8}
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader = []byte("Exif\x00\x00")
+	mpfHeader  = []byte("MPF\x00")
+	tiffMagics = [][]byte{[]byte("II*\x00"), []byte("MM\x00*")}
+)
+
+// UnstrippableFormatError is returned by StripEXIF for the formats that can hold EXIF metadata but can not
+// be copied without it
+type UnstrippableFormatError struct {
+	Format string
+}
+
+func (err UnstrippableFormatError) Error() string {
+	return fmt.Sprintf("The metadata of the %v images can not be removed", err.Format)
+}
+
+// imageChunk is a part of an image file, raw includes the headers of the chunk and data is its payload
+type imageChunk struct {
+	kind string
+	raw  []byte
+	data []byte
+}
+
+// imageFormat describes where a file format stores its metadata
+type imageFormat struct {
+	chunks func(content []byte) ([]imageChunk, error)
+	// exif returns the TIFF structure of the chunks that hold an EXIF
+	exif func(chunk imageChunk) []byte
+	// metadata reports if the chunk holds metadata that is removed by StripEXIF
+	metadata func(chunk imageChunk) bool
+	// orientation returns a chunk that holds the given TIFF structure
+	orientation func(tiff []byte) []byte
+}
+
+var jpegFormat = &imageFormat{
+	chunks: jpegChunks,
+	exif: func(chunk imageChunk) []byte {
+		if chunk.kind == "E1" && bytes.HasPrefix(chunk.data, exifHeader) {
+			return chunk.data[len(exifHeader):]
+		}
+
+		return nil
+	},
+	metadata: func(chunk imageChunk) bool {
+		// APP1 holds EXIF and XMP, APP13 holds IPTC and COM holds comments. The MPF index of APP2 points
+		// to the secondary images appended after the end of the image, they are removed with it
+		return chunk.kind == "E1" || chunk.kind == "ED" || chunk.kind == "FE" ||
+			chunk.kind == "E2" && bytes.HasPrefix(chunk.data, mpfHeader)
+	},
+	orientation: func(tiff []byte) []byte {
+		segment := []byte{0xFF, 0xE1, 0, 0}
+		binary.BigEndian.PutUint16(segment[2:], uint16(2+len(exifHeader)+len(tiff)))
+		segment = append(segment, exifHeader...)
+
+		return append(segment, tiff...)
+	},
+}
+
+var pngFormat = &imageFormat{
+	chunks: pngChunks,
+	exif: func(chunk imageChunk) []byte {
+		if chunk.kind == "eXIf" {
+			return bytes.TrimPrefix(chunk.data, exifHeader)
+		}
+
+		return nil
+	},
+	metadata: func(chunk imageChunk) bool {
+		return chunk.kind == "eXIf" || chunk.kind == "tEXt" || chunk.kind == "zTXt" || chunk.kind == "iTXt"
+	},
+	orientation: func(tiff []byte) []byte {
+		chunk := make([]byte, 4, 12+len(tiff))
+		binary.BigEndian.PutUint32(chunk, uint32(len(tiff)))
+		chunk = append(chunk, "eXIf"...)
+		chunk = append(chunk, tiff...)
+		checksum := make([]byte, 4)
+		binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(chunk[4:]))
+
+		return append(chunk, checksum...)
+	},
+}
+
+var webpFormat = &imageFormat{
+	chunks: webpChunks,
+	exif: func(chunk imageChunk) []byte {
+		if chunk.kind == "EXIF" {
+			return bytes.TrimPrefix(chunk.data, exifHeader)
+		}
+
+		return nil
+	},
+	metadata: func(chunk imageChunk) bool {
+		return chunk.kind == "EXIF" || chunk.kind == "XMP "
+	},
+	orientation: func(tiff []byte) []byte {
+		chunk := make([]byte, 8, 9+len(tiff))
+		copy(chunk, "EXIF")
+		binary.LittleEndian.PutUint32(chunk[4:], uint32(len(tiff)))
+		chunk = append(chunk, tiff...)
+
+		if len(tiff)%2 == 1 {
+			chunk = append(chunk, 0)
+		}
+
+		return chunk
+	},
+}
+
+func formatOf(content []byte) *imageFormat {
+	switch {
+	case bytes.HasPrefix(content, jpegMagic):
+		return jpegFormat
+	case bytes.HasPrefix(content, pngMagic):
+		return pngFormat
+	case isWebP(content):
+		return webpFormat
+	}
+
+	return nil
+}
+
+// unstrippableFormat returns the name of the formats that can hold EXIF metadata but are not supported by
+// StripEXIF, an empty string for the rest
+func unstrippableFormat(content []byte) string {
+	for _, magic := range tiffMagics {
+		if bytes.HasPrefix(content, magic) {
+			return "TIFF"
+		}
+	}
+
+	// HEIC and AVIF images are ISO base media files
+	if len(content) >= 12 && bytes.Equal(content[4:8], []byte("ftyp")) {
+		return "HEIF"
+	}
+
+	return ""
+}
+
+// maxMetadataLength limits the metadata chunks read to keep their orientation, the bigger ones are dropped
+// without being read
+const maxMetadataLength = 1 << 20
+
+// StripEXIF copies a JPEG, PNG or WebP image without its EXIF, XMP and textual metadata e.g. the GPS
+// position or the camera serial number. The EXIF orientation is kept so the image is still displayed
+// upright. The data after the end of the image e.g. the secondary images of MPF files is read and dropped.
+// TIFF, HEIC and AVIF images return an UnstrippableFormatError, other formats are copied unchanged
+func StripEXIF(reader io.Reader, writer io.Writer) error {
+	source := bufio.NewReader(reader)
+	header, err := source.Peek(12)
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	output := bufio.NewWriter(writer)
+	stripper := &metadataStripper{writer: output}
+
+	switch {
+	case bytes.HasPrefix(header, jpegMagic):
+		stripper.format = jpegFormat
+		err = stripper.jpeg(source)
+	case bytes.HasPrefix(header, pngMagic):
+		stripper.format = pngFormat
+		err = stripper.png(source)
+	case isWebP(header):
+		stripper.format = webpFormat
+		err = stripper.webp(source)
+	default:
+		if name := unstrippableFormat(header); name != "" {
+			return UnstrippableFormatError{Format: name}
+		}
+
+		_, err = io.Copy(output, source)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the reader is consumed to the end, e.g. for the callers that hash the original file while it is stripped
+	if _, err = io.Copy(ioutil.Discard, source); err != nil {
+		return err
+	}
+
+	return output.Flush()
+}
+
+// metadataStripper writes the chunks of an image without its metadata, the first EXIF with an orientation is
+// replaced with a chunk that only holds the orientation
+type metadataStripper struct {
+	format  *imageFormat
+	writer  io.Writer
+	hasEXIF bool
+}
+
+// write writes a chunk that is not metadata and the orientation of the first EXIF
+func (stripper *metadataStripper) write(chunk imageChunk) error {
+	if !stripper.format.metadata(chunk) {
+		_, err := stripper.writer.Write(chunk.raw)
+
+		return err
+	}
+
+	tiff := stripper.format.exif(chunk)
+
+	if tiff == nil || stripper.hasEXIF {
+		return nil
+	}
+
+	if orientation := parseOrientation(tiff); orientation > 1 {
+		stripper.hasEXIF = true
+		_, err := stripper.writer.Write(stripper.format.orientation(orientationTIFF(orientation)))
+
+		return err
+	}
+
+	return nil
+}
+
+// jpeg strips the segments of a JPEG file up to the end of image, the entropy coded data of the scans is copied
+func (stripper *metadataStripper) jpeg(reader *bufio.Reader) error {
+	if _, err := reader.Discard(len(jpegMagic)); err != nil {
+		return err
+	}
+
+	if _, err := stripper.writer.Write(jpegMagic); err != nil {
+		return err
+	}
+
+	marker, err := readJPEGMarker(reader)
+
+	for err == nil {
+		// the markers without length, the end of image is the end of the file
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD9 {
+			if _, err = stripper.writer.Write([]byte{0xFF, marker}); err != nil || marker == 0xD9 {
+				return err
+			}
+
+			marker, err = readJPEGMarker(reader)
+			continue
+		}
+
+		var segment imageChunk
+
+		if segment, err = readJPEGSegment(reader, marker); err != nil {
+			return truncated(err, "The JPEG file is truncated")
+		}
+
+		if err = stripper.write(segment); err != nil {
+			return err
+		}
+
+		// start of scan, the entropy coded data ends with the next marker
+		if marker == 0xDA {
+			marker, err = copyJPEGScan(reader, stripper.writer)
+		} else {
+			marker, err = readJPEGMarker(reader)
+		}
+	}
+
+	// the files that end without the end of image marker are copied up to their end
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
+
+// readJPEGSegment reads a segment whose marker was read, its length is at most 64 KiB
+func readJPEGSegment(reader io.Reader, marker byte) (imageChunk, error) {
+	length := make([]byte, 2)
+
+	if _, err := io.ReadFull(reader, length); err != nil {
+		return imageChunk{}, err
+	}
+
+	size := int(binary.BigEndian.Uint16(length))
+
+	if size < 2 {
+		return imageChunk{}, InvalidFormatError{Message: "The JPEG segment length is invalid"}
+	}
+
+	raw := make([]byte, 2+size)
+	raw[0], raw[1] = 0xFF, marker
+	copy(raw[2:], length)
+
+	if _, err := io.ReadFull(reader, raw[4:]); err != nil {
+		return imageChunk{}, err
+	}
+
+	return imageChunk{kind: fmt.Sprintf("%02X", marker), raw: raw, data: raw[4:]}, nil
+}
+
+// readJPEGMarker reads a marker and its fill bytes
+func readJPEGMarker(reader *bufio.Reader) (byte, error) {
+	current, err := reader.ReadByte()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if current != 0xFF {
+		return 0, InvalidFormatError{Message: "The JPEG segment marker is invalid"}
+	}
+
+	for current == 0xFF {
+		if current, err = reader.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return current, nil
+}
+
+// copyJPEGScan copies the entropy coded data of a scan and returns the marker that ends it, the stuffed
+// bytes and the restart markers are part of the data
+func copyJPEGScan(reader *bufio.Reader, writer io.Writer) (byte, error) {
+	for {
+		data, err := reader.ReadSlice(0xFF)
+
+		if err != nil {
+			if _, writeErr := writer.Write(data); writeErr != nil {
+				return 0, writeErr
+			}
+
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+
+			return 0, err
+		}
+
+		if _, err = writer.Write(data[:len(data)-1]); err != nil {
+			return 0, err
+		}
+
+		next := byte(0xFF)
+
+		for next == 0xFF {
+			if next, err = reader.ReadByte(); err != nil {
+				return 0, err
+			}
+		}
+
+		if next != 0x00 && (next < 0xD0 || next > 0xD7) {
+			return next, nil
+		}
+
+		if _, err = writer.Write([]byte{0xFF, next}); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// png strips the chunks of a PNG file up to the IEND chunk, the chunks that are not metadata are copied
+func (stripper *metadataStripper) png(reader *bufio.Reader) error {
+	if _, err := reader.Discard(len(pngMagic)); err != nil {
+		return err
+	}
+
+	if _, err := stripper.writer.Write(pngMagic); err != nil {
+		return err
+	}
+
+	for {
+		header := make([]byte, 8)
+
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return truncated(err, "The PNG chunk is truncated")
+		}
+
+		length := int64(binary.BigEndian.Uint32(header))
+
+		if length > math.MaxInt32 {
+			return InvalidFormatError{Message: "The PNG chunk length is invalid"}
+		}
+
+		kind := string(header[4:])
+
+		// the length, the kind, the data and the CRC
+		if err := stripper.chunk(reader, header, kind, length, length+4); err != nil {
+			return truncated(err, "The PNG chunk is truncated")
+		}
+
+		if kind == "IEND" {
+			return nil
+		}
+	}
+}
+
+// webp strips the chunks of the RIFF container of a WebP file, its size and the VP8X flags are updated. The
+// chunks are spooled to a temporary file because the size is written before them
+func (stripper *metadataStripper) webp(reader *bufio.Reader) error {
+	riff := make([]byte, 12)
+
+	if _, err := io.ReadFull(reader, riff); err != nil {
+		return err
+	}
+
+	spool, err := ioutil.TempFile("", "webp-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	output := stripper.writer
+	buffered := bufio.NewWriter(spool)
+	stripper.writer = buffered
+	// the size of the RIFF container includes the WEBP form type, the data after it is dropped
+	body := bufio.NewReader(io.LimitReader(reader, int64(binary.LittleEndian.Uint32(riff[4:]))-4))
+	var extended []byte
+
+	for {
+		header := make([]byte, 8)
+
+		if _, err = io.ReadFull(body, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return truncated(err, "The WebP chunk is truncated")
+		}
+
+		kind := string(header[:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		// the chunks are padded to an even size
+		padded := size + size%2
+
+		if kind == "VP8X" {
+			if extended, err = readChunk(body, header, size, padded); err != nil {
+				return truncated(err, "The WebP chunk is truncated")
+			}
+
+			continue
+		}
+
+		if err = stripper.chunk(body, header, kind, size, padded); err != nil {
+			return truncated(err, "The WebP chunk is truncated")
+		}
+	}
+
+	if err = buffered.Flush(); err != nil {
+		return err
+	}
+
+	if extended != nil && len(extended) > 8 {
+		extended[8] &^= webpEXIFFlag | webpXMPFlag
+
+		if stripper.hasEXIF {
+			extended[8] |= webpEXIFFlag
+		}
+	}
+
+	length, err := spool.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(riff[4:], uint32(4+int64(len(extended))+length))
+
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err = output.Write(append(riff, extended...)); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(output, spool)
+
+	return err
+}
+
+// chunk strips a chunk whose header was read, the metadata chunks are read to keep their orientation and the
+// rest is copied. The size is the length of the data and the amount of bytes left to read
+func (stripper *metadataStripper) chunk(reader io.Reader, header []byte, kind string, size, left int64) error {
+	if !stripper.format.metadata(imageChunk{kind: kind}) {
+		if _, err := stripper.writer.Write(header); err != nil {
+			return err
+		}
+
+		copied, err := io.CopyN(stripper.writer, reader, left)
+
+		// the last chunk of a RIFF container may lack its padding
+		if err == io.EOF && left-size == 1 && copied == size {
+			_, err = stripper.writer.Write([]byte{0})
+		}
+
+		return err
+	}
+
+	if size > maxMetadataLength {
+		_, err := io.CopyN(ioutil.Discard, reader, left)
+
+		return err
+	}
+
+	raw, err := readChunk(reader, header, size, left)
+
+	if err != nil {
+		return err
+	}
+
+	return stripper.write(imageChunk{kind: kind, raw: raw, data: raw[len(header) : len(header)+int(size)]})
+}
+
+// readChunk reads a chunk whose header was read, the last chunk of a RIFF container may lack its padding
+func readChunk(reader io.Reader, header []byte, size, left int64) ([]byte, error) {
+	if size > maxMetadataLength {
+		return nil, InvalidFormatError{Message: "The chunk is too large"}
+	}
+
+	raw := make([]byte, int64(len(header))+left)
+	copy(raw, header)
+	read, err := io.ReadFull(reader, raw[len(header):])
+
+	if err == io.ErrUnexpectedEOF && left-size == 1 && int64(read) == size {
+		err = nil
+	}
+
+	return raw, err
+}
+
+// truncated returns an InvalidFormatError when a file ends before its last chunk
+func truncated(err error, message string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return InvalidFormatError{Message: message}
+	}
+
+	return err
+}
+
+// findEXIF returns the TIFF structure of the first EXIF of the image, nil when it does not have one
+func findEXIF(content []byte) ([]byte, error) {
+	format := formatOf(content)
+
+	if format == nil {
+		return nil, nil
+	}
+
+	chunks, err := format.chunks(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range chunks {
+		if tiff := format.exif(chunk); tiff != nil {
+			return tiff, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// parseOrientation returns the orientation of the first IFD of a TIFF structure, zero when it is missing or invalid
+func parseOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int64(order.Uint32(tiff[4:8]))
+
+	if offset+2 > int64(len(tiff)) {
+		return 0
+	}
+
+	count := int64(order.Uint16(tiff[offset:]))
+
+	for index := int64(0); index < count; index++ {
+		entry := offset + 2 + index*12
+
+		if entry+12 > int64(len(tiff)) {
+			return 0
+		}
+
+		// the orientation is a SHORT, type 3, stored in the first bytes of the value
+		if order.Uint16(tiff[entry:]) == orientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+
+			return 0
+		}
+	}
+
+	return 0
+}
+
+// orientationTIFF returns a big endian TIFF structure whose only tag is the orientation
+func orientationTIFF(orientation int) []byte {
+	tiff := make([]byte, 26)
+	copy(tiff, "MM\x00\x2A")
+	binary.BigEndian.PutUint32(tiff[4:], 8)
+	binary.BigEndian.PutUint16(tiff[8:], 1)
+	binary.BigEndian.PutUint16(tiff[10:], orientationTag)
+	binary.BigEndian.PutUint16(tiff[12:], 3)
+	binary.BigEndian.PutUint32(tiff[14:], 1)
+	binary.BigEndian.PutUint16(tiff[18:], uint16(orientation))
+
+	return tiff
+}
+
+// jpegChunks splits a JPEG file in its segments up to the start of scan, the entropy coded data is
+// returned as the last chunk
+func jpegChunks(content []byte) ([]imageChunk, error) {
+	chunks := []imageChunk{{kind: "SOI", raw: content[:2]}}
+	offset := 2
+
+	for offset < len(content) {
+		start := offset
+
+		if content[offset] != 0xFF {
+			return nil, InvalidFormatError{Message: "The JPEG segment marker is invalid"}
+		}
+
+		for offset < len(content) && content[offset] == 0xFF {
+			offset++
+		}
+
+		if offset >= len(content) {
+			return nil, InvalidFormatError{Message: "The JPEG file is truncated"}
+		}
+
+		marker := content[offset]
+		offset++
+
+		// the markers without length
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD9 {
+			chunks = append(chunks, imageChunk{kind: fmt.Sprintf("%02X", marker), raw: content[start:offset]})
+			continue
+		}
+
+		if offset+2 > len(content) {
+			return nil, InvalidFormatError{Message: "The JPEG file is truncated"}
+		}
+
+		end := offset + int(binary.BigEndian.Uint16(content[offset:]))
+
+		if end < offset+2 || end > len(content) {
+			return nil, InvalidFormatError{Message: "The JPEG segment length is invalid"}
+		}
+
+		chunks = append(chunks, imageChunk{kind: fmt.Sprintf("%02X", marker), raw: content[start:end], data: content[offset+2 : end]})
+		offset = end
+
+		// start of scan, the metadata segments are before it
+		if marker == 0xDA {
+			chunks = append(chunks, imageChunk{kind: "data", raw: content[end:]})
+			break
+		}
+	}
+
+	return chunks, nil
+}
+
+// pngChunks splits a PNG file in its chunks, the content after the IEND chunk is returned as the last chunk
+func pngChunks(content []byte) ([]imageChunk, error) {
+	chunks := []imageChunk{{kind: "signature", raw: content[:len(pngMagic)]}}
+	offset := len(pngMagic)
+
+	for offset < len(content) {
+		if offset+12 > len(content) {
+			return nil, InvalidFormatError{Message: "The PNG chunk is truncated"}
+		}
+
+		length := int64(binary.BigEndian.Uint32(content[offset:]))
+
+		if length > int64(len(content)-offset-12) {
+			return nil, InvalidFormatError{Message: "The PNG chunk length is invalid"}
+		}
+
+		end := offset + 12 + int(length)
+		kind := string(content[offset+4 : offset+8])
+		chunks = append(chunks, imageChunk{kind: kind, raw: content[offset:end], data: content[offset+8 : end-4]})
+		offset = end
+
+		if kind == "IEND" {
+			chunks = append(chunks, imageChunk{kind: "trailing", raw: content[end:]})
+			break
+		}
+	}
+
+	return chunks, nil
+}
+
+// webpChunks splits a WebP file in the RIFF header and its chunks
+func webpChunks(content []byte) ([]imageChunk, error) {
+	if !isWebP(content) {
+		return nil, InvalidFormatError{Message: "The file is not a WebP image"}
+	}
+
+	chunks := []imageChunk{{kind: "RIFF", raw: content[:12]}}
+	offset := 12
+
+	for offset < len(content) {
+		if offset+8 > len(content) {
+			return nil, InvalidFormatError{Message: "The WebP chunk is truncated"}
+		}
+
+		size := int64(binary.LittleEndian.Uint32(content[offset+4:]))
+
+		if size > int64(len(content)-offset-8) {
+			return nil, InvalidFormatError{Message: "The WebP chunk size is invalid"}
+		}
+
+		dataEnd := offset + 8 + int(size)
+		end := dataEnd
+
+		// the chunks are padded to an even size
+		if size%2 == 1 && end < len(content) {
+			end++
+		}
+
+		chunks = append(chunks, imageChunk{kind: string(content[offset : offset+4]), raw: content[offset:end], data: content[offset+8 : dataEnd]})
+		offset = end
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,168 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// newLargeJPEG returns a JPEG image whose entropy coded data is bigger than the buffer of the stripper
+func newLargeJPEG() []byte {
+	img := image.NewGray(image.Rect(0, 0, 300, 300))
+
+	for index := range img.Pix {
+		img.Pix[index] = uint8(index * 7919 % 251)
+	}
+
+	buffer := &bytes.Buffer{}
+	_ = jpeg.Encode(buffer, img, &jpeg.Options{Quality: 100})
+	content := buffer.Bytes()
+
+	return append(append(append([]byte{}, content[:2]...), jpegFormat.orientation(newEXIF(6))...), content[2:]...)
+}
+
+func TestStripEXIF(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         []byte
+		wantOrientation int
+		decodable       bool
+	}{
+		{name: "Strips a JPEG image", content: newJPEG(6), wantOrientation: 6, decodable: true},
+		{name: "Strips a JPEG image without orientation", content: newJPEG(1), wantOrientation: 1, decodable: true},
+		{name: "Strips a JPEG image bigger than the read buffer", content: newLargeJPEG(), wantOrientation: 6, decodable: true},
+		{name: "Strips a PNG image", content: newPNG(3), wantOrientation: 3, decodable: true},
+		{name: "Strips a WebP image", content: newWebP(8), wantOrientation: 8},
+		{name: "Strips a WebP image without orientation", content: newWebP(1), wantOrientation: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped := &bytes.Buffer{}
+
+			if err := StripEXIF(iotest.HalfReader(bytes.NewReader(tt.content)), stripped); err != nil {
+				t.Fatalf("StripEXIF() error = %v", err)
+			}
+
+			for _, secret := range []string{"GPS-SECRET", "John Doe"} {
+				if bytes.Contains(stripped.Bytes(), []byte(secret)) {
+					t.Errorf("StripEXIF() kept the metadata %q", secret)
+				}
+			}
+
+			got, err := ParseImage(bytes.NewReader(stripped.Bytes()))
+
+			if err != nil || got.Orientation != tt.wantOrientation {
+				t.Errorf("StripEXIF() orientation = %+v, error = %v, want %v", got, err, tt.wantOrientation)
+			}
+
+			if tt.decodable {
+				if _, _, err = image.Decode(bytes.NewReader(stripped.Bytes())); err != nil {
+					t.Errorf("StripEXIF() the stripped image can not be decoded, error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStripEXIF_TrailingData(t *testing.T) {
+	mpf := append([]byte{0xFF, 0xE2, 0x00, 0x0A}, "MPF\x00II*\x00"...)
+	// a multi picture file whose secondary image is appended after the end of the primary image
+	multiPicture := append(append(append([]byte{}, newJPEG(6)[:2]...), mpf...), newJPEG(6)[2:]...)
+
+	tests := []struct {
+		name     string
+		content  []byte
+		trailing []byte
+	}{
+		{name: "Drops the secondary images of a JPEG image", content: multiPicture, trailing: newJPEG(3)},
+		{name: "Drops the data after the IEND chunk of a PNG image", content: newPNG(3), trailing: newJPEG(3)},
+		{name: "Drops the data after the RIFF container of a WebP image", content: newWebP(8), trailing: newJPEG(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := append(append([]byte{}, tt.content...), tt.trailing...)
+			hash := sha256.New()
+			stripped := &bytes.Buffer{}
+
+			if err := StripEXIF(io.TeeReader(iotest.OneByteReader(bytes.NewReader(content)), hash), stripped); err != nil {
+				t.Fatalf("StripEXIF() error = %v", err)
+			}
+
+			for _, secret := range []string{"GPS-SECRET", "John Doe", "MPF\x00"} {
+				if bytes.Contains(stripped.Bytes(), []byte(secret)) {
+					t.Errorf("StripEXIF() kept the metadata %q", secret)
+				}
+			}
+
+			if !bytes.Equal(hash.Sum(nil), sha256Sum(content)) {
+				t.Errorf("StripEXIF() did not read the whole file")
+			}
+
+			if _, err := ParseImage(bytes.NewReader(stripped.Bytes())); err != nil {
+				t.Errorf("StripEXIF() the stripped image can not be parsed, error = %v", err)
+			}
+		})
+	}
+}
+
+func sha256Sum(content []byte) []byte {
+	sum := sha256.Sum256(content)
+
+	return sum[:]
+}
+
+func TestStripEXIF_WebPHeaders(t *testing.T) {
+	for orientation, wantFlags := range map[int]byte{1: 0, 6: webpEXIFFlag} {
+		stripped := &bytes.Buffer{}
+
+		if err := StripEXIF(bytes.NewReader(newWebP(orientation)), stripped); err != nil {
+			t.Fatalf("StripEXIF() error = %v", err)
+		}
+
+		chunks, err := webpChunks(stripped.Bytes())
+
+		if err != nil {
+			t.Fatalf("StripEXIF() wrote an invalid WebP file, error = %v", err)
+		}
+
+		if flags := chunks[1].data[0]; flags != wantFlags {
+			t.Errorf("StripEXIF() VP8X flags = %#x, want %#x", flags, wantFlags)
+		}
+	}
+}
+
+func TestStripEXIF_Unchanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{name: "Copies other formats unchanged", content: []byte("GIF89a not stripped")},
+		{name: "Error if a JPEG segment is truncated", content: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x40, 'E'}, wantErr: true},
+		{name: "Error if a PNG chunk is truncated", content: append(append([]byte{}, pngMagic...), 0x00, 0x00, 0x10, 0x00, 'e', 'X', 'I', 'f'), wantErr: true},
+		{name: "Error for TIFF images", content: []byte("II*\x00\x08\x00\x00\x00 GPS"), wantErr: true},
+		{name: "Error for HEIC images", content: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00 GPS"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped := &bytes.Buffer{}
+			err := StripEXIF(bytes.NewReader(tt.content), stripped)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StripEXIF() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !bytes.Equal(stripped.Bytes(), tt.content) {
+				t.Errorf("StripEXIF() got = %q, want %q", stripped.Bytes(), tt.content)
+			}
+		})
+	}
+}
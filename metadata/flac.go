@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// The FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// ParseFLAC reads the STREAMINFO, VORBIS_COMMENT and PICTURE metadata blocks of a FLAC file
+func ParseFLAC(reader io.ReadSeeker, size int64) (*persistence.AudioMetadata, *Picture, error) {
+	if _, err := reader.Seek(4, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	result := &persistence.AudioMetadata{Codec: "flac"}
+	var picture *Picture
+	var samples int64
+	offset, found := int64(4), false
+
+	for last := false; !last; {
+		header := make([]byte, 4)
+
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, nil, InvalidFormatError{Message: "The FLAC metadata is truncated"}
+		}
+
+		last = header[0]&0x80 != 0
+		kind := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		offset += 4 + length
+
+		if offset > size {
+			return nil, nil, InvalidFormatError{Message: "The FLAC metadata block is truncated"}
+		}
+
+		if kind != flacStreamInfo && kind != flacVorbisComment && kind != flacPicture {
+			if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+
+			continue
+		}
+
+		data := make([]byte, length)
+
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, nil, InvalidFormatError{Message: "The FLAC metadata block is truncated"}
+		}
+
+		switch kind {
+		case flacStreamInfo:
+			if length < 18 {
+				return nil, nil, InvalidFormatError{Message: "The FLAC STREAMINFO block is too short"}
+			}
+
+			// the sample rate, the channels, the bits per sample and the total samples share 64 bits
+			packed := binary.BigEndian.Uint64(data[10:18])
+			result.SampleRate = int(packed >> 44)
+			result.Channels = int(packed>>41&0x7) + 1
+			samples = int64(packed & 0xFFFFFFFFF)
+			found = true
+		case flacVorbisComment:
+			if cover := parseVorbisComment(data, result); cover != nil && picture == nil {
+				picture = cover
+			}
+		case flacPicture:
+			if candidate, pictureType := parseFLACPicture(data); candidate != nil && (picture == nil || pictureType == frontCover) {
+				picture = candidate
+			}
+		}
+	}
+
+	if !found || result.SampleRate == 0 {
+		return nil, nil, InvalidFormatError{Message: "The FLAC file does not have a STREAMINFO block"}
+	}
+
+	result.Duration = float64(samples) / float64(result.SampleRate)
+	result.Bitrate = averageBitrate(size-offset, result.Duration)
+
+	return result, picture, nil
+}
+
+// parseFLACPicture returns the picture of a FLAC PICTURE block and its picture type, the block is also
+// used by the METADATA_BLOCK_PICTURE comment of Ogg files
+func parseFLACPicture(data []byte) (*Picture, uint32) {
+	field := func(offset int) ([]byte, int, bool) {
+		if offset+4 > len(data) {
+			return nil, 0, false
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		end := offset + 4 + length
+
+		if length < 0 || end > len(data) || end < offset {
+			return nil, 0, false
+		}
+
+		return data[offset+4 : end], end, true
+	}
+
+	if len(data) < 4 {
+		return nil, 0
+	}
+
+	pictureType := binary.BigEndian.Uint32(data)
+	mimeType, offset, ok := field(4)
+
+	if !ok {
+		return nil, 0
+	}
+
+	// the description is followed by the width, the height, the color depth and the amount of colors
+	if _, offset, ok = field(offset); !ok {
+		return nil, 0
+	}
+
+	content, _, ok := field(offset + 16)
+
+	if !ok || len(content) == 0 {
+		return nil, 0
+	}
+
+	return &Picture{MIMEType: string(mimeType), Data: append([]byte{}, content...)}, pictureType
+}
+
+// parseVorbisComment reads the TITLE, ARTIST and ALBUM comments of FLAC and Ogg files and returns the picture
+// of the METADATA_BLOCK_PICTURE comments, preferring the front cover
+func parseVorbisComment(data []byte, result *persistence.AudioMetadata) *Picture {
+	read := func(offset int) (string, int, bool) {
+		if offset+4 > len(data) {
+			return "", 0, false
+		}
+
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		end := offset + 4 + length
+
+		if length < 0 || end > len(data) || end < offset {
+			return "", 0, false
+		}
+
+		return string(data[offset+4 : end]), end, true
+	}
+
+	// the vendor string precedes the comments
+	_, offset, ok := read(0)
+
+	if !ok || offset+4 > len(data) {
+		return nil
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[offset:]))
+	offset += 4
+	var picture *Picture
+
+	for index := 0; index < count; index++ {
+		var comment string
+
+		if comment, offset, ok = read(offset); !ok {
+			break
+		}
+
+		separator := strings.IndexByte(comment, '=')
+
+		if separator < 0 {
+			continue
+		}
+
+		value := strings.TrimSpace(comment[separator+1:])
+
+		switch strings.ToUpper(comment[:separator]) {
+		case "TITLE":
+			result.Title = value
+		case "ARTIST":
+			result.Artist = value
+		case "ALBUM":
+			result.Album = value
+		case "METADATA_BLOCK_PICTURE":
+			block, err := base64.StdEncoding.DecodeString(value)
+
+			if err != nil {
+				continue
+			}
+
+			if candidate, pictureType := parseFLACPicture(block); candidate != nil && (picture == nil || pictureType == frontCover) {
+				picture = candidate
+			}
+		}
+	}
+
+	return picture
+}
@@ -0,0 +1,160 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	// registers the decoders used by image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ParseImage reads the size, the color model and the EXIF orientation of a JPEG, PNG, GIF or WebP image,
+// the whole image is read into memory because WebP files usually store their EXIF at the end
+func ParseImage(reader io.Reader) (*persistence.ImageMetadata, error) {
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &persistence.ImageMetadata{Orientation: 1}
+
+	if isWebP(content) {
+		result.Width, result.Height, result.ColorModel, err = parseWebPConfig(content)
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		config, _, err := image.DecodeConfig(bytes.NewReader(content))
+
+		if err != nil {
+			return nil, InvalidFormatError{Message: "The image format is not supported or the image is corrupted"}
+		}
+
+		result.Width, result.Height, result.ColorModel = config.Width, config.Height, colorModelName(config.ColorModel)
+	}
+
+	tiff, err := findEXIF(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if orientation := parseOrientation(tiff); orientation > 0 {
+		result.Orientation = orientation
+	}
+
+	return result, nil
+}
+
+// colorModelName returns the name of the standard library color models
+func colorModelName(model color.Model) string {
+	if _, ok := model.(color.Palette); ok {
+		return "paletted"
+	}
+
+	switch model {
+	case color.RGBAModel:
+		return "rgba"
+	case color.RGBA64Model:
+		return "rgba64"
+	case color.NRGBAModel:
+		return "nrgba"
+	case color.NRGBA64Model:
+		return "nrgba64"
+	case color.AlphaModel:
+		return "alpha"
+	case color.Alpha16Model:
+		return "alpha16"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	case color.CMYKModel:
+		return "cmyk"
+	case color.YCbCrModel:
+		return "ycbcr"
+	case color.NYCbCrAModel:
+		return "nycbcra"
+	}
+
+	return "unknown"
+}
+
+func isWebP(content []byte) bool {
+	return len(content) >= 12 && string(content[:4]) == "RIFF" && string(content[8:12]) == "WEBP"
+}
+
+// parseWebPConfig reads the canvas size of a WebP image, the color models are the ones of the
+// golang.org/x/image/webp decoder
+func parseWebPConfig(content []byte) (int, int, string, error) {
+	chunks, err := webpChunks(content)
+
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	var width, height int
+	var alpha, lossless, extended bool
+
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "VP8X":
+			if len(chunk.data) < 10 {
+				return 0, 0, "", InvalidFormatError{Message: "The WebP VP8X chunk is too short"}
+			}
+
+			extended = true
+			alpha = chunk.data[0]&webpAlphaFlag != 0
+			width = int(uint24(chunk.data[4:7])) + 1
+			height = int(uint24(chunk.data[7:10])) + 1
+		case "VP8 ":
+			if len(chunk.data) < 10 || !bytes.Equal(chunk.data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+				return 0, 0, "", InvalidFormatError{Message: "The WebP VP8 frame header is invalid"}
+			}
+
+			if !extended {
+				width = int(binary.LittleEndian.Uint16(chunk.data[6:8]) & 0x3FFF)
+				height = int(binary.LittleEndian.Uint16(chunk.data[8:10]) & 0x3FFF)
+			}
+		case "VP8L":
+			if len(chunk.data) < 5 || chunk.data[0] != 0x2F {
+				return 0, 0, "", InvalidFormatError{Message: "The WebP VP8L header is invalid"}
+			}
+
+			lossless = true
+
+			if !extended {
+				bits := binary.LittleEndian.Uint32(chunk.data[1:5])
+				width = int(bits&0x3FFF) + 1
+				height = int(bits>>14&0x3FFF) + 1
+			}
+		}
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, "", InvalidFormatError{Message: "The WebP image does not have a frame"}
+	}
+
+	switch {
+	case lossless:
+		return width, height, "nrgba", nil
+	case alpha:
+		return width, height, "nycbcra", nil
+	}
+
+	return width, height, "ycbcr", nil
+}
+
+func uint24(data []byte) uint32 {
+	return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+}
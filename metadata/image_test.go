@@ -0,0 +1,214 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// newEXIF returns a little endian TIFF structure with the orientation and a GPS IFD
+func newEXIF(orientation int) []byte {
+	tiff := make([]byte, 56)
+	copy(tiff, "II\x2A\x00")
+	binary.LittleEndian.PutUint32(tiff[4:], 8)
+	binary.LittleEndian.PutUint16(tiff[8:], 2)
+	binary.LittleEndian.PutUint16(tiff[10:], orientationTag)
+	binary.LittleEndian.PutUint16(tiff[12:], 3)
+	binary.LittleEndian.PutUint32(tiff[14:], 1)
+	binary.LittleEndian.PutUint16(tiff[18:], uint16(orientation))
+	binary.LittleEndian.PutUint16(tiff[22:], 0x8825)
+	binary.LittleEndian.PutUint16(tiff[24:], 4)
+	binary.LittleEndian.PutUint32(tiff[26:], 1)
+	binary.LittleEndian.PutUint32(tiff[30:], 38)
+	binary.LittleEndian.PutUint16(tiff[38:], 1)
+	binary.LittleEndian.PutUint16(tiff[40:], 0x0001)
+	binary.LittleEndian.PutUint16(tiff[42:], 2)
+	binary.LittleEndian.PutUint32(tiff[44:], 2)
+	copy(tiff[48:], "N")
+
+	return append(tiff, "GPS-SECRET"...)
+}
+
+func newTestImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 6, 4))
+
+	for index := range img.Pix {
+		img.Pix[index] = 0xFF
+	}
+
+	return img
+}
+
+// newJPEG returns a JPEG image with an EXIF and a comment segment after the start of image
+func newJPEG(orientation int) []byte {
+	buffer := &bytes.Buffer{}
+	_ = jpeg.Encode(buffer, newTestImage(), nil)
+	content := buffer.Bytes()
+
+	segments := jpegFormat.orientation(newEXIF(orientation))
+	segments = append(segments, 0xFF, 0xFE, 0x00, 0x0C)
+	segments = append(segments, "John Doe"...)
+	segments = append(segments, "!!"...)
+
+	return append(append(append([]byte{}, content[:2]...), segments...), content[2:]...)
+}
+
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, kind...), data...)
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(chunk[4:]))
+
+	return append(chunk, checksum...)
+}
+
+// newPNG returns a PNG image with an eXIf and a tEXt chunk after the IHDR chunk
+func newPNG(orientation int) []byte {
+	buffer := &bytes.Buffer{}
+	_ = png.Encode(buffer, newTestImage())
+	content := buffer.Bytes()
+	// the signature and the IHDR chunk
+	header := len(pngMagic) + 25
+
+	chunks := append(pngChunk("eXIf", newEXIF(orientation)), pngChunk("tEXt", []byte("Author\x00John Doe"))...)
+
+	return append(append(append([]byte{}, content[:header]...), chunks...), content[header:]...)
+}
+
+func webpChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 8)
+	copy(chunk, kind)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+
+	return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	content := []byte("RIFF\x00\x00\x00\x00WEBP")
+
+	for _, chunk := range chunks {
+		content = append(content, chunk...)
+	}
+
+	binary.LittleEndian.PutUint32(content[4:], uint32(len(content)-8))
+
+	return content
+}
+
+func vp8x(flags byte, width, height int) []byte {
+	data := make([]byte, 10)
+	data[0] = flags
+	data[4], data[5], data[6] = byte(width-1), byte((width-1)>>8), byte((width-1)>>16)
+	data[7], data[8], data[9] = byte(height-1), byte((height-1)>>8), byte((height-1)>>16)
+
+	return webpChunk("VP8X", data)
+}
+
+func vp8l(width, height int) []byte {
+	data := make([]byte, 9)
+	data[0] = 0x2F
+	binary.LittleEndian.PutUint32(data[1:], uint32(width-1)|uint32(height-1)<<14)
+
+	return webpChunk("VP8L", data)
+}
+
+func vp8(width, height int) []byte {
+	data := []byte{0x10, 0x02, 0x00, 0x9D, 0x01, 0x2A, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(data[6:], uint16(width))
+	binary.LittleEndian.PutUint16(data[8:], uint16(height))
+
+	return webpChunk("VP8 ", data)
+}
+
+// newWebP returns an extended lossless WebP image with an EXIF and a XMP chunk after the frame
+func newWebP(orientation int) []byte {
+	return webpFile(
+		vp8x(webpEXIFFlag|webpXMPFlag, 300, 200),
+		vp8l(300, 200),
+		webpChunk("EXIF", newEXIF(orientation)),
+		webpChunk("XMP ", []byte("<x:xmpmeta>John Doe</x:xmpmeta>")),
+	)
+}
+
+func TestParseImage(t *testing.T) {
+	paletted := &bytes.Buffer{}
+	_ = gif.Encode(paletted, image.NewPaletted(image.Rect(0, 0, 3, 5), color.Palette{color.Black, color.White}), nil)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    *persistence.ImageMetadata
+		wantErr bool
+	}{
+		{
+			name:    "Parses a JPEG image with EXIF",
+			content: newJPEG(6),
+			want:    &persistence.ImageMetadata{Width: 6, Height: 4, Orientation: 6, ColorModel: "ycbcr"},
+		},
+		{
+			name:    "Parses a PNG image with EXIF",
+			content: newPNG(3),
+			want:    &persistence.ImageMetadata{Width: 6, Height: 4, Orientation: 3, ColorModel: "rgba"},
+		},
+		{
+			name:    "Parses a GIF image without EXIF",
+			content: paletted.Bytes(),
+			want:    &persistence.ImageMetadata{Width: 3, Height: 5, Orientation: 1, ColorModel: "paletted"},
+		},
+		{
+			name:    "Parses an extended WebP image",
+			content: newWebP(8),
+			want:    &persistence.ImageMetadata{Width: 300, Height: 200, Orientation: 8, ColorModel: "nrgba"},
+		},
+		{
+			name:    "Parses a simple lossy WebP image",
+			content: webpFile(vp8(640, 480)),
+			want:    &persistence.ImageMetadata{Width: 640, Height: 480, Orientation: 1, ColorModel: "ycbcr"},
+		},
+		{
+			name:    "Ignores invalid orientations",
+			content: newJPEG(12),
+			want:    &persistence.ImageMetadata{Width: 6, Height: 4, Orientation: 1, ColorModel: "ycbcr"},
+		},
+		{
+			name:    "Error if the image format is not supported",
+			content: []byte("BM not a supported image"),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the WebP image does not have a frame",
+			content: webpFile(webpChunk("EXIF", newEXIF(1))),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImage(bytes.NewReader(tt.content))
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseImage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseImage() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// mp3SyncWindow limits the bytes scanned for the first MPEG audio frame after the tags
+const mp3SyncWindow = 64 << 10
+
+// The bitrates in kbps by MPEG version and layer, the first index is the free format
+var (
+	mpeg1Bitrates = [3][15]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	}
+	mpeg2Bitrates = [3][15]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mpegSampleRates = map[int][3]int{
+		1:  {44100, 48000, 32000},
+		2:  {22050, 24000, 16000},
+		25: {11025, 12000, 8000},
+	}
+)
+
+// mpegFrame is the header of a MPEG audio frame, version 25 is MPEG 2.5
+type mpegFrame struct {
+	version    int
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	samples    int
+	length     int
+}
+
+// parseMPEGHeader returns false when the bytes are not a valid frame header
+func parseMPEGHeader(header []byte) (*mpegFrame, bool) {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return nil, false
+	}
+
+	frame := &mpegFrame{channels: 2}
+
+	switch (header[1] >> 3) & 3 {
+	case 0:
+		frame.version = 25
+	case 2:
+		frame.version = 2
+	case 3:
+		frame.version = 1
+	default:
+		return nil, false
+	}
+
+	frame.layer = 4 - int((header[1]>>1)&3)
+	bitrateIndex, sampleRateIndex := int(header[2]>>4), int((header[2]>>2)&3)
+
+	if frame.layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, false
+	}
+
+	if frame.version == 1 {
+		frame.bitrate = mpeg1Bitrates[frame.layer-1][bitrateIndex] * 1000
+	} else {
+		frame.bitrate = mpeg2Bitrates[frame.layer-1][bitrateIndex] * 1000
+	}
+
+	frame.sampleRate = mpegSampleRates[frame.version][sampleRateIndex]
+	padding := int((header[2] >> 1) & 1)
+
+	if header[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	switch {
+	case frame.layer == 1:
+		frame.samples = 384
+		frame.length = (12*frame.bitrate/frame.sampleRate + padding) * 4
+	case frame.layer == 3 && frame.version != 1:
+		frame.samples = 576
+		frame.length = 72*frame.bitrate/frame.sampleRate + padding
+	default:
+		frame.samples = 1152
+		frame.length = 144*frame.bitrate/frame.sampleRate + padding
+	}
+
+	return frame, true
+}
+
+// sideInfoLength returns the length of the layer III side information that precedes the Xing header
+func (frame *mpegFrame) sideInfoLength() int {
+	switch {
+	case frame.version == 1 && frame.channels == 1:
+		return 17
+	case frame.version == 1:
+		return 32
+	case frame.channels == 1:
+		return 9
+	}
+
+	return 17
+}
+
+// ParseMP3 reads the ID3 tags and the first MPEG audio frame, the duration comes from the Xing or VBRI header
+// of the variable bitrate files and from the bitrate of the constant bitrate files
+func ParseMP3(reader io.ReadSeeker, size int64) (*persistence.AudioMetadata, *Picture, error) {
+	result := &persistence.AudioMetadata{}
+	var picture *Picture
+	var audioStart int64
+	header := make([]byte, 10)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, nil, InvalidFormatError{Message: "The MP3 file is too short to be parsed"}
+	}
+
+	if string(header[:3]) == "ID3" {
+		length := int64(syncsafe(header[6:10]))
+		audioStart = 10 + length
+
+		// the footer repeats the header at the end of the tag
+		if header[5]&0x10 != 0 {
+			audioStart += 10
+		}
+
+		if length > maxTagSize || audioStart > size {
+			return nil, nil, InvalidFormatError{Message: "The ID3 tag size is invalid"}
+		}
+
+		body := make([]byte, length)
+
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, nil, InvalidFormatError{Message: "The ID3 tag is truncated"}
+		}
+
+		picture = parseID3v2(header[3], header[5], body, result)
+	}
+
+	audioEnd := size
+
+	if size-audioStart >= 128 {
+		if _, err := reader.Seek(size-128, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+
+		tag := make([]byte, 128)
+
+		if _, err := io.ReadFull(reader, tag); err == nil && string(tag[:3]) == "TAG" {
+			audioEnd -= 128
+			parseID3v1(tag, result)
+		}
+	}
+
+	if _, err := reader.Seek(audioStart, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	window := make([]byte, mp3SyncWindow)
+	read, err := io.ReadFull(reader, window)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, err
+	}
+
+	window = window[:read]
+	offset, frame := findMPEGFrame(window)
+
+	if frame == nil {
+		return nil, nil, InvalidFormatError{Message: "The MP3 file does not have audio frames"}
+	}
+
+	result.Codec = []string{"", "mp1", "mp2", "mp3"}[frame.layer]
+	result.SampleRate = frame.sampleRate
+	result.Channels = frame.channels
+	audioBytes := audioEnd - audioStart - int64(offset)
+
+	if frames, length, ok := parseVBRHeader(window[offset:], frame); ok && frames > 0 {
+		result.Duration = float64(frames) * float64(frame.samples) / float64(frame.sampleRate)
+
+		if length > 0 {
+			audioBytes = length
+		}
+
+		result.Bitrate = averageBitrate(audioBytes, result.Duration)
+
+		return result, picture, nil
+	}
+
+	result.Bitrate = frame.bitrate
+	result.Duration = float64(audioBytes*8) / float64(frame.bitrate)
+
+	return result, picture, nil
+}
+
+// findMPEGFrame returns the first frame header that is followed by another frame header or by the end of the data
+func findMPEGFrame(data []byte) (int, *mpegFrame) {
+	for offset := 0; offset+4 <= len(data); offset++ {
+		frame, ok := parseMPEGHeader(data[offset:])
+
+		if !ok {
+			continue
+		}
+
+		next := offset + frame.length
+
+		if next+4 > len(data) {
+			return offset, frame
+		}
+
+		if following, ok := parseMPEGHeader(data[next:]); ok && following.version == frame.version && following.layer == frame.layer {
+			return offset, frame
+		}
+	}
+
+	return 0, nil
+}
+
+// parseVBRHeader reads the amount of frames and bytes of the Xing, Info or VBRI header of the first frame
+func parseVBRHeader(data []byte, frame *mpegFrame) (int64, int64, bool) {
+	xing := 4 + frame.sideInfoLength()
+
+	if xing+8 <= len(data) && (string(data[xing:xing+4]) == "Xing" || string(data[xing:xing+4]) == "Info") {
+		flags := binary.BigEndian.Uint32(data[xing+4:])
+		position := xing + 8
+		var frames, length int64
+
+		if flags&1 != 0 && position+4 <= len(data) {
+			frames = int64(binary.BigEndian.Uint32(data[position:]))
+			position += 4
+		}
+
+		if flags&2 != 0 && position+4 <= len(data) {
+			length = int64(binary.BigEndian.Uint32(data[position:]))
+		}
+
+		return frames, length, true
+	}
+
+	if vbri := 36; vbri+18 <= len(data) && string(data[vbri:vbri+4]) == "VBRI" {
+		return int64(binary.BigEndian.Uint32(data[vbri+14:])), int64(binary.BigEndian.Uint32(data[vbri+10:])), true
+	}
+
+	return 0, 0, false
+}
+
+func syncsafe(data []byte) uint32 {
+	return uint32(data[0]&0x7F)<<21 | uint32(data[1]&0x7F)<<14 | uint32(data[2]&0x7F)<<7 | uint32(data[3]&0x7F)
+}
+
+// removeUnsynchronisation restores the 0xFF bytes that were followed by a zero byte to avoid false frame syncs
+func removeUnsynchronisation(data []byte) []byte {
+	return bytes.Replace(data, []byte{0xFF, 0x00}, []byte{0xFF}, -1)
+}
+
+// parseID3v2 reads the text frames and the pictures of the versions 2.2, 2.3 and 2.4
+func parseID3v2(version, flags byte, body []byte, result *persistence.AudioMetadata) *Picture {
+	if version < 2 || version > 4 {
+		return nil
+	}
+
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsynchronisation(body)
+	}
+
+	offset := 0
+
+	// the extended header is skipped
+	if flags&0x40 != 0 && version > 2 && len(body) >= 4 {
+		if version == 3 {
+			offset = 4 + int(binary.BigEndian.Uint32(body))
+		} else {
+			offset = int(syncsafe(body))
+		}
+	}
+
+	idLength, headerLength := 4, 10
+
+	if version == 2 {
+		idLength, headerLength = 3, 6
+	}
+
+	var picture *Picture
+
+	for offset >= 0 && offset+headerLength <= len(body) {
+		ID := string(body[offset : offset+idLength])
+
+		// the padding starts with a zero byte
+		if body[offset] == 0 {
+			break
+		}
+
+		var length int
+		var formatFlags byte
+
+		switch version {
+		case 2:
+			length = int(body[offset+3])<<16 | int(body[offset+4])<<8 | int(body[offset+5])
+		case 3:
+			length = int(binary.BigEndian.Uint32(body[offset+4:]))
+			formatFlags = body[offset+9]
+		default:
+			length = int(syncsafe(body[offset+4:]))
+			formatFlags = body[offset+9]
+		}
+
+		start := offset + headerLength
+
+		if length < 0 || start+length > len(body) {
+			break
+		}
+
+		data := body[start : start+length]
+		offset = start + length
+
+		if data = id3FrameData(version, formatFlags, data); data == nil {
+			continue
+		}
+
+		switch ID {
+		case "TIT2", "TT2":
+			result.Title = id3Text(data)
+		case "TPE1", "TP1":
+			result.Artist = id3Text(data)
+		case "TALB", "TAL":
+			result.Album = id3Text(data)
+		case "APIC", "PIC":
+			if candidate, pictureType := id3Picture(version, data); candidate != nil && (picture == nil || pictureType == frontCover) {
+				picture = candidate
+			}
+		}
+	}
+
+	return picture
+}
+
+// id3FrameData removes the frame headers of the format flags, the compressed and encrypted frames are nil
+func id3FrameData(version, flags byte, data []byte) []byte {
+	switch version {
+	case 3:
+		if flags&0xC0 != 0 {
+			return nil
+		}
+
+		if flags&0x20 != 0 && len(data) > 0 {
+			data = data[1:]
+		}
+	case 4:
+		if flags&0x0C != 0 {
+			return nil
+		}
+
+		if flags&0x40 != 0 && len(data) > 0 {
+			data = data[1:]
+		}
+
+		if flags&0x01 != 0 && len(data) >= 4 {
+			data = data[4:]
+		}
+
+		if flags&0x02 != 0 {
+			data = removeUnsynchronisation(data)
+		}
+	}
+
+	return data
+}
+
+// id3Text returns the first value of a text frame
+func id3Text(data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+
+	value, _ := splitTerminated(data[0], data[1:])
+
+	return strings.TrimSpace(decodeText(data[0], value))
+}
+
+// id3Picture returns the picture of an APIC frame, or a PIC frame in version 2.2, and its picture type
+func id3Picture(version byte, data []byte) (*Picture, byte) {
+	if len(data) < 2 {
+		return nil, 0
+	}
+
+	encoding := data[0]
+	var mimeType string
+	rest := data[1:]
+
+	if version == 2 {
+		if len(rest) < 3 {
+			return nil, 0
+		}
+
+		mimeType = "image/" + strings.ToLower(string(rest[:3]))
+		rest = rest[3:]
+
+		if mimeType == "image/jpg" {
+			mimeType = "image/jpeg"
+		}
+	} else {
+		var value []byte
+		value, rest = splitTerminated(0, rest)
+		mimeType = string(value)
+	}
+
+	if len(rest) < 1 {
+		return nil, 0
+	}
+
+	pictureType := rest[0]
+	_, rest = splitTerminated(encoding, rest[1:])
+
+	if len(rest) == 0 {
+		return nil, 0
+	}
+
+	return &Picture{MIMEType: mimeType, Data: append([]byte{}, rest...)}, pictureType
+}
+
+// parseID3v1 fills the empty fields with the values of the ID3v1 tag at the end of the file
+func parseID3v1(tag []byte, result *persistence.AudioMetadata) {
+	field := func(start, end int) string {
+		return strings.TrimSpace(decodeText(0, bytes.TrimRight(tag[start:end], "\x00")))
+	}
+
+	if result.Title == "" {
+		result.Title = field(3, 33)
+	}
+
+	if result.Artist == "" {
+		result.Artist = field(33, 63)
+	}
+
+	if result.Album == "" {
+		result.Album = field(63, 93)
+	}
+}
@@ -0,0 +1,199 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// oggTailWindow is read from the end of the file to find the granule position of the last page, it is larger
+// than the maximum size of a page
+const oggTailWindow = 128 << 10
+
+// oggReader reassembles the packets of the first logical stream of an Ogg file
+type oggReader struct {
+	reader  io.Reader
+	serial  uint32
+	started bool
+	packets [][]byte
+	partial []byte
+}
+
+// readPage appends the packets completed by the next page of the stream
+func (ogg *oggReader) readPage() error {
+	header := make([]byte, 27)
+
+	if _, err := io.ReadFull(ogg.reader, header); err != nil {
+		return InvalidFormatError{Message: "The Ogg page is truncated"}
+	}
+
+	if string(header[:4]) != "OggS" {
+		return InvalidFormatError{Message: "The Ogg page does not have a capture pattern"}
+	}
+
+	lacing := make([]byte, header[26])
+
+	if _, err := io.ReadFull(ogg.reader, lacing); err != nil {
+		return InvalidFormatError{Message: "The Ogg page is truncated"}
+	}
+
+	length := 0
+
+	for _, segment := range lacing {
+		length += int(segment)
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(ogg.reader, body); err != nil {
+		return InvalidFormatError{Message: "The Ogg page is truncated"}
+	}
+
+	serial := binary.LittleEndian.Uint32(header[14:18])
+
+	if !ogg.started {
+		ogg.serial, ogg.started = serial, true
+	}
+
+	// the pages of the other multiplexed streams are skipped
+	if serial != ogg.serial {
+		return nil
+	}
+
+	offset := 0
+
+	for _, segment := range lacing {
+		ogg.partial = append(ogg.partial, body[offset:offset+int(segment)]...)
+		offset += int(segment)
+
+		if segment < 255 {
+			ogg.packets = append(ogg.packets, ogg.partial)
+			ogg.partial = nil
+		}
+
+		if len(ogg.partial) > maxTagSize {
+			return InvalidFormatError{Message: "The Ogg packet is too large"}
+		}
+	}
+
+	return nil
+}
+
+// packet returns the next complete packet of the stream
+func (ogg *oggReader) packet() ([]byte, error) {
+	for len(ogg.packets) == 0 {
+		if err := ogg.readPage(); err != nil {
+			return nil, err
+		}
+	}
+
+	packet := ogg.packets[0]
+	ogg.packets = ogg.packets[1:]
+
+	return packet, nil
+}
+
+// ParseOgg reads the identification and comment headers of an Ogg Vorbis or Opus file, the duration comes from
+// the granule position of the last page
+func ParseOgg(reader io.ReadSeeker, size int64) (*persistence.AudioMetadata, *Picture, error) {
+	ogg := &oggReader{reader: reader}
+	identification, err := ogg.packet()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &persistence.AudioMetadata{}
+	var commentPrefix []byte
+	var preSkip int64
+	rate := 0
+
+	switch {
+	case len(identification) >= 30 && bytes.HasPrefix(identification, []byte("\x01vorbis")):
+		result.Codec = "vorbis"
+		result.Channels = int(identification[11])
+		result.SampleRate = int(binary.LittleEndian.Uint32(identification[12:]))
+		rate = result.SampleRate
+		commentPrefix = []byte("\x03vorbis")
+	case len(identification) >= 19 && bytes.HasPrefix(identification, []byte("OpusHead")):
+		result.Codec = "opus"
+		result.Channels = int(identification[9])
+		preSkip = int64(binary.LittleEndian.Uint16(identification[10:]))
+		// the input sample rate is informative, Opus always decodes at 48 kHz
+		result.SampleRate = int(binary.LittleEndian.Uint32(identification[12:]))
+		rate = 48000
+
+		if result.SampleRate == 0 {
+			result.SampleRate = rate
+		}
+
+		commentPrefix = []byte("OpusTags")
+	default:
+		return nil, nil, InvalidFormatError{Message: "Unsupported Ogg codec, only Vorbis and Opus are supported"}
+	}
+
+	if rate == 0 {
+		return nil, nil, InvalidFormatError{Message: "The Ogg stream does not have a sample rate"}
+	}
+
+	var picture *Picture
+
+	if comment, err := ogg.packet(); err == nil && bytes.HasPrefix(comment, commentPrefix) {
+		picture = parseVorbisComment(comment[len(commentPrefix):], result)
+	}
+
+	granule, err := lastGranule(reader, size, ogg.serial)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if granule -= preSkip; granule > 0 {
+		result.Duration = float64(granule) / float64(rate)
+		result.Bitrate = averageBitrate(size, result.Duration)
+	}
+
+	return result, picture, nil
+}
+
+// lastGranule returns the granule position of the last page of the stream
+func lastGranule(reader io.ReadSeeker, size int64, serial uint32) (int64, error) {
+	start := size - oggTailWindow
+
+	if start < 0 {
+		start = 0
+	}
+
+	if _, err := reader.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	tail := make([]byte, size-start)
+
+	if _, err := io.ReadFull(reader, tail); err != nil {
+		return 0, err
+	}
+
+	for end := len(tail); end > 0; {
+		index := bytes.LastIndex(tail[:end], []byte("OggS"))
+
+		if index < 0 {
+			break
+		}
+
+		end = index
+
+		if index+27 > len(tail) || binary.LittleEndian.Uint32(tail[index+14:]) != serial {
+			continue
+		}
+
+		// the pages without finished packets have a granule position of -1
+		if granule := int64(binary.LittleEndian.Uint64(tail[index+6:])); granule >= 0 {
+			return granule, nil
+		}
+	}
+
+	return 0, InvalidFormatError{Message: "The Ogg stream does not have a granule position"}
+}
@@ -0,0 +1,758 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// PasswordProtectedError is returned when a PDF document can not be opened without a password
+type PasswordProtectedError struct {
+	Message string
+}
+
+func (err PasswordProtectedError) Error() string {
+	return err.Message
+}
+
+// maxPageTreeDepth limits the page tree traversal when the /Count of a node is missing
+const maxPageTreeDepth = 64
+
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []interface{}
+	pdfDict   map[pdfName]interface{}
+)
+
+type pdfRef struct {
+	number     int
+	generation int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// pdfObject is an indirect object, the objects of the object streams are compressed
+type pdfObject struct {
+	value      interface{}
+	ref        pdfRef
+	compressed bool
+}
+
+// pdfDocument holds the indirect objects and the trailer of a PDF file
+type pdfDocument struct {
+	objects   map[int]*pdfObject
+	trailer   pdfDict
+	decrypter *pdfDecrypter
+}
+
+var (
+	objectHeader  = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj\b`)
+	trailerHeader = regexp.MustCompile(`trailer[\x00\t\n\f\r ]*<<`)
+)
+
+// ParsePDF reads the page count, the title, the author and the encryption of a PDF document. The objects are
+// found by scanning the file so documents with a broken cross-reference table are supported, documents that
+// need a user password return a PasswordProtectedError
+func ParsePDF(reader io.Reader) (*persistence.DocumentMetadata, error) {
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if header := bytes.Index(content, []byte("%PDF-")); header < 0 || header > 1024 {
+		return nil, InvalidFormatError{Message: "The file does not have a PDF header"}
+	}
+
+	document := scanPDF(content)
+
+	if len(document.objects) == 0 {
+		return nil, InvalidFormatError{Message: "The PDF document does not have objects"}
+	}
+
+	result := &persistence.DocumentMetadata{}
+
+	if encrypt := document.resolve(document.trailer["Encrypt"]); encrypt != nil {
+		dict, ok := encrypt.(pdfDict)
+
+		if !ok {
+			return nil, InvalidFormatError{Message: "The PDF encryption dictionary is invalid"}
+		}
+
+		if document.decrypter, err = newPDFDecrypter(dict, document.fileID()); err != nil {
+			return nil, err
+		}
+
+		result.Encrypted = true
+	}
+
+	document.expandObjectStreams()
+
+	root, ok := document.resolve(document.trailer["Root"]).(pdfDict)
+
+	if !ok {
+		return nil, InvalidFormatError{Message: "The PDF document does not have a catalog"}
+	}
+
+	pages, ok := document.resolve(root["Pages"]).(pdfDict)
+
+	if !ok {
+		return nil, InvalidFormatError{Message: "The PDF document does not have a page tree"}
+	}
+
+	result.Pages = document.countPages(pages, 0)
+
+	if result.Pages <= 0 {
+		return nil, InvalidFormatError{Message: "The PDF document does not have pages"}
+	}
+
+	if info, ok := document.resolve(document.trailer["Info"]).(pdfDict); ok {
+		result.Title = document.text(document.trailer["Info"], info["Title"])
+		result.Author = document.text(document.trailer["Info"], info["Author"])
+	}
+
+	return result, nil
+}
+
+// scanPDF collects the indirect objects in file order so the objects of the incremental updates replace the
+// previous ones, the trailers are merged the same way
+func scanPDF(content []byte) *pdfDocument {
+	document := &pdfDocument{objects: make(map[int]*pdfObject), trailer: pdfDict{}}
+	trailers := make(map[int]pdfDict)
+	position := 0
+
+	for position < len(content) {
+		match := objectHeader.FindSubmatchIndex(content[position:])
+
+		if match == nil {
+			break
+		}
+
+		start := position + match[0]
+
+		// the number must not be the end of a longer token
+		if start > 0 && !isPDFDelimiter(content[start-1]) && !isPDFSpace(content[start-1]) {
+			position = start + 1
+			continue
+		}
+
+		number, _ := strconv.Atoi(string(content[position+match[2] : position+match[3]]))
+		generation, _ := strconv.Atoi(string(content[position+match[4] : position+match[5]]))
+		parser := &pdfParser{data: content, position: position + match[1]}
+		value, err := parser.parseIndirect()
+
+		if err != nil {
+			position += match[1]
+			continue
+		}
+
+		document.objects[number] = &pdfObject{value: value, ref: pdfRef{number: number, generation: generation}}
+
+		if stream, ok := value.(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") {
+			trailers[start] = stream.dict
+		}
+
+		position = parser.position
+	}
+
+	for _, match := range trailerHeader.FindAllIndex(content, -1) {
+		parser := &pdfParser{data: content, position: match[1] - 2}
+
+		if dict, ok := parser.parseObjectOrNil().(pdfDict); ok {
+			trailers[match[0]] = dict
+		}
+	}
+
+	var positions []int
+
+	for position := range trailers {
+		positions = append(positions, position)
+	}
+
+	sort.Ints(positions)
+
+	for _, position := range positions {
+		for key, value := range trailers[position] {
+			document.trailer[key] = value
+		}
+	}
+
+	return document
+}
+
+// expandObjectStreams adds the objects of the object streams that are not defined outside of them
+func (document *pdfDocument) expandObjectStreams() {
+	var streams []*pdfObject
+
+	for _, object := range document.objects {
+		if stream, ok := object.value.(*pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, object)
+		}
+	}
+
+	for _, object := range streams {
+		stream := object.value.(*pdfStream)
+		data, err := document.streamData(object.ref, stream)
+
+		if err != nil {
+			continue
+		}
+
+		count, _ := document.resolve(stream.dict["N"]).(float64)
+		first, _ := document.resolve(stream.dict["First"]).(float64)
+
+		if int(first) > len(data) || first < 0 {
+			continue
+		}
+
+		header := &pdfParser{data: data[:int(first)]}
+
+		for index := 0; index < int(count); index++ {
+			number, ok := header.parseObjectOrNil().(float64)
+			offset, offsetOk := header.parseObjectOrNil().(float64)
+
+			if !ok || !offsetOk || int(first)+int(offset) >= len(data) {
+				break
+			}
+
+			if _, exists := document.objects[int(number)]; exists {
+				continue
+			}
+
+			parser := &pdfParser{data: data, position: int(first) + int(offset)}
+
+			if value, err := parser.parseObject(); err == nil {
+				document.objects[int(number)] = &pdfObject{value: value, ref: pdfRef{number: int(number)}, compressed: true}
+			}
+		}
+	}
+}
+
+// streamData returns the decrypted and decoded data of a stream, only FlateDecode is supported
+func (document *pdfDocument) streamData(ref pdfRef, stream *pdfStream) ([]byte, error) {
+	data := stream.data
+
+	if document.decrypter != nil {
+		var err error
+
+		if data, err = document.decrypter.decrypt(data, ref, document.decrypter.streamMethod); err != nil {
+			return nil, err
+		}
+	}
+
+	var filters []interface{}
+
+	switch filter := document.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{filter}
+	case pdfArray:
+		filters = filter
+	}
+
+	for _, filter := range filters {
+		if filter != pdfName("FlateDecode") {
+			return nil, InvalidFormatError{Message: "Unsupported PDF stream filter"}
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = ioutil.ReadAll(reader)
+
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// resolve returns the value of the references, missing objects are nil
+func (document *pdfDocument) resolve(value interface{}) interface{} {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := value.(pdfRef)
+
+		if !ok {
+			return value
+		}
+
+		object, ok := document.objects[ref.number]
+
+		if !ok {
+			return nil
+		}
+
+		value = object.value
+	}
+
+	return nil
+}
+
+// countPages returns the /Count of the page tree node or counts its leaves when it is missing
+func (document *pdfDocument) countPages(node pdfDict, depth int) int {
+	if count, ok := document.resolve(node["Count"]).(float64); ok && count > 0 {
+		return int(count)
+	}
+
+	if node["Type"] == pdfName("Page") {
+		return 1
+	}
+
+	kids, _ := document.resolve(node["Kids"]).(pdfArray)
+	count := 0
+
+	for _, kid := range kids {
+		if child, ok := document.resolve(kid).(pdfDict); ok && depth < maxPageTreeDepth {
+			count += document.countPages(child, depth+1)
+		}
+	}
+
+	return count
+}
+
+// fileID returns the first element of the /ID of the trailer
+func (document *pdfDocument) fileID() []byte {
+	if ID, ok := document.resolve(document.trailer["ID"]).(pdfArray); ok && len(ID) > 0 {
+		if first, ok := ID[0].(pdfString); ok {
+			return first
+		}
+	}
+
+	return nil
+}
+
+// text decodes a text string of the dictionary stored in the given object, the strings of
+// encrypted documents are decrypted unless the object is compressed
+func (document *pdfDocument) text(container interface{}, value interface{}) string {
+	raw, ok := document.resolve(value).(pdfString)
+
+	if !ok {
+		return ""
+	}
+
+	if ref, isRef := container.(pdfRef); isRef && document.decrypter != nil {
+		object := document.objects[ref.number]
+
+		if object == nil || object.compressed {
+			return decodePDFText(raw)
+		}
+
+		decrypted, err := document.decrypter.decrypt(raw, object.ref, document.decrypter.stringMethod)
+
+		if err != nil {
+			return ""
+		}
+
+		raw = decrypted
+	}
+
+	return decodePDFText(raw)
+}
+
+// decodePDFText decodes UTF-16BE and UTF-8 strings with a byte order mark, other strings are
+// decoded as Latin-1 which matches the printable characters of PDFDocEncoding
+func decodePDFText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+
+		for index := 2; index+1 < len(raw); index += 2 {
+			units = append(units, uint16(raw[index])<<8|uint16(raw[index+1]))
+		}
+
+		return string(utf16.Decode(units))
+	}
+
+	if bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}) {
+		return string(raw[3:])
+	}
+
+	runes := make([]rune, len(raw))
+
+	for index, character := range raw {
+		runes[index] = rune(character)
+	}
+
+	return string(runes)
+}
+
+// pdfParser reads the PDF objects of the data starting at position
+type pdfParser struct {
+	data     []byte
+	position int
+}
+
+func isPDFSpace(character byte) bool {
+	return character == 0 || character == '\t' || character == '\n' || character == '\f' || character == '\r' || character == ' '
+}
+
+func isPDFDelimiter(character byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), character) >= 0
+}
+
+func (parser *pdfParser) skipSpaces() {
+	for parser.position < len(parser.data) {
+		character := parser.data[parser.position]
+
+		if character == '%' {
+			for parser.position < len(parser.data) && parser.data[parser.position] != '\n' && parser.data[parser.position] != '\r' {
+				parser.position++
+			}
+
+			continue
+		}
+
+		if !isPDFSpace(character) {
+			return
+		}
+
+		parser.position++
+	}
+}
+
+// token returns the next regular token without consuming it
+func (parser *pdfParser) token() string {
+	parser.skipSpaces()
+	end := parser.position
+
+	for end < len(parser.data) && !isPDFSpace(parser.data[end]) && !isPDFDelimiter(parser.data[end]) {
+		end++
+	}
+
+	return string(parser.data[parser.position:end])
+}
+
+func (parser *pdfParser) parseObjectOrNil() interface{} {
+	value, err := parser.parseObject()
+
+	if err != nil {
+		return nil
+	}
+
+	return value
+}
+
+// parseIndirect parses the body of an indirect object after its "obj" keyword
+func (parser *pdfParser) parseIndirect() (interface{}, error) {
+	value, err := parser.parseObject()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dict, isDict := value.(pdfDict)
+
+	if parser.token() != "stream" || !isDict {
+		return value, nil
+	}
+
+	parser.position += len("stream")
+
+	if parser.position < len(parser.data) && parser.data[parser.position] == '\r' {
+		parser.position++
+	}
+
+	if parser.position < len(parser.data) && parser.data[parser.position] == '\n' {
+		parser.position++
+	}
+
+	start := parser.position
+	end := -1
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(parser.data) {
+		after := &pdfParser{data: parser.data, position: start + int(length)}
+
+		if after.token() == "endstream" {
+			end = start + int(length)
+		}
+	}
+
+	if end < 0 {
+		length := bytes.Index(parser.data[start:], []byte("endstream"))
+
+		if length < 0 {
+			return nil, InvalidFormatError{Message: "The PDF stream does not end"}
+		}
+
+		// the end of line before the keyword is not part of the data
+		end = start + len(bytes.TrimRight(parser.data[start:start+length], "\r\n"))
+	}
+
+	parser.position = end
+	parser.token()
+	parser.position += len("endstream")
+
+	return &pdfStream{dict: dict, data: parser.data[start:end]}, nil
+}
+
+func (parser *pdfParser) parseObject() (interface{}, error) {
+	parser.skipSpaces()
+
+	if parser.position >= len(parser.data) {
+		return nil, InvalidFormatError{Message: "Unexpected end of the PDF object"}
+	}
+
+	switch character := parser.data[parser.position]; {
+	case character == '/':
+		return parser.parseName(), nil
+	case character == '(':
+		return parser.parseLiteralString()
+	case character == '<' && parser.position+1 < len(parser.data) && parser.data[parser.position+1] == '<':
+		return parser.parseDict()
+	case character == '<':
+		return parser.parseHexString()
+	case character == '[':
+		return parser.parseArray()
+	case character == '+' || character == '-' || character == '.' || (character >= '0' && character <= '9'):
+		return parser.parseNumberOrRef()
+	}
+
+	switch token := parser.token(); token {
+	case "true", "false":
+		parser.position += len(token)
+
+		return token == "true", nil
+	case "null":
+		parser.position += len(token)
+
+		return nil, nil
+	}
+
+	return nil, InvalidFormatError{Message: "Unexpected PDF token"}
+}
+
+func (parser *pdfParser) parseName() pdfName {
+	parser.position++
+	name := &bytes.Buffer{}
+
+	for parser.position < len(parser.data) {
+		character := parser.data[parser.position]
+
+		if isPDFSpace(character) || isPDFDelimiter(character) {
+			break
+		}
+
+		if character == '#' && parser.position+2 < len(parser.data) {
+			if value, err := strconv.ParseUint(string(parser.data[parser.position+1:parser.position+3]), 16, 8); err == nil {
+				name.WriteByte(byte(value))
+				parser.position += 3
+				continue
+			}
+		}
+
+		name.WriteByte(character)
+		parser.position++
+	}
+
+	return pdfName(name.String())
+}
+
+func (parser *pdfParser) parseNumberOrRef() (interface{}, error) {
+	token := parser.token()
+	number, err := strconv.ParseFloat(token, 64)
+
+	if err != nil {
+		return nil, InvalidFormatError{Message: "Invalid PDF number " + token}
+	}
+
+	parser.position += len(token)
+	saved := parser.position
+
+	// an indirect reference is "number generation R"
+	if generation, err := strconv.Atoi(parser.token()); err == nil && generation >= 0 {
+		parser.position += len(parser.token())
+
+		if parser.token() == "R" {
+			parser.position++
+
+			return pdfRef{number: int(number), generation: generation}, nil
+		}
+	}
+
+	parser.position = saved
+
+	return number, nil
+}
+
+func (parser *pdfParser) parseArray() (pdfArray, error) {
+	parser.position++
+	array := pdfArray{}
+
+	for {
+		parser.skipSpaces()
+
+		if parser.position >= len(parser.data) {
+			return nil, InvalidFormatError{Message: "The PDF array does not end"}
+		}
+
+		if parser.data[parser.position] == ']' {
+			parser.position++
+
+			return array, nil
+		}
+
+		value, err := parser.parseObject()
+
+		if err != nil {
+			return nil, err
+		}
+
+		array = append(array, value)
+	}
+}
+
+func (parser *pdfParser) parseDict() (pdfDict, error) {
+	parser.position += 2
+	dict := pdfDict{}
+
+	for {
+		parser.skipSpaces()
+
+		if parser.position+1 >= len(parser.data) {
+			return nil, InvalidFormatError{Message: "The PDF dictionary does not end"}
+		}
+
+		if parser.data[parser.position] == '>' && parser.data[parser.position+1] == '>' {
+			parser.position += 2
+
+			return dict, nil
+		}
+
+		key, err := parser.parseObject()
+
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := key.(pdfName)
+
+		if !ok {
+			return nil, InvalidFormatError{Message: "The PDF dictionary key is not a name"}
+		}
+
+		value, err := parser.parseObject()
+
+		if err != nil {
+			return nil, err
+		}
+
+		dict[name] = value
+	}
+}
+
+func (parser *pdfParser) parseHexString() (pdfString, error) {
+	parser.position++
+	var digits []byte
+
+	for parser.position < len(parser.data) && parser.data[parser.position] != '>' {
+		if character := parser.data[parser.position]; !isPDFSpace(character) {
+			digits = append(digits, character)
+		}
+
+		parser.position++
+	}
+
+	if parser.position >= len(parser.data) {
+		return nil, InvalidFormatError{Message: "The PDF hex string does not end"}
+	}
+
+	parser.position++
+
+	// a missing last digit is zero
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	value := make(pdfString, len(digits)/2)
+
+	for index := range value {
+		decoded, err := strconv.ParseUint(string(digits[index*2:index*2+2]), 16, 8)
+
+		if err != nil {
+			return nil, InvalidFormatError{Message: "Invalid PDF hex string"}
+		}
+
+		value[index] = byte(decoded)
+	}
+
+	return value, nil
+}
+
+var pdfEscapes = map[byte]byte{'n': '\n', 'r': '\r', 't': '\t', 'b': '\b', 'f': '\f', '(': '(', ')': ')', '\\': '\\'}
+
+func (parser *pdfParser) parseLiteralString() (pdfString, error) {
+	parser.position++
+	value := pdfString{}
+	depth := 1
+
+	for parser.position < len(parser.data) {
+		character := parser.data[parser.position]
+		parser.position++
+
+		switch character {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return value, nil
+			}
+		case '\\':
+			if parser.position >= len(parser.data) {
+				continue
+			}
+
+			next := parser.data[parser.position]
+			parser.position++
+
+			if escaped, ok := pdfEscapes[next]; ok {
+				value = append(value, escaped)
+				continue
+			}
+
+			if next >= '0' && next <= '7' {
+				octal := int(next - '0')
+
+				for digits := 1; digits < 3 && parser.position < len(parser.data); digits++ {
+					if digit := parser.data[parser.position]; digit >= '0' && digit <= '7' {
+						octal = octal*8 + int(digit-'0')
+						parser.position++
+						continue
+					}
+
+					break
+				}
+
+				value = append(value, byte(octal))
+				continue
+			}
+
+			// a backslash at the end of a line continues the string in the next one
+			if next == '\r' && parser.position < len(parser.data) && parser.data[parser.position] == '\n' {
+				parser.position++
+			}
+
+			if next != '\r' && next != '\n' {
+				value = append(value, next)
+			}
+
+			continue
+		}
+
+		value = append(value, character)
+	}
+
+	return nil, InvalidFormatError{Message: "The PDF string does not end"}
+}
@@ -0,0 +1,261 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/aes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// pdfFile numbers the objects from 1 and appends a cross-reference table and the trailer
+func pdfFile(trailer string, objects ...string) []byte {
+	content := &bytes.Buffer{}
+	content.WriteString("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+
+	for index, object := range objects {
+		offsets[index] = content.Len()
+		fmt.Fprintf(content, "%v 0 obj\n%v\nendobj\n", index+1, object)
+	}
+
+	xref := content.Len()
+	fmt.Fprintf(content, "xref\n0 %v\n0000000000 65535 f \n", len(objects)+1)
+
+	for _, offset := range offsets {
+		fmt.Fprintf(content, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(content, "trailer\n<< /Size %v %v >>\nstartxref\n%v\n%%%%EOF\n", len(objects)+1, trailer, xref)
+
+	return content.Bytes()
+}
+
+func pdfStreamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %v /Length %v >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	compressed := &bytes.Buffer{}
+	writer := zlib.NewWriter(compressed)
+	writer.Write(data)
+	writer.Close()
+
+	return compressed.Bytes()
+}
+
+func hexString(data []byte) string {
+	return fmt.Sprintf("<%X>", data)
+}
+
+var pdfCatalog = []string{
+	"<< /Type /Catalog /Pages 2 0 R >>",
+	"<< /Type /Pages /Kids [4 0 R 5 0 R] /Count 2 >>",
+}
+
+var pdfPages = []string{
+	"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+}
+
+// newEncryptedPDF returns a document encrypted with RC4 whose user password is empty, the owner
+// password is not needed to open it
+func newEncryptedPDF(t *testing.T, validUser bool) []byte {
+	fileID := []byte("0123456789abcdef")
+	owner := bytes.Repeat([]byte{0x42}, 32)
+	key := pdfFileKey(3, 16, owner, -1028, fileID, true)
+	user := append(pdfUserEntry(3, key, fileID), bytes.Repeat([]byte{0}, 16)...)
+
+	if !validUser {
+		user = bytes.Repeat([]byte{0x13}, 32)
+	}
+
+	title, err := (&pdfDecrypter{key: key}).decrypt([]byte("Secret report"), pdfRef{number: 3}, cryptRC4)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /P -1028 /O %v /U %v >>", hexString(owner), hexString(user))
+
+	return pdfFile(
+		fmt.Sprintf("/Root 1 0 R /Info 3 0 R /Encrypt 6 0 R /ID [%v %v]", hexString(fileID), hexString(fileID)),
+		pdfCatalog[0], pdfCatalog[1], fmt.Sprintf("<< /Title %v >>", hexString(title)), pdfPages[0], pdfPages[1], encrypt,
+	)
+}
+
+func aesEncrypt(t *testing.T, key, iv, data []byte) []byte {
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted, err := aesCBC(key, iv, padded, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(append([]byte{}, iv...), encrypted...)
+}
+
+// newAESPDF returns a document encrypted with AES-256 whose user password is empty, the page tree is
+// compressed in an object stream
+func newAESPDF(t *testing.T) []byte {
+	fileKey := bytes.Repeat([]byte{0x07}, 32)
+	validationSalt, keySalt := []byte("validate"), []byte("keysalt!")
+	user := append(append(pdfPasswordHash(6, nil, validationSalt), validationSalt...), keySalt...)
+	userEncrypted, err := aesCBC(pdfPasswordHash(6, nil, keySalt), make([]byte, aes.BlockSize), fileKey, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := []byte("initialization v")
+	header := "1 0 2 40 "
+	objects := fmt.Sprintf("%-40v%v", pdfCatalog[0], "<< /Type /Pages /Count 7 >>")
+	objectStream := aesEncrypt(t, fileKey, iv, deflate([]byte(header+objects)))
+	title := aesEncrypt(t, fileKey, iv, []byte("\xFE\xFF\x00A\x00E\x00S"))
+	encrypt := fmt.Sprintf(
+		"<< /Filter /Standard /V 5 /R 6 /Length 256 /P -4 /CF << /StdCF << /CFM /AESV3 >> >> /StmF /StdCF /StrF /StdCF /O %v /U %v /OE %v /UE %v >>",
+		hexString(bytes.Repeat([]byte{1}, 48)), hexString(user), hexString(bytes.Repeat([]byte{2}, 32)), hexString(userEncrypted),
+	)
+
+	return pdfFile(
+		"/Root 1 0 R /Info 3 0 R /Encrypt 5 0 R",
+		"", "", fmt.Sprintf("<< /Title %v >>", hexString(title)),
+		pdfStreamObject(fmt.Sprintf("/Type /ObjStm /N 2 /First %v /Filter /FlateDecode", len(header)), objectStream),
+		encrypt,
+	)
+}
+
+func TestParsePDF(t *testing.T) {
+	incremental := pdfFile("/Root 1 0 R /Info 3 0 R", pdfCatalog[0], pdfCatalog[1], "<< /Title (Draft) >>", pdfPages[0], pdfPages[1])
+	incremental = append(incremental, "3 0 obj\n<< /Title (Final) /Author (Jane) >>\nendobj\ntrailer\n<< /Root 1 0 R /Info 3 0 R >>\n%%EOF\n"...)
+
+	header := "1 0 2 50 "
+	objects := fmt.Sprintf("%-50v%v", pdfCatalog[0], "<< /Type /Pages /Kids [4 0 R] >>")
+	compressed := pdfFile(
+		"/Root 1 0 R",
+		"", "", "<< /Title (Compressed) >>", pdfPages[0],
+		pdfStreamObject(fmt.Sprintf("/Type /ObjStm /N 2 /First %v /Filter /FlateDecode", len(header)), deflate([]byte(header+objects))),
+		pdfStreamObject("/Type /XRef /Root 1 0 R /Info 3 0 R /W [1 2 1] /Size 7", []byte{1, 0, 0, 0}),
+	)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    *persistence.DocumentMetadata
+		wantErr bool
+	}{
+		{
+			name: "Parses the pages and the information dictionary",
+			content: pdfFile(
+				"/Root 1 0 R /Info 3 0 R",
+				pdfCatalog[0], pdfCatalog[1],
+				`<< /Title (Annual \(2019\) report\040) /Author <FEFF004A006F0073006E> /Producer (test) >>`,
+				pdfPages[0], pdfPages[1],
+			),
+			want: &persistence.DocumentMetadata{Pages: 2, Title: "Annual (2019) report ", Author: "Josn"},
+		},
+		{
+			name: "Counts the pages when the page tree does not have a count",
+			content: pdfFile(
+				"/Root 1 0 R",
+				pdfCatalog[0], "<< /Type /Pages /Kids [3 0 R 4 0 R] >>", "<< /Type /Pages /Kids [5 0 R 5 0 R] /Count 2 >>", pdfPages[0], pdfPages[1],
+			),
+			want: &persistence.DocumentMetadata{Pages: 3},
+		},
+		{
+			name:    "Uses the objects of the incremental updates",
+			content: incremental,
+			want:    &persistence.DocumentMetadata{Pages: 2, Title: "Final", Author: "Jane"},
+		},
+		{
+			name:    "Parses the object streams and the cross-reference streams",
+			content: compressed,
+			want:    &persistence.DocumentMetadata{Pages: 1, Title: "Compressed"},
+		},
+		{
+			name:    "Decrypts the documents with an empty user password",
+			content: newEncryptedPDF(t, true),
+			want:    &persistence.DocumentMetadata{Pages: 2, Title: "Secret report", Encrypted: true},
+		},
+		{
+			name:    "Decrypts the AES-256 documents with an empty user password",
+			content: newAESPDF(t),
+			want:    &persistence.DocumentMetadata{Pages: 7, Title: "AES", Encrypted: true},
+		},
+		{
+			name:    "Error if the file is not a PDF",
+			content: []byte("GIF89a"),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the document does not have objects",
+			content: []byte("%PDF-1.4\n%%EOF\n"),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the document does not have a catalog",
+			content: pdfFile("/Info 1 0 R", "<< /Title (Orphan) >>"),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the document does not have pages",
+			content: pdfFile("/Root 1 0 R", pdfCatalog[0], "<< /Type /Pages /Kids [] /Count 0 >>"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePDF(bytes.NewReader(tt.content))
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePDF() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePDF() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePDF_PasswordProtected(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "User password", content: newEncryptedPDF(t, false)},
+		{
+			name: "Certificate security handler",
+			content: pdfFile(
+				"/Root 1 0 R /Encrypt 3 0 R",
+				pdfCatalog[0], "<< /Type /Pages /Count 1 >>", "<< /Filter /Adobe.PubSec /V 4 /R 4 >>",
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePDF(bytes.NewReader(tt.content))
+
+			if _, ok := err.(PasswordProtectedError); !ok {
+				t.Errorf("ParsePDF() error = %v, want PasswordProtectedError", err)
+			}
+		})
+	}
+}
+
+func TestParsePDF_Truncated(t *testing.T) {
+	content := pdfFile("/Root 1 0 R", pdfCatalog[0], pdfCatalog[1], pdfPages[0], pdfPages[1])
+
+	for length := 0; length < len(content); length++ {
+		// the parser must not panic with truncated documents
+		_, _ = ParsePDF(strings.NewReader(string(content[:length])))
+	}
+}
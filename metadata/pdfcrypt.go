@@ -0,0 +1,297 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+)
+
+// pdfPadding pads the passwords of the standard security handler
+var pdfPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// The crypt filter methods
+const (
+	cryptNone  = "None"
+	cryptRC4   = "V2"
+	cryptAESV2 = "AESV2"
+	cryptAESV3 = "AESV3"
+)
+
+// pdfDecrypter decrypts the strings and streams of a document opened with the empty user password
+type pdfDecrypter struct {
+	key          []byte
+	stringMethod string
+	streamMethod string
+}
+
+// newPDFDecrypter authenticates the empty user password with the standard security handler, documents
+// that need a password or use another security handler return a PasswordProtectedError
+func newPDFDecrypter(encrypt pdfDict, fileID []byte) (*pdfDecrypter, error) {
+	if filter, _ := encrypt["Filter"].(pdfName); filter != "Standard" {
+		return nil, PasswordProtectedError{Message: "The PDF document is encrypted with the " + string(filter) + " security handler"}
+	}
+
+	version, _ := encrypt["V"].(float64)
+	revision, _ := encrypt["R"].(float64)
+	owner, _ := encrypt["O"].(pdfString)
+	user, _ := encrypt["U"].(pdfString)
+	permissions, _ := encrypt["P"].(float64)
+	decrypter := &pdfDecrypter{stringMethod: cryptRC4, streamMethod: cryptRC4}
+
+	if version >= 4 {
+		decrypter.stringMethod = cryptFilterMethod(encrypt, encrypt["StrF"])
+		decrypter.streamMethod = cryptFilterMethod(encrypt, encrypt["StmF"])
+	}
+
+	if revision >= 5 {
+		userEncrypted, _ := encrypt["UE"].(pdfString)
+
+		if len(user) < 48 || len(userEncrypted) < 32 {
+			return nil, InvalidFormatError{Message: "The PDF encryption dictionary is invalid"}
+		}
+
+		if !bytes.Equal(pdfPasswordHash(int(revision), nil, user[32:40]), user[:32]) {
+			return nil, PasswordProtectedError{Message: "The PDF document is protected by a user password"}
+		}
+
+		key, err := aesCBC(pdfPasswordHash(int(revision), nil, user[40:48]), make([]byte, aes.BlockSize), userEncrypted[:32], false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		decrypter.key = key
+
+		return decrypter, nil
+	}
+
+	if len(owner) < 32 || len(user) < 32 {
+		return nil, InvalidFormatError{Message: "The PDF encryption dictionary is invalid"}
+	}
+
+	length := 5
+
+	if revision >= 3 {
+		if bits, ok := encrypt["Length"].(float64); ok && bits >= 40 && bits <= 128 {
+			length = int(bits) / 8
+		} else {
+			length = 16
+		}
+	}
+
+	encryptMetadata, ok := encrypt["EncryptMetadata"].(bool)
+	decrypter.key = pdfFileKey(int(revision), length, owner, int32(permissions), fileID, !ok || encryptMetadata)
+
+	if !bytes.Equal(pdfUserEntry(int(revision), decrypter.key, fileID), userEntryPrefix(int(revision), user)) {
+		return nil, PasswordProtectedError{Message: "The PDF document is protected by a user password"}
+	}
+
+	return decrypter, nil
+}
+
+// cryptFilterMethod returns the method of a crypt filter of the /CF dictionary
+func cryptFilterMethod(encrypt pdfDict, value interface{}) string {
+	name, ok := value.(pdfName)
+
+	if !ok || name == "Identity" {
+		return cryptNone
+	}
+
+	filters, _ := encrypt["CF"].(pdfDict)
+	filter, _ := filters[name].(pdfDict)
+
+	if method, ok := filter["CFM"].(pdfName); ok && method != "None" {
+		return string(method)
+	}
+
+	return cryptNone
+}
+
+// pdfFileKey computes the file key of the empty user password, algorithm 2 of ISO 32000-1
+func pdfFileKey(revision, length int, owner []byte, permissions int32, fileID []byte, encryptMetadata bool) []byte {
+	digest := md5.New()
+	digest.Write(pdfPadding)
+	digest.Write(owner[:32])
+	binary.Write(digest, binary.LittleEndian, permissions)
+	digest.Write(fileID)
+
+	if revision >= 4 && !encryptMetadata {
+		digest.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+
+	key := digest.Sum(nil)
+
+	if revision >= 3 {
+		for index := 0; index < 50; index++ {
+			sum := md5.Sum(key[:length])
+			key = sum[:]
+		}
+	}
+
+	return key[:length]
+}
+
+// pdfUserEntry computes the /U entry of the file key, algorithms 4 and 5 of ISO 32000-1
+func pdfUserEntry(revision int, key, fileID []byte) []byte {
+	if revision == 2 {
+		return rc4XOR(key, pdfPadding)
+	}
+
+	digest := md5.New()
+	digest.Write(pdfPadding)
+	digest.Write(fileID)
+	entry := rc4XOR(key, digest.Sum(nil))
+
+	for round := 1; round <= 19; round++ {
+		roundKey := make([]byte, len(key))
+
+		for index := range key {
+			roundKey[index] = key[index] ^ byte(round)
+		}
+
+		entry = rc4XOR(roundKey, entry)
+	}
+
+	return entry
+}
+
+// userEntryPrefix returns the bytes of the /U entry that are compared, only the first 16 bytes are defined since revision 3
+func userEntryPrefix(revision int, user []byte) []byte {
+	if revision == 2 {
+		return user[:32]
+	}
+
+	return user[:16]
+}
+
+// pdfPasswordHash hashes a password with a salt, the revision 6 uses algorithm 2.B of ISO 32000-2
+func pdfPasswordHash(revision int, password, salt []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, password...), salt...))
+	key := sum[:]
+
+	if revision < 6 {
+		return key
+	}
+
+	for round := 0; ; round++ {
+		block := append(append([]byte{}, password...), key...)
+		repeated := bytes.Repeat(block, 64)
+		encrypted, _ := aesCBC(key[:16], key[16:32], repeated, true)
+
+		var digest hash.Hash
+
+		switch remainder(encrypted[:16]) {
+		case 0:
+			digest = sha256.New()
+		case 1:
+			digest = sha512.New384()
+		default:
+			digest = sha512.New()
+		}
+
+		digest.Write(encrypted)
+		key = digest.Sum(nil)
+
+		if round >= 63 && int(encrypted[len(encrypted)-1]) <= round-31 {
+			return key[:32]
+		}
+	}
+}
+
+// remainder returns the big endian number of the bytes modulo 3, 256 is 1 modulo 3 so it is the sum of the bytes
+func remainder(number []byte) int {
+	sum := 0
+
+	for _, digit := range number {
+		sum += int(digit)
+	}
+
+	return sum % 3
+}
+
+// decrypt decrypts a string or a stream of the given object with a crypt filter method
+func (decrypter *pdfDecrypter) decrypt(data []byte, ref pdfRef, method string) ([]byte, error) {
+	switch method {
+	case cryptNone:
+		return data, nil
+	case cryptAESV3:
+		return aesDecrypt(decrypter.key, data)
+	}
+
+	digest := md5.New()
+	digest.Write(decrypter.key)
+	digest.Write([]byte{byte(ref.number), byte(ref.number >> 8), byte(ref.number >> 16), byte(ref.generation), byte(ref.generation >> 8)})
+
+	if method == cryptAESV2 {
+		digest.Write([]byte("sAlT"))
+	}
+
+	key := digest.Sum(nil)
+
+	if length := len(decrypter.key) + 5; length < len(key) {
+		key = key[:length]
+	}
+
+	if method == cryptAESV2 {
+		return aesDecrypt(key, data)
+	}
+
+	return rc4XOR(key, data), nil
+}
+
+func rc4XOR(key, data []byte) []byte {
+	result := make([]byte, len(data))
+	stream, _ := rc4.NewCipher(key)
+	stream.XORKeyStream(result, data)
+
+	return result
+}
+
+// aesDecrypt decrypts data whose first block is the initialization vector and removes its padding
+func aesDecrypt(key, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, InvalidFormatError{Message: "The PDF encrypted data is invalid"}
+	}
+
+	decrypted, err := aesCBC(key, data[:aes.BlockSize], data[aes.BlockSize:], false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	padding := int(decrypted[len(decrypted)-1])
+
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, InvalidFormatError{Message: "The PDF encrypted data is invalid"}
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// aesCBC encrypts or decrypts data whose length is a multiple of the block size
+func aesCBC(key, iv, data []byte, encrypt bool) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, len(data))
+
+	if encrypt {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(result, data)
+	} else {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(result, data)
+	}
+
+	return result, nil
+}
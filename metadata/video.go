@@ -0,0 +1,517 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+type InvalidFormatError struct {
+	Message string
+}
+
+func (err InvalidFormatError) Error() string {
+	return err.Message
+}
+
+// ParseVideo reads the container headers of a MP4/QuickTime or Matroska/WebM file
+func ParseVideo(reader io.ReadSeeker) (*persistence.VideoMetadata, error) {
+	header := make([]byte, 8)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, InvalidFormatError{Message: "The video is too short to be parsed"}
+	}
+
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(header[:4], ebmlMagic) {
+		return ParseWebM(reader)
+	}
+
+	if bytes.Equal(header[4:8], []byte("ftyp")) {
+		return ParseMP4(reader)
+	}
+
+	return nil, InvalidFormatError{Message: "Unsupported video container"}
+}
+
+// containerBoxes are the MP4 boxes that must be descended to reach the track metadata
+var containerBoxes = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true}
+
+// payloadBoxes are the MP4 boxes whose content is read into memory
+var payloadBoxes = map[string]bool{"mvhd": true, "tkhd": true, "hdlr": true, "stsd": true}
+
+// maxPayloadSize bounds the content of the payload boxes, the valid ones are a few hundred bytes
+const maxPayloadSize = 1 << 20
+
+// ParseMP4 reads the duration and the first video track of a MP4/QuickTime file, the media data is skipped
+func ParseMP4(reader io.ReadSeeker) (*persistence.VideoMetadata, error) {
+	size, err := reader.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	boxes, err := readBoxes(reader, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	moov := findBox(boxes, "moov")
+
+	if moov == nil {
+		return nil, InvalidFormatError{Message: "The MP4 file does not have a moov box"}
+	}
+
+	result := &persistence.VideoMetadata{}
+
+	if mvhd := findBox(moov.children, "mvhd"); mvhd != nil {
+		result.Duration = parseMovieDuration(mvhd.data)
+	}
+
+	for _, trak := range moov.children {
+		if trak.kind != "trak" {
+			continue
+		}
+
+		mdia := findBox(trak.children, "mdia")
+
+		if mdia == nil {
+			continue
+		}
+
+		hdlr := findBox(mdia.children, "hdlr")
+
+		if hdlr == nil || len(hdlr.data) < 12 || string(hdlr.data[8:12]) != "vide" {
+			continue
+		}
+
+		if tkhd := findBox(trak.children, "tkhd"); tkhd != nil {
+			result.Width, result.Height = parseTrackDimensions(tkhd.data)
+		}
+
+		if stsd := findBox(mdia.children, "minf", "stbl", "stsd"); stsd != nil && len(stsd.data) >= 16 {
+			result.Codec = string(stsd.data[12:16])
+		}
+
+		return result, nil
+	}
+
+	return nil, InvalidFormatError{Message: "The MP4 file does not have a video track"}
+}
+
+// boxNode is an ISO base media file format box, data holds the payload of the boxes that are read
+type boxNode struct {
+	kind     string
+	data     []byte
+	children []*boxNode
+}
+
+func readBoxes(reader io.ReadSeeker, length int64) ([]*boxNode, error) {
+	var nodes []*boxNode
+	header := make([]byte, 8)
+
+	for length >= 8 {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, InvalidFormatError{Message: "Truncated MP4 box header"}
+		}
+
+		headerSize := int64(8)
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:8])
+
+		switch size {
+		case 0:
+			size = length
+		case 1:
+			if _, err := io.ReadFull(reader, header); err != nil {
+				return nil, InvalidFormatError{Message: "Truncated MP4 box header"}
+			}
+
+			headerSize = 16
+			size = int64(binary.BigEndian.Uint64(header))
+		}
+
+		if size < headerSize || size > length {
+			return nil, InvalidFormatError{Message: "Invalid MP4 box size"}
+		}
+
+		node := &boxNode{kind: kind}
+		payload := size - headerSize
+
+		switch {
+		case containerBoxes[kind]:
+			children, err := readBoxes(reader, payload)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.children = children
+		case payloadBoxes[kind]:
+			if payload > maxPayloadSize {
+				return nil, InvalidFormatError{Message: "Invalid MP4 " + kind + " box size"}
+			}
+
+			node.data = make([]byte, payload)
+
+			if _, err := io.ReadFull(reader, node.data); err != nil {
+				return nil, InvalidFormatError{Message: "Truncated MP4 box"}
+			}
+		default:
+			if _, err := reader.Seek(payload, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+
+		nodes = append(nodes, node)
+		length -= size
+	}
+
+	if length > 0 {
+		if _, err := reader.Seek(length, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// findBox follows the given path of box types
+func findBox(nodes []*boxNode, path ...string) *boxNode {
+	for _, node := range nodes {
+		if node.kind != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			return node
+		}
+
+		return findBox(node.children, path[1:]...)
+	}
+
+	return nil
+}
+
+func parseMovieDuration(data []byte) float64 {
+	var timescale, duration uint64
+
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(data[20:24]))
+		duration = binary.BigEndian.Uint64(data[24:32])
+	case len(data) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0
+	}
+
+	return float64(duration) / float64(timescale)
+}
+
+func parseTrackDimensions(data []byte) (int, int) {
+	// width and height are 16.16 fixed point values at the end of the box
+	offset := 76
+
+	if len(data) > 0 && data[0] == 1 {
+		offset = 88
+	}
+
+	if len(data) < offset+8 {
+		return 0, 0
+	}
+
+	width := binary.BigEndian.Uint32(data[offset : offset+4])
+	height := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+
+	return int(width >> 16), int(height >> 16)
+}
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+const (
+	segmentID        = 0x18538067
+	infoID           = 0x1549A966
+	timecodeScaleID  = 0x2AD7B1
+	durationID       = 0x4489
+	tracksID         = 0x1654AE6B
+	trackEntryID     = 0xAE
+	trackTypeID      = 0x83
+	codecID          = 0x86
+	videoID          = 0xE0
+	pixelWidthID     = 0xB0
+	pixelHeightID    = 0xBA
+	clusterID        = 0x1F43B675
+	unknownSize      = -1
+	videoTrackType   = 1
+	defaultTimescale = 1000000
+)
+
+type webmParser struct {
+	reader    io.ReadSeeker
+	timescale uint64
+	duration  float64
+	video     *persistence.VideoMetadata
+	done      bool
+}
+
+// ParseWebM reads the duration and the first video track of a Matroska/WebM file, parsing stops at the first cluster
+func ParseWebM(reader io.ReadSeeker) (*persistence.VideoMetadata, error) {
+	parser := &webmParser{reader: reader, timescale: defaultTimescale}
+
+	if err := parser.parse(unknownSize); err != nil {
+		return nil, err
+	}
+
+	if parser.video == nil {
+		return nil, InvalidFormatError{Message: "The WebM file does not have a video track"}
+	}
+
+	parser.video.Duration = parser.duration * float64(parser.timescale) / 1e9
+
+	return parser.video, nil
+}
+
+// parse walks the elements of a master element of the given size, unknownSize reads until EOF
+func (parser *webmParser) parse(length int64) error {
+	for !parser.done && (length == unknownSize || length > 0) {
+		id, idLength, err := readVint(parser.reader, false)
+
+		if err == io.EOF && length == unknownSize {
+			return nil
+		}
+
+		if err != nil {
+			return InvalidFormatError{Message: "Truncated WebM element"}
+		}
+
+		size, sizeLength, err := readVint(parser.reader, true)
+
+		if err != nil {
+			return InvalidFormatError{Message: "Truncated WebM element"}
+		}
+
+		if length != unknownSize {
+			length -= int64(idLength + sizeLength)
+
+			if size != unknownSize {
+				length -= size
+			}
+		}
+
+		switch id {
+		case clusterID:
+			parser.done = true
+		case segmentID, infoID, tracksID:
+			err = parser.parse(size)
+		case trackEntryID:
+			err = parser.parseTrack(size)
+		case timecodeScaleID:
+			parser.timescale, err = parser.readUint(size)
+		case durationID:
+			parser.duration, err = parser.readFloat(size)
+		default:
+			err = parser.skip(size)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (parser *webmParser) parseTrack(size int64) error {
+	data, err := parser.read(size)
+
+	if err != nil {
+		return err
+	}
+
+	track := &persistence.VideoMetadata{}
+	trackType := uint64(0)
+	reader := bytes.NewReader(data)
+
+	for reader.Len() > 0 {
+		id, _, err := readVint(reader, false)
+
+		if err != nil {
+			return InvalidFormatError{Message: "Truncated WebM track"}
+		}
+
+		elementSize, _, err := readVint(reader, true)
+
+		if err != nil || elementSize < 0 || elementSize > int64(reader.Len()) {
+			return InvalidFormatError{Message: "Truncated WebM track"}
+		}
+
+		value := make([]byte, elementSize)
+		_, _ = reader.Read(value)
+
+		switch id {
+		case trackTypeID:
+			trackType = decodeUint(value)
+		case codecID:
+			track.Codec = string(bytes.TrimRight(value, "\x00"))
+		case videoID:
+			track.Width, track.Height = parseWebMVideo(value)
+		}
+	}
+
+	if trackType == videoTrackType && parser.video == nil {
+		parser.video = track
+	}
+
+	return nil
+}
+
+func parseWebMVideo(data []byte) (int, int) {
+	var width, height int
+	reader := bytes.NewReader(data)
+
+	for reader.Len() > 0 {
+		id, _, err := readVint(reader, false)
+
+		if err != nil {
+			break
+		}
+
+		size, _, err := readVint(reader, true)
+
+		if err != nil || size < 0 || size > int64(reader.Len()) {
+			break
+		}
+
+		value := make([]byte, size)
+		_, _ = reader.Read(value)
+
+		switch id {
+		case pixelWidthID:
+			width = int(decodeUint(value))
+		case pixelHeightID:
+			height = int(decodeUint(value))
+		}
+	}
+
+	return width, height
+}
+
+func (parser *webmParser) read(size int64) ([]byte, error) {
+	if size < 0 || size > 1<<20 {
+		return nil, InvalidFormatError{Message: "Invalid WebM element size"}
+	}
+
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(parser.reader, data); err != nil {
+		return nil, InvalidFormatError{Message: "Truncated WebM element"}
+	}
+
+	return data, nil
+}
+
+func (parser *webmParser) readUint(size int64) (uint64, error) {
+	data, err := parser.read(size)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeUint(data), nil
+}
+
+func (parser *webmParser) readFloat(size int64) (float64, error) {
+	data, err := parser.read(size)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	}
+
+	return 0, InvalidFormatError{Message: "Invalid WebM float size"}
+}
+
+func (parser *webmParser) skip(size int64) error {
+	if size == unknownSize {
+		return InvalidFormatError{Message: "Can not skip a WebM element of unknown size"}
+	}
+
+	_, err := parser.reader.Seek(size, io.SeekCurrent)
+
+	return err
+}
+
+func decodeUint(data []byte) uint64 {
+	var value uint64
+
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+// readVint reads an EBML variable length integer, element IDs keep their length marker
+func readVint(reader io.Reader, isSize bool) (int64, int, error) {
+	first := make([]byte, 1)
+
+	if _, err := io.ReadFull(reader, first); err != nil {
+		return 0, 0, err
+	}
+
+	length := 1
+
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+
+	if length > 8 {
+		return 0, 0, InvalidFormatError{Message: "Invalid EBML variable length integer"}
+	}
+
+	rest := make([]byte, length-1)
+
+	if _, err := io.ReadFull(reader, rest); err != nil {
+		return 0, 0, err
+	}
+
+	value := uint64(first[0])
+
+	if isSize {
+		value &= uint64(0xFF >> uint(length))
+	}
+
+	allOnes := value == uint64(0xFF>>uint(length))
+
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+
+	if isSize && allOnes {
+		return unknownSize, length, nil
+	}
+
+	return int64(value), length, nil
+}
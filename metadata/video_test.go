@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+func TestParseVideo(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    *persistence.VideoMetadata
+		wantErr bool
+	}{
+		{
+			name:    "Parses a MP4 file",
+			content: newMP4(1280, 720, 90000, 450000, "avc1"),
+			want:    &persistence.VideoMetadata{Duration: 5, Width: 1280, Height: 720, Codec: "avc1"},
+		},
+		{
+			name:    "Parses a WebM file",
+			content: newWebM(640, 360, 2500, "V_VP9"),
+			want:    &persistence.VideoMetadata{Duration: 2.5, Width: 640, Height: 360, Codec: "V_VP9"},
+		},
+		{
+			name:    "Error if the MP4 file does not have a moov box",
+			content: mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the MP4 box size is invalid",
+			content: append(mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")), 0x00, 0x00, 0xFF, 0xFF, 'm', 'o', 'o', 'v'),
+			wantErr: true,
+		},
+		{
+			name:    "Error if a MP4 box read into memory is too large",
+			content: append(mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")), mp4Box("moov", mp4Box("mvhd", make([]byte, 2<<20)))...),
+			wantErr: true,
+		},
+		{
+			name:    "Error if the container is unknown",
+			content: []byte("%PDF-1.4 not a video"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVideo(bytes.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseVideo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVideo() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func mp4Box(kind string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	result := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(result, uint32(8+len(payload)))
+	copy(result[4:], kind)
+
+	return append(result, payload...)
+}
+
+func newMP4(width, height, timescale, duration uint32, codec string) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], width<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], height<<16)
+
+	hdlr := append(make([]byte, 8), []byte("vide\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+
+	stsd := make([]byte, 16)
+	binary.BigEndian.PutUint32(stsd[4:], 1)
+	binary.BigEndian.PutUint32(stsd[8:], 8)
+	copy(stsd[12:], codec)
+
+	soundHdlr := append(make([]byte, 8), []byte("soun\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2avc1mp41")),
+		mp4Box("mdat", make([]byte, 64)),
+		mp4Box("moov",
+			mp4Box("mvhd", mvhd),
+			mp4Box("trak", mp4Box("tkhd", make([]byte, 84)), mp4Box("mdia", mp4Box("hdlr", soundHdlr))),
+			mp4Box("trak",
+				mp4Box("tkhd", tkhd),
+				mp4Box("mdia",
+					mp4Box("mdhd", make([]byte, 24)),
+					mp4Box("hdlr", hdlr),
+					mp4Box("minf", mp4Box("stbl", mp4Box("stsd", stsd))),
+				),
+			),
+		),
+	}, nil)
+}
+
+func ebmlElement(id uint32, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	var result []byte
+
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> uint(shift)); b != 0 || len(result) > 0 {
+			result = append(result, b)
+		}
+	}
+
+	// sizes are always encoded with 8 bytes to keep the builder simple
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(payload)))
+	size[0] = 0x01
+
+	return append(append(result, size...), payload...)
+}
+
+func ebmlUint(id uint32, value uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, value)
+
+	return ebmlElement(id, data)
+}
+
+func newWebM(width, height uint64, durationMillis float64, codec string) []byte {
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(durationMillis))
+
+	return bytes.Join([][]byte{
+		ebmlElement(0x1A45DFA3, ebmlElement(0x4282, []byte("webm"))),
+		ebmlElement(segmentID,
+			ebmlElement(infoID, ebmlUint(timecodeScaleID, 1000000), ebmlElement(durationID, duration)),
+			ebmlElement(tracksID,
+				ebmlElement(trackEntryID, ebmlUint(trackTypeID, 2), ebmlElement(codecID, []byte("A_OPUS"))),
+				ebmlElement(trackEntryID,
+					ebmlUint(trackTypeID, videoTrackType),
+					ebmlElement(codecID, []byte(codec)),
+					ebmlElement(videoID, ebmlUint(pixelWidthID, width), ebmlUint(pixelHeightID, height)),
+				),
+			),
+			ebmlElement(clusterID, make([]byte, 32)),
+		),
+	}, nil)
+}
@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// BatchGetLimit is the maximum amount of keys DynamoDB accepts per BatchGetItem call
+	BatchGetLimit = 100
+	// BatchGetRetries is the amount of times the unprocessed keys of a batch are requested again
+	BatchGetRetries = 5
+)
+
+// batchGetBackoff is the delay before the first retry of the unprocessed keys, it doubles on every retry
+var batchGetBackoff = 50 * time.Millisecond
+
+// BatchFindResult are the items found in the order of the requested IDs and the IDs that do not exist
+type BatchFindResult struct {
+	Items   []*MultimediaItem
+	Missing []*string
+}
+
+// UnprocessedKeysError is returned when DynamoDB does not process some keys after all the retries
+type UnprocessedKeysError struct {
+	IDs []string
+}
+
+func (err UnprocessedKeysError) Error() string {
+	return fmt.Sprintf("DynamoDB did not process %v keys after %v retries", len(err.IDs), BatchGetRetries)
+}
+
+// FindMany returns the existing items in the order of the given IDs, missing IDs are ignored
+func (manager *AWSPersistenceManager) FindMany(ids []*string) ([]*MultimediaItem, error) {
+	result, err := manager.BatchFind(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Items, nil
+}
+
+// BatchFind requests the items in batches of BatchGetLimit keys, duplicated IDs are requested once
+func (manager *AWSPersistenceManager) BatchFind(ids []*string) (*BatchFindResult, error) {
+	var unique []string
+	seen := make(map[string]bool, len(ids))
+
+	for _, ID := range ids {
+		if ID == nil || seen[*ID] {
+			continue
+		}
+
+		seen[*ID] = true
+		unique = append(unique, *ID)
+	}
+
+	found := make(map[string]*MultimediaItem, len(unique))
+
+	for start := 0; start < len(unique); start += BatchGetLimit {
+		end := start + BatchGetLimit
+
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		if err := manager.batchGet(unique[start:end], found); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BatchFindResult{}
+
+	for _, ID := range unique {
+		if item, ok := found[ID]; ok {
+			result.Items = append(result.Items, item)
+		} else {
+			missing := ID
+			result.Missing = append(result.Missing, &missing)
+		}
+	}
+
+	return result, nil
+}
+
+// batchGet requests a single batch and retries its unprocessed keys with an exponential backoff
+func (manager *AWSPersistenceManager) batchGet(ids []string, found map[string]*MultimediaItem) error {
+	keys := make([]map[string]*dynamodb.AttributeValue, len(ids))
+
+	for index := range ids {
+		keys[index] = map[string]*dynamodb.AttributeValue{"id": {S: &ids[index]}}
+	}
+
+	requestItems := map[string]*dynamodb.KeysAndAttributes{
+		*manager.TableName: {Keys: keys},
+	}
+	delay := batchGetBackoff
+
+	for attempt := 0; ; attempt++ {
+		output, err := manager.DynamoDB.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: requestItems})
+
+		if err != nil {
+			return err
+		}
+
+		for _, response := range output.Responses[*manager.TableName] {
+			item, err := mapItemOutput(response)
+
+			if err != nil {
+				return err
+			}
+
+			found[*item.ID] = item
+		}
+
+		unprocessed, ok := output.UnprocessedKeys[*manager.TableName]
+
+		if !ok || len(unprocessed.Keys) == 0 {
+			return nil
+		}
+
+		if attempt == BatchGetRetries {
+			unprocessedIDs := make([]string, len(unprocessed.Keys))
+
+			for index, key := range unprocessed.Keys {
+				unprocessedIDs[index] = *key["id"].S
+			}
+
+			return UnprocessedKeysError{IDs: unprocessedIDs}
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		requestItems = map[string]*dynamodb.KeysAndAttributes{*manager.TableName: unprocessed}
+	}
+}
@@ -0,0 +1,144 @@
+package persistence
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DynamoDBBatch answers BatchGetItem from Items, it processes at most PerCall keys of every call
+type DynamoDBBatch struct {
+	DynamoDBSuccess
+	Items   map[string]bool
+	PerCall int
+	Batches []int
+}
+
+func (dynamo *DynamoDBBatch) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+
+	for table, request := range input.RequestItems {
+		if len(request.Keys) > BatchGetLimit {
+			return nil, InvalidArguments{Message: aws.String("Too many keys")}
+		}
+
+		dynamo.Batches = append(dynamo.Batches, len(request.Keys))
+		keys := request.Keys
+
+		if dynamo.PerCall > 0 && len(keys) > dynamo.PerCall {
+			output.UnprocessedKeys = map[string]*dynamodb.KeysAndAttributes{
+				table: {Keys: keys[dynamo.PerCall:]},
+			}
+			keys = keys[:dynamo.PerCall]
+		}
+
+		for _, key := range keys {
+			if dynamo.Items[*key["id"].S] {
+				output.Responses[table] = append(output.Responses[table], map[string]*dynamodb.AttributeValue{
+					"id":        key["id"],
+					"bucket":    {S: aws.String("http://example.com")},
+					"filename":  {S: aws.String(*key["id"].S + ".png")},
+					"type":      {S: aws.String(IMAGE)},
+					"createdAt": {S: aws.String("2019-01-01T00:00:00Z")},
+				})
+			}
+		}
+	}
+
+	return output, nil
+}
+
+func batchIDs(amount int) (map[string]bool, []*string) {
+	items := make(map[string]bool, amount)
+	ids := make([]*string, amount)
+
+	for index := range ids {
+		ids[index] = aws.String(fmt.Sprintf("id-%03d", amount-index))
+		items[*ids[index]] = true
+	}
+
+	return items, ids
+}
+
+func TestAWSPersistenceManager_BatchFind(t *testing.T) {
+	batchGetBackoff = 0
+	items, ids := batchIDs(250)
+	dynamo := &DynamoDBBatch{Items: items, PerCall: 90}
+	manager := &AWSPersistenceManager{DynamoDB: dynamo, TableName: aws.String("example")}
+	requested := append([]*string{aws.String("unknown"), ids[1]}, ids...)
+
+	result, err := manager.BatchFind(requested)
+
+	if err != nil {
+		t.Errorf("BatchFind() error = %v", err)
+		return
+	}
+
+	if len(result.Items) != len(ids) {
+		t.Errorf("BatchFind() got %v items, want %v", len(result.Items), len(ids))
+		return
+	}
+
+	want := append([]*string{ids[1], ids[0]}, ids[2:]...)
+
+	for index, item := range result.Items {
+		if *item.ID != *want[index] {
+			t.Errorf("BatchFind() item %v = %v, want %v", index, *item.ID, *want[index])
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(result.Missing, []*string{aws.String("unknown")}) {
+		t.Errorf("BatchFind() missing = %v, want [unknown]", aws.StringValueSlice(result.Missing))
+	}
+
+	if dynamo.Batches[0] != BatchGetLimit {
+		t.Errorf("BatchFind() first batch = %v keys, want %v", dynamo.Batches[0], BatchGetLimit)
+	}
+}
+
+func TestAWSPersistenceManager_BatchFindUnprocessed(t *testing.T) {
+	batchGetBackoff = 0
+	items, ids := batchIDs(BatchGetRetries + 1)
+	manager := &AWSPersistenceManager{DynamoDB: &DynamoDBBatch{Items: items, PerCall: 1}, TableName: aws.String("example")}
+
+	if _, err := manager.BatchFind(ids); err != nil {
+		t.Errorf("BatchFind() error = %v", err)
+	}
+
+	items, ids = batchIDs(BatchGetRetries + 2)
+	manager = &AWSPersistenceManager{DynamoDB: &DynamoDBBatch{Items: items, PerCall: 1}, TableName: aws.String("example")}
+	_, err := manager.BatchFind(ids)
+
+	if unprocessed, ok := err.(UnprocessedKeysError); !ok || len(unprocessed.IDs) != 1 {
+		t.Errorf("BatchFind() error = %v, want UnprocessedKeysError with one ID", err)
+	}
+}
+
+func TestAWSPersistenceManager_FindMany(t *testing.T) {
+	tests := []struct {
+		name     string
+		DynamoDB DynamoDBRepository
+		want     int
+		wantErr  bool
+	}{
+		{name: "Must return an error if DynamoDB Fails", DynamoDB: &DynamoDBFail{}, wantErr: true},
+		{name: "Must ignore the missing items", DynamoDB: &DynamoDBBatch{Items: map[string]bool{"a": true}}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &AWSPersistenceManager{DynamoDB: tt.DynamoDB, TableName: aws.String("example")}
+			got, err := manager.FindMany([]*string{aws.String("a"), aws.String("b")})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FindMany() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("FindMany() got = %v items, want %v", len(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package persistence_test
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+	"github.com/alejo-lapix/multimedia-go/persistence/persistencetest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// MemoryDynamoDB keeps the items of the tables in memory and answers the queries of their type index
+type MemoryDynamoDB struct {
+	mutex  sync.Mutex
+	tables map[string]map[string]map[string]*dynamodb.AttributeValue
+}
+
+// table returns the items of the table by ID, the caller must hold the mutex
+func (dynamo *MemoryDynamoDB) table(name *string) map[string]map[string]*dynamodb.AttributeValue {
+	if dynamo.tables == nil {
+		dynamo.tables = make(map[string]map[string]map[string]*dynamodb.AttributeValue)
+	}
+
+	items, ok := dynamo.tables[*name]
+
+	if !ok {
+		items = make(map[string]map[string]*dynamodb.AttributeValue)
+		dynamo.tables[*name] = items
+	}
+
+	return items
+}
+
+func (dynamo *MemoryDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	dynamo.mutex.Lock()
+	defer dynamo.mutex.Unlock()
+
+	items := dynamo.table(input.TableName)
+	ID := *input.Item["id"].S
+
+	stored, exists := items[ID]
+	condition := aws.StringValue(input.ConditionExpression)
+	versionChanged := condition == "#version = :version" && (!exists || *stored["version"].N != *input.ExpressionAttributeValues[":version"].N)
+
+	if (exists && strings.HasPrefix(condition, "attribute_not_exists")) || (!exists && strings.HasPrefix(condition, "attribute_exists")) || versionChanged {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	items[ID] = copyAttributes(input.Item)
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (dynamo *MemoryDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	dynamo.mutex.Lock()
+	defer dynamo.mutex.Unlock()
+
+	delete(dynamo.table(input.TableName), *input.Key["id"].S)
+
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (dynamo *MemoryDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	dynamo.mutex.Lock()
+	defer dynamo.mutex.Unlock()
+
+	item, ok := dynamo.table(input.TableName)[*input.Key["id"].S]
+
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+
+	return &dynamodb.GetItemOutput{Item: copyAttributes(item)}, nil
+}
+
+func (dynamo *MemoryDynamoDB) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	dynamo.mutex.Lock()
+	defer dynamo.mutex.Unlock()
+
+	output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+
+	for name, request := range input.RequestItems {
+		items := dynamo.table(aws.String(name))
+
+		for _, key := range request.Keys {
+			if item, ok := items[*key["id"].S]; ok {
+				output.Responses[name] = append(output.Responses[name], copyAttributes(item))
+			}
+		}
+	}
+
+	return output, nil
+}
+
+func (dynamo *MemoryDynamoDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	dynamo.mutex.Lock()
+	defer dynamo.mutex.Unlock()
+
+	values := input.ExpressionAttributeValues
+	var matches []map[string]*dynamodb.AttributeValue
+
+	for _, item := range dynamo.table(input.TableName) {
+		createdAt := *item["createdAt"].S
+
+		if (values[":type"] != nil && *item["type"].S != *values[":type"].S) ||
+			(values[":hash"] != nil && (item["hash"] == nil || *item["hash"].S != *values[":hash"].S)) ||
+			(values[":after"] != nil && createdAt < *values[":after"].S) ||
+			(values[":before"] != nil && createdAt > *values[":before"].S) {
+			continue
+		}
+
+		matches = append(matches, copyAttributes(item))
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		before := *matches[i]["createdAt"].S+*matches[i]["id"].S < *matches[j]["createdAt"].S+*matches[j]["id"].S
+
+		return before == *input.ScanIndexForward
+	})
+
+	if input.ExclusiveStartKey != nil {
+		for index, item := range matches {
+			if *item["id"].S == *input.ExclusiveStartKey["id"].S {
+				matches = matches[index+1:]
+				break
+			}
+		}
+	}
+
+	output := &dynamodb.QueryOutput{Items: matches}
+
+	if input.Limit != nil && int64(len(matches)) > *input.Limit {
+		output.Items = matches[:*input.Limit]
+		last := output.Items[len(output.Items)-1]
+		output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"id": last["id"], "type": last["type"], "createdAt": last["createdAt"]}
+	}
+
+	return output, nil
+}
+
+// copyAttributes returns a copy of the item so it does not share memory with the requests, like a real table
+func copyAttributes(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	copied := make(map[string]*dynamodb.AttributeValue, len(item))
+
+	for name, value := range item {
+		copied[name] = copyAttribute(value)
+	}
+
+	return copied
+}
+
+func copyAttribute(value *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	attribute := &dynamodb.AttributeValue{}
+
+	if value.S != nil {
+		attribute.S = aws.String(*value.S)
+	}
+
+	if value.N != nil {
+		attribute.N = aws.String(*value.N)
+	}
+
+	if value.BOOL != nil {
+		attribute.BOOL = aws.Bool(*value.BOOL)
+	}
+
+	if value.M != nil {
+		attribute.M = copyAttributes(value.M)
+	}
+
+	for _, element := range value.L {
+		attribute.L = append(attribute.L, copyAttribute(element))
+	}
+
+	return attribute
+}
+
+func TestAWSPersistenceManager_Conformance(t *testing.T) {
+	persistencetest.RunRepositorySuite(t, func(t *testing.T) persistence.BasicRepository {
+		tableName := "multimedia"
+		repository, err := persistence.NewDynamoDBRepository(&tableName, &MemoryDynamoDB{})
+
+		if err != nil {
+			t.Fatalf("NewDynamoDBRepository() error = %v", err)
+		}
+
+		repository.ReferenceTableName = aws.String("multimedia-references")
+
+		return repository
+	})
+}
+
+func TestMemoryRepository_Conformance(t *testing.T) {
+	persistencetest.RunRepositorySuite(t, func(t *testing.T) persistence.BasicRepository {
+		return persistence.NewMemoryRepository()
+	})
+}
@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DefaultHashIndex is the global secondary index with "hash" as hash key and "createdAt" as range key,
+// the items without hash are not projected
+const DefaultHashIndex = "hash-createdAt-index"
+
+// HashFindable finds the items that share the content of a file
+type HashFindable interface {
+	// FindByHash returns the items with the given hash sorted by CreatedAt
+	FindByHash(hash string) ([]*MultimediaItem, error)
+}
+
+// FindByHash queries every page of the hash index
+func (manager *AWSPersistenceManager) FindByHash(hash string) ([]*MultimediaItem, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                 manager.TableName,
+		IndexName:                 aws.String(manager.hashIndex()),
+		KeyConditionExpression:    aws.String("#hash = :hash"),
+		ExpressionAttributeNames:  map[string]*string{"#hash": aws.String("hash")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":hash": {S: aws.String(hash)}},
+		ScanIndexForward:          aws.Bool(true),
+	}
+	var result []*MultimediaItem
+
+	for {
+		output, err := manager.DynamoDB.Query(input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, response := range output.Items {
+			item, err := mapItemOutput(response)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, item)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return result, nil
+		}
+
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+func (manager *AWSPersistenceManager) hashIndex() string {
+	if manager.HashIndex == "" {
+		return DefaultHashIndex
+	}
+
+	return manager.HashIndex
+}
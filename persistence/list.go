@@ -0,0 +1,270 @@
+package persistence
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// DefaultTypeIndex is the global secondary index with "type" as hash key and "createdAt" as range key
+	DefaultTypeIndex = "type-createdAt-index"
+	DefaultPageSize  = 20
+	MaxPageSize      = 100
+)
+
+// ItemTypes are the types listed when ListOptions has no type
+var ItemTypes = []string{SOUND, IMAGE, PDF, VIDEO}
+
+// ListOptions filters and sorts the listed items, zero values mean no filter
+type ListOptions struct {
+	Type          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Descending lists the newest items first
+	Descending bool
+	// Limit is the page size, DefaultPageSize when zero and never more than MaxPageSize
+	Limit int
+	// Cursor is the Page.Cursor of the previous page
+	Cursor string
+}
+
+// Page is a list of items sorted by CreatedAt, Cursor is empty on the last page
+type Page struct {
+	Items  []*MultimediaItem `json:"items"`
+	Cursor string            `json:"cursor,omitempty"`
+}
+
+type Listable interface {
+	List(options ListOptions) (*Page, error)
+}
+
+// InvalidCursorError is returned when a cursor was not created by the repository
+type InvalidCursorError struct {
+	Message string
+}
+
+func (err InvalidCursorError) Error() string {
+	return err.Message
+}
+
+// pageSize returns the Limit within 1 and MaxPageSize
+func (options ListOptions) pageSize() int {
+	if options.Limit <= 0 {
+		return DefaultPageSize
+	}
+
+	if options.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+
+	return options.Limit
+}
+
+// types returns the types to list
+func (options ListOptions) types() []string {
+	if options.Type == "" {
+		return ItemTypes
+	}
+
+	return []string{options.Type}
+}
+
+// before reports if the item goes before the other item in the requested order, items created at
+// the same time keep the order of the index so the listed items of every type are a prefix of its query
+func (options ListOptions) before(item, other *MultimediaItem) bool {
+	if options.Descending {
+		return *item.CreatedAt > *other.CreatedAt
+	}
+
+	return *item.CreatedAt < *other.CreatedAt
+}
+
+// listCursor keeps the last listed key of every type, the types without more items are Done
+type listCursor struct {
+	Keys map[string]map[string]string `json:"k,omitempty"`
+	Done []string                     `json:"d,omitempty"`
+}
+
+func decodeCursor(cursor string) (*listCursor, error) {
+	decoded := &listCursor{Keys: map[string]map[string]string{}}
+
+	if cursor == "" {
+		return decoded, nil
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return nil, InvalidCursorError{Message: "The cursor is not valid"}
+	}
+
+	if err = json.Unmarshal(content, decoded); err != nil {
+		return nil, InvalidCursorError{Message: "The cursor is not valid"}
+	}
+
+	if decoded.Keys == nil {
+		decoded.Keys = map[string]map[string]string{}
+	}
+
+	return decoded, nil
+}
+
+func (cursor *listCursor) encode() string {
+	content, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func (cursor *listCursor) isDone(fileType string) bool {
+	for _, done := range cursor.Done {
+		if done == fileType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// List queries the type index of every requested type and merges the results sorted by CreatedAt
+func (manager *AWSPersistenceManager) List(options ListOptions) (*Page, error) {
+	cursor, err := decodeCursor(options.Cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	limit := options.pageSize()
+	var candidates []*MultimediaItem
+	exhausted := map[string]bool{}
+
+	for _, fileType := range options.types() {
+		if cursor.isDone(fileType) {
+			continue
+		}
+
+		output, err := manager.DynamoDB.Query(manager.listQuery(fileType, options, cursor.Keys[fileType], limit))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, response := range output.Items {
+			item, err := mapItemOutput(response)
+
+			if err != nil {
+				return nil, err
+			}
+
+			candidates = append(candidates, item)
+		}
+
+		exhausted[fileType] = len(output.LastEvaluatedKey) == 0
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return options.before(candidates[i], candidates[j])
+	})
+
+	page := &Page{Items: candidates}
+
+	if len(candidates) > limit {
+		page.Items = candidates[:limit]
+	}
+
+	next := &listCursor{Keys: cursor.Keys, Done: cursor.Done}
+
+	for _, item := range page.Items {
+		next.Keys[*item.Type] = map[string]string{"id": *item.ID, "type": *item.Type, "createdAt": *item.CreatedAt}
+	}
+
+	for _, item := range candidates[len(page.Items):] {
+		exhausted[*item.Type] = false
+	}
+
+	more := false
+
+	for _, fileType := range options.types() {
+		if next.isDone(fileType) {
+			continue
+		}
+
+		if exhausted[fileType] {
+			next.Done = append(next.Done, fileType)
+			delete(next.Keys, fileType)
+		} else {
+			more = true
+		}
+	}
+
+	if more {
+		page.Cursor = next.encode()
+	}
+
+	return page, nil
+}
+
+func (manager *AWSPersistenceManager) listQuery(fileType string, options ListOptions, startKey map[string]string, limit int) *dynamodb.QueryInput {
+	condition := "#type = :type"
+	names := map[string]*string{"#type": aws.String("type")}
+	values := map[string]*dynamodb.AttributeValue{":type": {S: aws.String(fileType)}}
+
+	if !options.CreatedAfter.IsZero() || !options.CreatedBefore.IsZero() {
+		names["#createdAt"] = aws.String("createdAt")
+	}
+
+	switch {
+	case !options.CreatedAfter.IsZero() && !options.CreatedBefore.IsZero():
+		condition += " AND #createdAt BETWEEN :after AND :before"
+	case !options.CreatedAfter.IsZero():
+		condition += " AND #createdAt >= :after"
+	case !options.CreatedBefore.IsZero():
+		condition += " AND #createdAt <= :before"
+	}
+
+	if !options.CreatedAfter.IsZero() {
+		values[":after"] = &dynamodb.AttributeValue{S: aws.String(formatCreatedAt(options.CreatedAfter))}
+	}
+
+	if !options.CreatedBefore.IsZero() {
+		values[":before"] = &dynamodb.AttributeValue{S: aws.String(formatCreatedAt(options.CreatedBefore))}
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 manager.TableName,
+		IndexName:                 aws.String(manager.typeIndex()),
+		KeyConditionExpression:    aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(!options.Descending),
+		Limit:                     aws.Int64(int64(limit)),
+	}
+
+	if startKey != nil {
+		input.ExclusiveStartKey = make(map[string]*dynamodb.AttributeValue, len(startKey))
+
+		for name, value := range startKey {
+			input.ExclusiveStartKey[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+		}
+	}
+
+	return input
+}
+
+func (manager *AWSPersistenceManager) typeIndex() string {
+	if manager.TypeIndex == "" {
+		return DefaultTypeIndex
+	}
+
+	return manager.TypeIndex
+}
+
+// formatCreatedAt formats the date in UTC as NewMultimediaItem does, so the dates sort chronologically
+// when they are compared as strings regardless of the time zone of the host
+func formatCreatedAt(date time.Time) string {
+	return date.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,157 @@
+package persistence
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DynamoDBIndex answers the queries of the type index from Items
+type DynamoDBIndex struct {
+	DynamoDBSuccess
+	Items []*MultimediaItem
+}
+
+func (dynamo *DynamoDBIndex) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	if *input.IndexName != DefaultTypeIndex {
+		return nil, InvalidArguments{Message: aws.String("Unknown index")}
+	}
+
+	var matches []*MultimediaItem
+
+	for _, item := range dynamo.Items {
+		after, before := input.ExpressionAttributeValues[":after"], input.ExpressionAttributeValues[":before"]
+
+		if *item.Type != *input.ExpressionAttributeValues[":type"].S ||
+			(after != nil && *item.CreatedAt < *after.S) || (before != nil && *item.CreatedAt > *before.S) {
+			continue
+		}
+
+		matches = append(matches, item)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if *input.ScanIndexForward {
+			return *matches[i].CreatedAt < *matches[j].CreatedAt
+		}
+
+		return *matches[i].CreatedAt > *matches[j].CreatedAt
+	})
+
+	if input.ExclusiveStartKey != nil {
+		for index, item := range matches {
+			if *item.ID == *input.ExclusiveStartKey["id"].S {
+				matches = matches[index+1:]
+				break
+			}
+		}
+	}
+
+	output := &dynamodb.QueryOutput{}
+
+	for index, item := range matches {
+		if int64(index) == *input.Limit {
+			output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"id": {S: matches[index-1].ID}}
+			break
+		}
+
+		output.Items = append(output.Items, map[string]*dynamodb.AttributeValue{
+			"id":        {S: item.ID},
+			"bucket":    {S: item.Bucket},
+			"filename":  {S: item.Filename},
+			"type":      {S: item.Type},
+			"createdAt": {S: item.CreatedAt},
+		})
+	}
+
+	return output, nil
+}
+
+func indexedItems() []*MultimediaItem {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := make([]*MultimediaItem, 17)
+
+	for index := range items {
+		items[index] = &MultimediaItem{
+			ID:        aws.String(fmt.Sprintf("item-%02d", index)),
+			Bucket:    aws.String("http://example.com"),
+			Filename:  aws.String(fmt.Sprintf("item-%02d", index)),
+			Type:      aws.String(ItemTypes[index%len(ItemTypes)]),
+			CreatedAt: aws.String(formatCreatedAt(start.Add(time.Duration(index) * time.Hour))),
+		}
+	}
+
+	return items
+}
+
+func listAll(manager *AWSPersistenceManager, options ListOptions) ([]string, error) {
+	var ids []string
+
+	for {
+		page, err := manager.List(options)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Items {
+			ids = append(ids, *item.ID)
+		}
+
+		if page.Cursor == "" {
+			return ids, nil
+		}
+
+		options.Cursor = page.Cursor
+	}
+}
+
+func TestAWSPersistenceManager_List(t *testing.T) {
+	items := indexedItems()
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		options ListOptions
+		want    []int
+	}{
+		{name: "Lists every item", options: ListOptions{Limit: 3}, want: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{name: "Lists the newest items first", options: ListOptions{Limit: 4, Descending: true}, want: []int{16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}},
+		{name: "Filters by type", options: ListOptions{Limit: 2, Type: IMAGE}, want: []int{1, 5, 9, 13}},
+		{name: "Filters by date", options: ListOptions{CreatedAfter: start.Add(3 * time.Hour), CreatedBefore: start.Add(6 * time.Hour)}, want: []int{3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &AWSPersistenceManager{DynamoDB: &DynamoDBIndex{Items: items}, TableName: aws.String("example")}
+			got, err := listAll(manager, tt.options)
+			if err != nil {
+				t.Errorf("List() error = %v", err)
+				return
+			}
+			want := make([]string, len(tt.want))
+			for index, position := range tt.want {
+				want[index] = *items[position].ID
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("List() got = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestAWSPersistenceManager_ListInvalidCursor(t *testing.T) {
+	manager := &AWSPersistenceManager{DynamoDB: &DynamoDBIndex{}, TableName: aws.String("example")}
+
+	if _, err := manager.List(ListOptions{Cursor: "not a cursor"}); err == nil {
+		t.Errorf("List() expects an InvalidCursorError")
+	} else if _, ok := err.(InvalidCursorError); !ok {
+		t.Errorf("List() error = %v, want InvalidCursorError", err)
+	}
+
+	if _, err := (&AWSPersistenceManager{DynamoDB: &DynamoDBFail{}, TableName: aws.String("example")}).List(ListOptions{}); err == nil {
+		t.Errorf("List() must return an error if DynamoDB Fails")
+	}
+}
@@ -0,0 +1,275 @@
+package persistence
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemoryRepository keeps the items in memory, it is safe for concurrent use and it is meant for
+// local development and tests
+type MemoryRepository struct {
+	mutex      sync.RWMutex
+	items      map[string]*MultimediaItem
+	references map[string]*fileReferences
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{items: make(map[string]*MultimediaItem)}
+}
+
+func (repository *MemoryRepository) Store(item *MultimediaItem) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	ID := uuid.New().String()
+	stored := copyItem(item)
+	stored.ID = &ID
+	repository.items[ID] = stored
+	item.ID = &ID
+
+	return nil
+}
+
+func (repository *MemoryRepository) Update(item *MultimediaItem) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, ok := repository.items[*item.ID]; !ok {
+		return NotFoundError{ID: *item.ID}
+	}
+
+	repository.items[*item.ID] = copyItem(item)
+
+	return nil
+}
+
+func (repository *MemoryRepository) Remove(ID *string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	delete(repository.items, *ID)
+
+	return nil
+}
+
+func (repository *MemoryRepository) Find(ID *string) (*MultimediaItem, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	item, ok := repository.items[*ID]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return copyItem(item), nil
+}
+
+// FindMany returns the existing items in the order of the given IDs, missing IDs are ignored
+func (repository *MemoryRepository) FindMany(ids []*string) ([]*MultimediaItem, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	var result []*MultimediaItem
+	seen := make(map[string]bool, len(ids))
+
+	for _, ID := range ids {
+		if ID == nil || seen[*ID] {
+			continue
+		}
+
+		seen[*ID] = true
+
+		if item, ok := repository.items[*ID]; ok {
+			result = append(result, copyItem(item))
+		}
+	}
+
+	return result, nil
+}
+
+// List returns the items sorted by CreatedAt, items created at the same time are sorted by ID
+func (repository *MemoryRepository) List(options ListOptions) (*Page, error) {
+	after, err := decodeKeyCursor(options.Cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	repository.mutex.RLock()
+	var matches []*MultimediaItem
+
+	for _, item := range repository.items {
+		if options.matches(item) {
+			matches = append(matches, copyItem(item))
+		}
+	}
+	repository.mutex.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return options.sortsBefore(sortKey(matches[i]), sortKey(matches[j]))
+	})
+
+	if after != "" {
+		position := sort.Search(len(matches), func(index int) bool {
+			return options.sortsBefore(after, sortKey(matches[index]))
+		})
+		matches = matches[position:]
+	}
+
+	page := &Page{Items: matches}
+
+	if limit := options.pageSize(); len(matches) > limit {
+		page.Items = matches[:limit]
+		page.Cursor = encodeKeyCursor(page.Items[limit-1])
+	}
+
+	return page, nil
+}
+
+// matches reports if the item passes the type and date filters
+func (options ListOptions) matches(item *MultimediaItem) bool {
+	if options.Type != "" && *item.Type != options.Type {
+		return false
+	}
+
+	if !options.CreatedAfter.IsZero() && *item.CreatedAt < formatCreatedAt(options.CreatedAfter) {
+		return false
+	}
+
+	return options.CreatedBefore.IsZero() || *item.CreatedAt <= formatCreatedAt(options.CreatedBefore)
+}
+
+// sortsBefore compares two keys created by sortKey in the requested order
+func (options ListOptions) sortsBefore(key, other string) bool {
+	if options.Descending {
+		return key > other
+	}
+
+	return key < other
+}
+
+// sortKey sorts the items by CreatedAt and then by ID
+func sortKey(item *MultimediaItem) string {
+	return *item.CreatedAt + "|" + *item.ID
+}
+
+// encodeKeyCursor returns a cursor that lists the items after the given item
+func encodeKeyCursor(item *MultimediaItem) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortKey(item)))
+}
+
+// decodeKeyCursor returns the sortKey of a cursor created by encodeKeyCursor, empty for the first page
+func decodeKeyCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil || !strings.Contains(string(key), "|") {
+		return "", InvalidCursorError{Message: "The cursor is not valid"}
+	}
+
+	return string(key), nil
+}
+
+// FindByHash returns the items with the given hash sorted by CreatedAt
+func (repository *MemoryRepository) FindByHash(hash string) ([]*MultimediaItem, error) {
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	var result []*MultimediaItem
+
+	for _, item := range repository.items {
+		if item.Hash != nil && *item.Hash == hash {
+			result = append(result, copyItem(item))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return sortKey(result[i]) < sortKey(result[j])
+	})
+
+	return result, nil
+}
+
+// AddReference records another item sharing the file
+func (repository *MemoryRepository) AddReference(file string) (bool, error) {
+	return repository.updateReferences(file, (*fileReferences).add), nil
+}
+
+// ReleaseReference removes a reference of the file
+func (repository *MemoryRepository) ReleaseReference(file string) (bool, error) {
+	return repository.updateReferences(file, (*fileReferences).release), nil
+}
+
+func (repository *MemoryRepository) updateReferences(file string, update func(*fileReferences) bool) bool {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if repository.references == nil {
+		repository.references = make(map[string]*fileReferences)
+	}
+
+	references, ok := repository.references[file]
+
+	if !ok {
+		references = &fileReferences{File: file}
+		repository.references[file] = references
+	}
+
+	return update(references)
+}
+
+// copyItem returns a copy that does not share pointers with the given item
+func copyItem(item *MultimediaItem) *MultimediaItem {
+	copied := *item
+	copied.ID = copyString(item.ID)
+	copied.Bucket = copyString(item.Bucket)
+	copied.Filename = copyString(item.Filename)
+	copied.Type = copyString(item.Type)
+	copied.CreatedAt = copyString(item.CreatedAt)
+	copied.Visibility = copyString(item.Visibility)
+	copied.Hash = copyString(item.Hash)
+
+	if item.Video != nil {
+		video := *item.Video
+		copied.Video = &video
+	}
+
+	if item.Image != nil {
+		image := *item.Image
+		copied.Image = &image
+	}
+
+	if item.Document != nil {
+		document := *item.Document
+		copied.Document = &document
+	}
+
+	if item.Audio != nil {
+		audio := *item.Audio
+		copied.Audio = &audio
+	}
+
+	if item.Renditions != nil {
+		copied.Renditions = append([]Rendition{}, item.Renditions...)
+	}
+
+	return &copied
+}
+
+func copyString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+
+	copied := *value
+
+	return &copied
+}
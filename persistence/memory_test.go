@@ -0,0 +1,124 @@
+package persistence
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestMemoryRepository_Store(t *testing.T) {
+	repository := NewMemoryRepository()
+	item, _ := NewMultimediaItem(aws.String("http://example.com"), aws.String("example.png"), aws.String(IMAGE))
+
+	if err := repository.Store(item); err != nil || item.ID == nil {
+		t.Errorf("Store() error = %v, ID = %v", err, item.ID)
+		return
+	}
+
+	*item.Filename = "changed.png"
+	found, err := repository.Find(item.ID)
+
+	if err != nil || found == nil || *found.Filename != "example.png" {
+		t.Errorf("Find() got = %+v, error = %v, stored items must not share memory", found, err)
+	}
+
+	missing, err := repository.Find(aws.String("unknown"))
+
+	if err != nil || missing != nil {
+		t.Errorf("Find() got = %+v, error = %v, want nil for unknown IDs", missing, err)
+	}
+
+	if err = repository.Remove(item.ID); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+
+	if removed, _ := repository.Find(item.ID); removed != nil {
+		t.Errorf("Remove() did not remove the item")
+	}
+}
+
+func TestMemoryRepository_FindMany(t *testing.T) {
+	repository := NewMemoryRepository()
+	first, _ := NewMultimediaItem(aws.String("http://example.com"), aws.String("first.png"), aws.String(IMAGE))
+	second, _ := NewMultimediaItem(aws.String("http://example.com"), aws.String("second.png"), aws.String(IMAGE))
+	_ = repository.Store(first)
+	_ = repository.Store(second)
+
+	got, err := repository.FindMany([]*string{second.ID, aws.String("unknown"), first.ID, second.ID})
+
+	if err != nil || len(got) != 2 || *got[0].ID != *second.ID || *got[1].ID != *first.ID {
+		t.Errorf("FindMany() got = %v, error = %v, want the items in the order of the IDs", got, err)
+	}
+}
+
+func TestMemoryRepository_List(t *testing.T) {
+	repository := NewMemoryRepository()
+
+	for _, item := range indexedItems() {
+		_ = repository.Store(item)
+	}
+
+	tests := []struct {
+		name    string
+		options ListOptions
+		want    int
+	}{
+		{name: "Lists every item", options: ListOptions{Limit: 3}, want: 17},
+		{name: "Filters by type", options: ListOptions{Limit: 2, Type: IMAGE, Descending: true}, want: 4},
+		{name: "Filters by date", options: ListOptions{CreatedBefore: time.Date(2019, 1, 1, 2, 0, 0, 0, time.UTC)}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*MultimediaItem
+			options := tt.options
+			for {
+				page, err := repository.List(options)
+				if err != nil {
+					t.Errorf("List() error = %v", err)
+					return
+				}
+				got = append(got, page.Items...)
+				if page.Cursor == "" {
+					break
+				}
+				options.Cursor = page.Cursor
+			}
+			if len(got) != tt.want {
+				t.Errorf("List() got %v items, want %v", len(got), tt.want)
+				return
+			}
+			for index := 1; index < len(got); index++ {
+				if (*got[index-1].CreatedAt > *got[index].CreatedAt) != tt.options.Descending {
+					t.Errorf("List() items are not sorted by CreatedAt: %v", fmt.Sprint(*got[index-1].CreatedAt, *got[index].CreatedAt))
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRepository_Concurrency(t *testing.T) {
+	repository := NewMemoryRepository()
+	var group sync.WaitGroup
+
+	for index := 0; index < 50; index++ {
+		group.Add(1)
+
+		go func(index int) {
+			defer group.Done()
+
+			item, _ := NewMultimediaItem(aws.String("http://example.com"), aws.String(fmt.Sprintf("%v.png", index)), aws.String(IMAGE))
+			_ = repository.Store(item)
+			_, _ = repository.Find(item.ID)
+			_, _ = repository.List(ListOptions{})
+		}(index)
+	}
+
+	group.Wait()
+
+	if page, _ := repository.List(ListOptions{Limit: MaxPageSize}); len(page.Items) != 50 {
+		t.Errorf("Store() stored %v items, want 50", len(page.Items))
+	}
+}
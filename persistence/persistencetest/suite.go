@@ -0,0 +1,347 @@
+// Package persistencetest verifies that persistence.BasicRepository implementations behave the same way
+package persistencetest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// RepositoryFactory returns an empty repository, it is called once per test
+type RepositoryFactory func(t *testing.T) persistence.BasicRepository
+
+// RunRepositorySuite runs the conformance tests against the repositories returned by the factory, the
+// listing, update, hash and reference tests only run when the repositories implement persistence.Listable,
+// persistence.Updatable, persistence.HashFindable and persistence.ReferenceCounter
+func RunRepositorySuite(t *testing.T, factory RepositoryFactory) {
+	t.Run("Store", func(t *testing.T) { testStore(t, factory(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, factory(t)) })
+	t.Run("Remove", func(t *testing.T) { testRemove(t, factory(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, factory(t)) })
+	t.Run("FindMany", func(t *testing.T) { testFindMany(t, factory(t)) })
+	t.Run("List", func(t *testing.T) { testList(t, factory(t)) })
+	t.Run("FindByHash", func(t *testing.T) { testFindByHash(t, factory(t)) })
+	t.Run("References", func(t *testing.T) { testReferences(t, factory(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory(t)) })
+}
+
+// NewItem returns a valid item created the given amount of hours after 2019-01-01
+func NewItem(filename, fileType string, hours int) *persistence.MultimediaItem {
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hours) * time.Hour).Format(time.RFC3339)
+
+	return &persistence.MultimediaItem{
+		Bucket:    aws.String("https://example.s3.amazonaws.com"),
+		Filename:  aws.String(filename),
+		Type:      aws.String(fileType),
+		CreatedAt: aws.String(createdAt),
+	}
+}
+
+func store(t *testing.T, repository persistence.BasicRepository, items ...*persistence.MultimediaItem) {
+	for _, item := range items {
+		if err := repository.Store(item); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+}
+
+func testStore(t *testing.T, repository persistence.BasicRepository) {
+	item := NewItem("video.mp4", persistence.VIDEO, 0)
+	item.Visibility = aws.String(persistence.PRIVATE)
+	item.Video = &persistence.VideoMetadata{Duration: 1.5, Width: 320, Height: 240, Codec: "avc1"}
+	other := NewItem("image.png", persistence.IMAGE, 1)
+	other.Image = &persistence.ImageMetadata{Width: 640, Height: 480, Orientation: 6, ColorModel: "ycbcr"}
+	other.Hash = aws.String("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+
+	store(t, repository, item, other)
+
+	if item.ID == nil || *item.ID == "" || other.ID == nil || *item.ID == *other.ID {
+		t.Fatalf("Store() must assign a unique ID, got %v and %v", aws.StringValue(item.ID), aws.StringValue(other.ID))
+	}
+
+	got, err := repository.Find(item.ID)
+
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, item) {
+		t.Errorf("Find() got = %+v, want %+v", got, item)
+	}
+
+	document := NewItem("document.pdf", persistence.PDF, 2)
+	document.Document = &persistence.DocumentMetadata{Pages: 12, Title: "Report", Author: "Jane", Encrypted: true}
+	sound := NewItem("sound.mp3", persistence.SOUND, 3)
+	sound.Audio = &persistence.AudioMetadata{Duration: 2.5, Bitrate: 128000, SampleRate: 44100, Channels: 2, Codec: "mp3", Title: "Song", Artist: "Band"}
+	store(t, repository, document, sound)
+
+	for _, want := range []*persistence.MultimediaItem{other, document, sound} {
+		if got, err := repository.Find(want.ID); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Find() got = %+v, error = %v, want %+v", got, err, want)
+		}
+	}
+
+	*got.Filename = "changed.mp4"
+
+	if found, _ := repository.Find(item.ID); found == nil || *found.Filename != "video.mp4" {
+		t.Errorf("Find() the returned items must not share memory with the stored items")
+	}
+}
+
+func testUpdate(t *testing.T, repository persistence.BasicRepository) {
+	updatable, ok := repository.(persistence.Updatable)
+
+	if !ok {
+		t.Skip("the repository does not implement persistence.Updatable")
+	}
+
+	item := NewItem("image.png", persistence.IMAGE, 0)
+	store(t, repository, item)
+
+	item.Renditions = []persistence.Rendition{
+		{Name: "thumbnail", Key: "image_thumbnail.jpg", Width: 200, Height: 100, ContentType: "image/jpeg"},
+	}
+
+	if err := updatable.Update(item); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if got, err := repository.Find(item.ID); err != nil || !reflect.DeepEqual(got, item) {
+		t.Errorf("Find() got = %+v, error = %v, want the updated item %+v", got, err, item)
+	}
+
+	missing := NewItem("missing.png", persistence.IMAGE, 0)
+	missing.ID = aws.String("missing")
+
+	if err := updatable.Update(missing); err == nil {
+		t.Errorf("Update() expects an error for missing items")
+	} else if _, ok := err.(persistence.NotFoundError); !ok {
+		t.Errorf("Update() error = %v, want persistence.NotFoundError", err)
+	}
+
+	if got, _ := repository.Find(missing.ID); got != nil {
+		t.Errorf("Update() must not create missing items")
+	}
+}
+
+func testRemove(t *testing.T, repository persistence.BasicRepository) {
+	item := NewItem("sound.mp3", persistence.SOUND, 0)
+	store(t, repository, item)
+
+	if err := repository.Remove(item.ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	if got, err := repository.Find(item.ID); err != nil || got != nil {
+		t.Errorf("Find() got = %+v, error = %v, want nil after Remove()", got, err)
+	}
+
+	if err := repository.Remove(item.ID); err != nil {
+		t.Errorf("Remove() error = %v, removing a missing item is not an error", err)
+	}
+}
+
+func testNotFound(t *testing.T, repository persistence.BasicRepository) {
+	if got, err := repository.Find(aws.String("missing")); err != nil || got != nil {
+		t.Errorf("Find() got = %+v, error = %v, want nil without error", got, err)
+	}
+
+	if got, err := repository.FindMany([]*string{aws.String("missing")}); err != nil || len(got) != 0 {
+		t.Errorf("FindMany() got = %v, error = %v, want no items without error", got, err)
+	}
+}
+
+func testFindMany(t *testing.T, repository persistence.BasicRepository) {
+	first := NewItem("first.png", persistence.IMAGE, 0)
+	second := NewItem("second.pdf", persistence.PDF, 1)
+	third := NewItem("third.mp3", persistence.SOUND, 2)
+	store(t, repository, first, second, third)
+
+	got, err := repository.FindMany([]*string{third.ID, aws.String("missing"), first.ID, third.ID})
+
+	if err != nil {
+		t.Fatalf("FindMany() error = %v", err)
+	}
+
+	if len(got) != 2 || *got[0].ID != *third.ID || *got[1].ID != *first.ID {
+		t.Errorf("FindMany() must return each existing item once in the order of the IDs, got %v", got)
+	}
+}
+
+func testFindByHash(t *testing.T, repository persistence.BasicRepository) {
+	hashFindable, ok := repository.(persistence.HashFindable)
+
+	if !ok {
+		t.Skip("the repository does not implement persistence.HashFindable")
+	}
+
+	hash := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	second := NewItem("logo.png", persistence.IMAGE, 2)
+	second.Hash = aws.String(hash)
+	first := NewItem("logo.png", persistence.IMAGE, 1)
+	first.Hash = aws.String(hash)
+	other := NewItem("other.png", persistence.IMAGE, 0)
+	other.Hash = aws.String("fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9")
+	store(t, repository, second, first, other, NewItem("without-hash.png", persistence.IMAGE, 3))
+
+	got, err := hashFindable.FindByHash(hash)
+
+	if err != nil {
+		t.Fatalf("FindByHash() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, []*persistence.MultimediaItem{first, second}) {
+		t.Errorf("FindByHash() got = %+v, want the items with the hash sorted by CreatedAt", got)
+	}
+
+	if got, err = hashFindable.FindByHash("missing"); err != nil || len(got) != 0 {
+		t.Errorf("FindByHash() got = %v, error = %v, want no items", got, err)
+	}
+}
+
+func testReferences(t *testing.T, repository persistence.BasicRepository) {
+	counter, ok := repository.(persistence.ReferenceCounter)
+
+	if !ok {
+		t.Skip("the repository does not implement persistence.ReferenceCounter")
+	}
+
+	file := "https://example.s3.amazonaws.com/logo.png"
+	steps := []struct {
+		name    string
+		update  func(file string) (bool, error)
+		want    bool
+		message string
+	}{
+		{"AddReference", counter.AddReference, true, "a file that was not released can be referenced"},
+		{"AddReference", counter.AddReference, true, "a file can be referenced several times"},
+		{"ReleaseReference", counter.ReleaseReference, true, "the file has another reference"},
+		{"ReleaseReference", counter.ReleaseReference, true, "the file has another reference"},
+		{"ReleaseReference", counter.ReleaseReference, false, "the file has no references left"},
+		{"AddReference", counter.AddReference, false, "a released file can not be referenced"},
+		{"ReleaseReference", counter.ReleaseReference, false, "a released file has no references"},
+	}
+
+	for index, step := range steps {
+		if got, err := step.update(file); err != nil || got != step.want {
+			t.Errorf("step %v: %v() got = %v, error = %v, want %v, %v", index+1, step.name, got, err, step.want, step.message)
+		}
+	}
+
+	if got, err := counter.ReleaseReference("https://example.s3.amazonaws.com/other.png"); err != nil || got {
+		t.Errorf("ReleaseReference() got = %v, error = %v, the files never referenced have no references", got, err)
+	}
+}
+
+func testList(t *testing.T, repository persistence.BasicRepository) {
+	listable, ok := repository.(persistence.Listable)
+
+	if !ok {
+		t.Skip("the repository does not implement persistence.Listable")
+	}
+
+	var items []*persistence.MultimediaItem
+
+	for index := 0; index < 11; index++ {
+		item := NewItem(fmt.Sprintf("item-%v", index), persistence.ItemTypes[index%len(persistence.ItemTypes)], index)
+		store(t, repository, item)
+		items = append(items, item)
+	}
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	zone := time.FixedZone("UTC-5", -5*60*60)
+	tests := []struct {
+		name    string
+		options persistence.ListOptions
+		want    []int
+	}{
+		{name: "every item", options: persistence.ListOptions{Limit: 3}, want: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{name: "newest first", options: persistence.ListOptions{Limit: 4, Descending: true}, want: []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}},
+		{name: "by type", options: persistence.ListOptions{Limit: 1, Type: persistence.IMAGE}, want: []int{1, 5, 9}},
+		{name: "by date", options: persistence.ListOptions{CreatedAfter: start.Add(2 * time.Hour), CreatedBefore: start.Add(4 * time.Hour)}, want: []int{2, 3, 4}},
+		{name: "by date in other zone", options: persistence.ListOptions{CreatedAfter: start.Add(2 * time.Hour).In(zone), CreatedBefore: start.Add(4 * time.Hour).In(zone)}, want: []int{2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		options := tt.options
+
+		for pages := 0; pages <= len(items); pages++ {
+			page, err := listable.List(options)
+
+			if err != nil {
+				t.Fatalf("List(%v) error = %v", tt.name, err)
+			}
+
+			if len(page.Items) > options.Limit && options.Limit > 0 {
+				t.Errorf("List(%v) returned %v items, more than the limit %v", tt.name, len(page.Items), options.Limit)
+			}
+
+			for _, item := range page.Items {
+				got = append(got, *item.ID)
+			}
+
+			if page.Cursor == "" {
+				break
+			}
+
+			options.Cursor = page.Cursor
+		}
+
+		want := make([]string, len(tt.want))
+
+		for index, position := range tt.want {
+			want[index] = *items[position].ID
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("List(%v) got = %v, want %v", tt.name, got, want)
+		}
+	}
+
+	if _, err := listable.List(persistence.ListOptions{Cursor: "not a cursor"}); err == nil {
+		t.Errorf("List() expects an error for invalid cursors")
+	}
+}
+
+func testConcurrency(t *testing.T, repository persistence.BasicRepository) {
+	var group sync.WaitGroup
+	errors := make(chan error, 16)
+
+	for index := 0; index < 16; index++ {
+		group.Add(1)
+
+		go func(index int) {
+			defer group.Done()
+
+			item := NewItem(fmt.Sprintf("concurrent-%v.png", index), persistence.IMAGE, index)
+
+			if err := repository.Store(item); err != nil {
+				errors <- err
+				return
+			}
+
+			if found, err := repository.Find(item.ID); err != nil || found == nil || *found.Filename != *item.Filename {
+				errors <- fmt.Errorf("Find() got = %+v, error = %v", found, err)
+				return
+			}
+
+			if err := repository.Remove(item.ID); err != nil {
+				errors <- err
+			}
+		}(index)
+	}
+
+	group.Wait()
+	close(errors)
+
+	for err := range errors {
+		t.Errorf("concurrent Store(), Find() and Remove() error = %v", err)
+	}
+}
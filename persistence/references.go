@@ -0,0 +1,127 @@
+package persistence
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// ReferenceRetries is the amount of times the references of a file are read again when another process
+// updates them at the same time
+const ReferenceRetries = 10
+
+// ReferenceCounter counts the other items sharing a stored file with strongly consistent reads, the file of
+// an item with no other references is released before it is removed so it can not be referenced again
+type ReferenceCounter interface {
+	// AddReference records another item sharing the file, it reports false when the file was released
+	AddReference(file string) (bool, error)
+	// ReleaseReference removes a reference of the file, it reports false and releases the file when it has
+	// no references left
+	ReleaseReference(file string) (bool, error)
+}
+
+// fileReferences is the counter of a file, Count is the amount of items sharing it besides the first one
+type fileReferences struct {
+	File     string `dynamodbav:"id"`
+	Count    int64  `dynamodbav:"count"`
+	Released bool   `dynamodbav:"released"`
+	// Version is incremented on every write to detect the concurrent updates
+	Version int64 `dynamodbav:"version"`
+}
+
+// add increments the count unless the file was released
+func (references *fileReferences) add() bool {
+	if references.Released {
+		return false
+	}
+
+	references.Count++
+
+	return true
+}
+
+// release decrements the count or releases the file when it has no references
+func (references *fileReferences) release() bool {
+	if references.Count > 0 {
+		references.Count--
+
+		return true
+	}
+
+	references.Released = true
+
+	return false
+}
+
+// AddReference increments the counter of the file in the ReferenceTableName table
+func (manager *AWSPersistenceManager) AddReference(file string) (bool, error) {
+	return manager.updateReferences(file, (*fileReferences).add)
+}
+
+// ReleaseReference decrements the counter of the file in the ReferenceTableName table
+func (manager *AWSPersistenceManager) ReleaseReference(file string) (bool, error) {
+	return manager.updateReferences(file, (*fileReferences).release)
+}
+
+// updateReferences reads the counter of the file with a consistent read and writes it back on condition that
+// its version did not change, the update is applied again to the new counter otherwise
+func (manager *AWSPersistenceManager) updateReferences(file string, update func(*fileReferences) bool) (bool, error) {
+	if manager.ReferenceTableName == nil {
+		return false, fmt.Errorf("The ReferenceTableName is required to count the references of the shared files")
+	}
+
+	for attempt := 0; attempt < ReferenceRetries; attempt++ {
+		output, err := manager.DynamoDB.GetItem(&dynamodb.GetItemInput{
+			Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(file)}},
+			TableName:      manager.ReferenceTableName,
+			ConsistentRead: aws.Bool(true),
+		})
+
+		if err != nil {
+			return false, err
+		}
+
+		references := fileReferences{File: file}
+
+		if output.Item != nil {
+			if err = dynamodbattribute.UnmarshalMap(output.Item, &references); err != nil {
+				return false, err
+			}
+		}
+
+		version := references.Version
+		result := update(&references)
+		references.Version++
+		attributes, err := dynamodbattribute.MarshalMap(references)
+
+		if err != nil {
+			return false, err
+		}
+
+		input := &dynamodb.PutItemInput{
+			TableName:                manager.ReferenceTableName,
+			Item:                     attributes,
+			ConditionExpression:      aws.String("attribute_not_exists(#key)"),
+			ExpressionAttributeNames: map[string]*string{"#key": aws.String("id")},
+		}
+
+		if output.Item != nil {
+			input.ConditionExpression = aws.String("#version = :version")
+			input.ExpressionAttributeNames = map[string]*string{"#version": aws.String("version")}
+			input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":version": {N: aws.String(fmt.Sprint(version))}}
+		}
+
+		_, err = manager.DynamoDB.PutItem(input)
+
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue
+		}
+
+		return result, err
+	}
+
+	return false, fmt.Errorf("The references of %v were updated by other processes %v times", file, ReferenceRetries)
+}
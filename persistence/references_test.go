@@ -0,0 +1,70 @@
+package persistence_test
+
+import (
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// InterleavingDynamoDB adds a reference from another process between the read and the write of the first
+// updates of the counters
+type InterleavingDynamoDB struct {
+	*MemoryDynamoDB
+	manager      *persistence.AWSPersistenceManager
+	interleaving int
+}
+
+func (dynamo *InterleavingDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if dynamo.interleaving > 0 {
+		dynamo.interleaving--
+		other := &persistence.AWSPersistenceManager{DynamoDB: dynamo.MemoryDynamoDB, ReferenceTableName: dynamo.manager.ReferenceTableName}
+
+		if _, err := other.AddReference(*input.Item["id"].S); err != nil {
+			return nil, err
+		}
+	}
+
+	return dynamo.MemoryDynamoDB.PutItem(input)
+}
+
+func TestAWSPersistenceManager_ReleaseReferenceConcurrently(t *testing.T) {
+	dynamo := &InterleavingDynamoDB{MemoryDynamoDB: &MemoryDynamoDB{}}
+	manager := &persistence.AWSPersistenceManager{DynamoDB: dynamo, TableName: aws.String("multimedia"), ReferenceTableName: aws.String("references")}
+	dynamo.manager = manager
+
+	if _, err := manager.AddReference("logo.png"); err != nil {
+		t.Fatalf("AddReference() error = %v", err)
+	}
+
+	// the release reads one reference, the other process adds another one before it is written
+	dynamo.interleaving = 1
+
+	if got, err := manager.ReleaseReference("logo.png"); err != nil || !got {
+		t.Errorf("ReleaseReference() got = %v, error = %v, want true", got, err)
+	}
+
+	if got, err := manager.ReleaseReference("logo.png"); err != nil || !got {
+		t.Errorf("ReleaseReference() got = %v, error = %v, the concurrent reference must not be lost", got, err)
+	}
+
+	if got, err := manager.ReleaseReference("logo.png"); err != nil || got {
+		t.Errorf("ReleaseReference() got = %v, error = %v, want the file released", got, err)
+	}
+
+	dynamo.interleaving = persistence.ReferenceRetries
+
+	if _, err := manager.AddReference("other.png"); err == nil {
+		t.Errorf("AddReference() expects an error after %v concurrent updates", persistence.ReferenceRetries)
+	}
+}
+
+func TestAWSPersistenceManager_ReferencesWithoutTable(t *testing.T) {
+	manager := &persistence.AWSPersistenceManager{DynamoDB: &MemoryDynamoDB{}, TableName: aws.String("multimedia")}
+
+	if _, err := manager.AddReference("logo.png"); err == nil {
+		t.Errorf("AddReference() expects an error without ReferenceTableName")
+	}
+}
@@ -1,13 +1,21 @@
+// Package persistence stores the multimedia items in DynamoDB, in memory or in a SQL database. The
+// SQLRepository does not import a database driver, the programs using it must import one for its dialect
+// e.g. github.com/lib/pq for the PostgresDialect:
+//
+//	import _ "github.com/lib/pq"
 package persistence
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/google/uuid"
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -19,12 +27,78 @@ const (
 	VIDEO = "video"
 )
 
+const (
+	PUBLIC  = "public"
+	PRIVATE = "private"
+)
+
 type MultimediaItem struct {
 	ID        *string `json:"id"`
 	Bucket    *string `json:"bucket" validate:"required,url"`
 	Filename  *string `json:"filename" validate:"required"`
-	Type      *string `json:"type" validate:"required,oneof=sound image pdf"`
+	Type      *string `json:"type" validate:"required,oneof=sound image pdf video"`
 	CreatedAt *string `json:"createdAt"`
+	// Visibility is PUBLIC or PRIVATE, items without visibility are public
+	Visibility *string           `json:"visibility,omitempty" validate:"omitempty,oneof=public private"`
+	Video      *VideoMetadata    `json:"video,omitempty"`
+	Image      *ImageMetadata    `json:"image,omitempty"`
+	Document   *DocumentMetadata `json:"document,omitempty"`
+	Audio      *AudioMetadata    `json:"audio,omitempty"`
+	Renditions []Rendition       `json:"renditions,omitempty"`
+	// Hash is the hexadecimal SHA-256 of the uploaded file before its EXIF is removed, the items with the same
+	// hash may share the file
+	Hash *string `json:"hash,omitempty"`
+}
+
+// Rendition is a resized copy of an IMAGE item stored next to the original file
+type Rendition struct {
+	Name        string `json:"name"`
+	Key         string `json:"key"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"contentType"`
+}
+
+// VideoMetadata describes the first video track of a VIDEO item
+type VideoMetadata struct {
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Codec    string  `json:"codec"`
+}
+
+// ImageMetadata describes an IMAGE item, the width and height are the stored ones before applying the orientation
+type ImageMetadata struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Orientation is the EXIF orientation from 1 to 8, 1 when the image does not have one
+	Orientation int `json:"orientation"`
+	// ColorModel is the color model of the decoded image e.g. "ycbcr", "rgba" or "paletted"
+	ColorModel string `json:"colorModel"`
+}
+
+// DocumentMetadata describes a PDF item
+type DocumentMetadata struct {
+	Pages  int    `json:"pages"`
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+	// Encrypted reports if the document has permissions protected by an owner password
+	Encrypted bool `json:"encrypted"`
+}
+
+// AudioMetadata describes a SOUND item
+type AudioMetadata struct {
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	// Bitrate is the average amount of bits per second
+	Bitrate    int    `json:"bitrate"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+	Codec      string `json:"codec"`
+	Title      string `json:"title,omitempty"`
+	Artist     string `json:"artist,omitempty"`
+	Album      string `json:"album,omitempty"`
 }
 
 // Key returns the primary value
@@ -32,11 +106,34 @@ func (item MultimediaItem) Key() *string {
 	return item.ID
 }
 
-func NewMultimediaItem(bucket, filename, fileType *string) (*MultimediaItem, error) {
-	id := uuid.New().String()
+// URLSigner creates time-limited URLs for private items
+type URLSigner interface {
+	PresignGet(path *string, expires time.Duration, disposition string) (string, error)
+}
+
+// IsPrivate reports if the item can only be accessed through signed URLs
+func (item MultimediaItem) IsPrivate() bool {
+	return item.Visibility != nil && *item.Visibility == PRIVATE
+}
+
+// AccessURL returns the public URL of the item or a signed URL valid for the given duration when it is private
+func (item MultimediaItem) AccessURL(signer URLSigner, expires time.Duration) (string, error) {
+	if item.IsPrivate() {
+		return signer.PresignGet(item.Filename, expires, "")
+	}
+
+	segments := strings.Split(*item.Filename, "/")
+
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+
+	return fmt.Sprintf("%v/%v", strings.TrimRight(*item.Bucket, "/"), strings.Join(segments, "/")), nil
+}
 
+// NewMultimediaItem returns a validated MultimediaItem, its ID is assigned when it is stored
+func NewMultimediaItem(bucket, filename, fileType *string) (*MultimediaItem, error) {
 	multimediaItem := &MultimediaItem{
-		ID:       &id,
 		Bucket:   bucket,
 		Filename: filename,
 		Type:     fileType,
@@ -48,7 +145,7 @@ func NewMultimediaItem(bucket, filename, fileType *string) (*MultimediaItem, err
 		return nil, err
 	}
 
-	currentDate := time.Now().Format(time.RFC3339)
+	currentDate := formatCreatedAt(time.Now())
 	multimediaItem.CreatedAt = &currentDate
 
 	return multimediaItem, nil
@@ -67,6 +164,30 @@ type Findable interface {
 	FindMany([]*string) ([]*MultimediaItem, error)
 }
 
+// Updatable replaces the stored item with the same ID
+type Updatable interface {
+	// Update returns a NotFoundError when the item does not exists
+	Update(item *MultimediaItem) error
+}
+
+type NotFoundError struct {
+	ID string
+}
+
+func (err NotFoundError) Error() string {
+	return fmt.Sprintf("The multimedia item %v does not exists", err.ID)
+}
+
+// InvalidItemError is returned when an item without a required field or with a malformed field is stored
+type InvalidItemError struct {
+	Field   string
+	Message string
+}
+
+func (err InvalidItemError) Error() string {
+	return fmt.Sprintf("The multimedia item has an invalid %v: %v", err.Field, err.Message)
+}
+
 type BasicRepository interface {
 	Storable
 	Removable
@@ -78,11 +199,19 @@ type DynamoDBRepository interface {
 	DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
 	GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
 	Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
 }
 
 type AWSPersistenceManager struct {
 	DynamoDB  DynamoDBRepository
 	TableName *string `validate:"required"`
+	// TypeIndex is the index used by List, DefaultTypeIndex when empty
+	TypeIndex string
+	// HashIndex is the index used by FindByHash, DefaultHashIndex when empty
+	HashIndex string
+	// ReferenceTableName is the table with the string hash key "id" where the references of the shared files
+	// are counted, it is required by AddReference and ReleaseReference
+	ReferenceTableName *string
 }
 
 func NewDynamoDBRepository(tableName *string, repository DynamoDBRepository) (*AWSPersistenceManager, error) {
@@ -102,21 +231,18 @@ func NewDynamoDBRepository(tableName *string, repository DynamoDBRepository) (*A
 
 func (manager *AWSPersistenceManager) Store(item *MultimediaItem) error {
 	ID := uuid.New().String()
+	attributes, err := itemAttributes(item, &ID)
 
-	input := dynamodb.PutItemInput{
-		TableName:                manager.TableName,
-		ConditionExpression:      aws.String("attribute_not_exists(:key)"),
-		ExpressionAttributeNames: map[string]*string{":key": aws.String("id")},
-		Item: map[string]*dynamodb.AttributeValue{
-			"id":        {S: &ID},
-			"bucket":    {S: item.Bucket},
-			"filename":  {S: item.Filename},
-			"type":      {S: item.Type},
-			"createdAt": {S: item.CreatedAt},
-		},
+	if err != nil {
+		return err
 	}
 
-	_, err := manager.DynamoDB.PutItem(&input)
+	_, err = manager.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName:                manager.TableName,
+		ConditionExpression:      aws.String("attribute_not_exists(#key)"),
+		ExpressionAttributeNames: map[string]*string{"#key": aws.String("id")},
+		Item:                     attributes,
+	})
 
 	if err == nil {
 		// TODO make a copy of the real object and returns it
@@ -126,6 +252,98 @@ func (manager *AWSPersistenceManager) Store(item *MultimediaItem) error {
 	return err
 }
 
+// Update replaces an existing item
+func (manager *AWSPersistenceManager) Update(item *MultimediaItem) error {
+	attributes, err := itemAttributes(item, item.ID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = manager.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName:                manager.TableName,
+		ConditionExpression:      aws.String("attribute_exists(#key)"),
+		ExpressionAttributeNames: map[string]*string{"#key": aws.String("id")},
+		Item:                     attributes,
+	})
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return NotFoundError{ID: aws.StringValue(item.ID)}
+	}
+
+	return err
+}
+
+func itemAttributes(item *MultimediaItem, ID *string) (map[string]*dynamodb.AttributeValue, error) {
+	attributes := map[string]*dynamodb.AttributeValue{
+		"id":        {S: ID},
+		"bucket":    {S: item.Bucket},
+		"filename":  {S: item.Filename},
+		"type":      {S: item.Type},
+		"createdAt": {S: item.CreatedAt},
+	}
+
+	if item.Visibility != nil {
+		attributes["visibility"] = &dynamodb.AttributeValue{S: item.Visibility}
+	}
+
+	if item.Hash != nil {
+		attributes["hash"] = &dynamodb.AttributeValue{S: item.Hash}
+	}
+
+	if item.Video != nil {
+		video, err := dynamodbattribute.MarshalMap(item.Video)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attributes["video"] = &dynamodb.AttributeValue{M: video}
+	}
+
+	if item.Image != nil {
+		image, err := dynamodbattribute.MarshalMap(item.Image)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attributes["image"] = &dynamodb.AttributeValue{M: image}
+	}
+
+	if item.Document != nil {
+		document, err := dynamodbattribute.MarshalMap(item.Document)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attributes["document"] = &dynamodb.AttributeValue{M: document}
+	}
+
+	if item.Audio != nil {
+		audio, err := dynamodbattribute.MarshalMap(item.Audio)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attributes["audio"] = &dynamodb.AttributeValue{M: audio}
+	}
+
+	if len(item.Renditions) > 0 {
+		renditions, err := dynamodbattribute.MarshalList(item.Renditions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attributes["renditions"] = &dynamodb.AttributeValue{L: renditions}
+	}
+
+	return attributes, nil
+}
+
 func (manager *AWSPersistenceManager) Remove(ID *string) error {
 	_, err := manager.DynamoDB.DeleteItem(&dynamodb.DeleteItemInput{
 		Key:       map[string]*dynamodb.AttributeValue{"id": {S: ID}},
@@ -149,45 +367,63 @@ func (manager *AWSPersistenceManager) Find(ID *string) (*MultimediaItem, error)
 		return nil, nil
 	}
 
-	return mapItemOutput(output.Item), nil
+	return mapItemOutput(output.Item)
 }
 
-func mapItemOutput(output map[string]*dynamodb.AttributeValue) *MultimediaItem {
-	return &MultimediaItem{
+func mapItemOutput(output map[string]*dynamodb.AttributeValue) (*MultimediaItem, error) {
+	item := &MultimediaItem{
 		ID:        output["id"].S,
 		Bucket:    output["bucket"].S,
 		Filename:  output["filename"].S,
 		Type:      output["type"].S,
 		CreatedAt: output["createdAt"].S,
 	}
-}
 
-func (manager *AWSPersistenceManager) FindMany(ids []*string) ([]*MultimediaItem, error) {
-	attributeValues := make(map[string]*dynamodb.AttributeValue, len(ids))
-	conditionExpression := make([]string, len(ids))
+	if visibility, ok := output["visibility"]; ok {
+		item.Visibility = visibility.S
+	}
+
+	if hash, ok := output["hash"]; ok {
+		item.Hash = hash.S
+	}
 
-	for index, id := range ids {
-		queryValue := fmt.Sprintf(":v%v", index+1)
+	if video, ok := output["video"]; ok {
+		item.Video = &VideoMetadata{}
 
-		attributeValues[queryValue] = &dynamodb.AttributeValue{S: id}
-		conditionExpression[index] = queryValue
+		if err := dynamodbattribute.UnmarshalMap(video.M, item.Video); err != nil {
+			return nil, err
+		}
 	}
 
-	output, err := manager.DynamoDB.Query(&dynamodb.QueryInput{
-		TableName:                 manager.TableName,
-		FilterExpression:          aws.String(fmt.Sprintf("id IN (%v)", strings.Join(conditionExpression, ","))),
-		ExpressionAttributeValues: attributeValues,
-	})
+	if image, ok := output["image"]; ok {
+		item.Image = &ImageMetadata{}
 
-	if err != nil {
-		return nil, err
+		if err := dynamodbattribute.UnmarshalMap(image.M, item.Image); err != nil {
+			return nil, err
+		}
 	}
 
-	result := make([]*MultimediaItem, len(output.Items))
+	if document, ok := output["document"]; ok {
+		item.Document = &DocumentMetadata{}
+
+		if err := dynamodbattribute.UnmarshalMap(document.M, item.Document); err != nil {
+			return nil, err
+		}
+	}
+
+	if audio, ok := output["audio"]; ok {
+		item.Audio = &AudioMetadata{}
+
+		if err := dynamodbattribute.UnmarshalMap(audio.M, item.Audio); err != nil {
+			return nil, err
+		}
+	}
 
-	for index, item := range output.Items {
-		result[index] = mapItemOutput(item)
+	if renditions, ok := output["renditions"]; ok {
+		if err := dynamodbattribute.UnmarshalList(renditions.L, &item.Renditions); err != nil {
+			return nil, err
+		}
 	}
 
-	return result, nil
+	return item, nil
 }
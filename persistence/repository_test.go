@@ -49,6 +49,21 @@ func TestNewItem(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Accepts video items",
+			args: args{
+				bucket:   aws.String("http://example.com"),
+				filename: aws.String("example.mp4"),
+				fileType: aws.String(VIDEO),
+			},
+			want: &MultimediaItem{
+				Bucket:    aws.String("http://example.com"),
+				Filename:  aws.String("example.mp4"),
+				Type:      aws.String(VIDEO),
+				CreatedAt: aws.String(time.Now().UTC().Format(time.RFC3339)),
+			},
+			wantErr: false,
+		},
 		{
 			name: "Returns a MultimediaItem",
 			args: args{
@@ -60,7 +75,7 @@ func TestNewItem(t *testing.T) {
 				Bucket:    aws.String("http://example.com"),
 				Filename:  aws.String("example"),
 				Type:      aws.String(SOUND),
-				CreatedAt: aws.String(time.Now().Format(time.RFC3339)),
+				CreatedAt: aws.String(time.Now().UTC().Format(time.RFC3339)),
 			},
 			wantErr: false,
 		},
@@ -113,7 +128,7 @@ func TestAWSPersistenceManager_Store(t *testing.T) {
 					Bucket:    aws.String("http://example.com"),
 					Filename:  aws.String("example.pdf"),
 					Type:      aws.String(PDF),
-					CreatedAt: aws.String(time.Now().Format(time.RFC3339)),
+					CreatedAt: aws.String(time.Now().UTC().Format(time.RFC3339)),
 				},
 			},
 			wantErr: false,
@@ -182,6 +197,34 @@ func TestAWSPersistenceManager_Remove(t *testing.T) {
 	}
 }
 
+func TestMapItemOutput(t *testing.T) {
+	item := &MultimediaItem{
+		Bucket:    aws.String("http://example.com"),
+		Filename:  aws.String("example.mp4"),
+		Type:      aws.String(VIDEO),
+		CreatedAt: aws.String(time.Now().UTC().Format(time.RFC3339)),
+		Video:     &VideoMetadata{Duration: 12.5, Width: 1920, Height: 1080, Codec: "avc1"},
+	}
+	dynamo := &DynamoDBRecorder{}
+	manager := &AWSPersistenceManager{DynamoDB: dynamo, TableName: aws.String("example")}
+
+	if err := manager.Store(item); err != nil {
+		t.Errorf("Store() error = %v", err)
+		return
+	}
+
+	got, err := mapItemOutput(dynamo.Item)
+
+	if err != nil {
+		t.Errorf("mapItemOutput() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, item) {
+		t.Errorf("mapItemOutput() got = %+v, want %+v", got, item)
+	}
+}
+
 type InvalidArguments struct {
 	Message *string
 }
@@ -220,6 +263,10 @@ func (dynamo *DynamoDBSuccess) Query(input *dynamodb.QueryInput) (*dynamodb.Quer
 	return &dynamodb.QueryOutput{}, nil
 }
 
+func (dynamo *DynamoDBSuccess) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
 type InternalServerError struct{}
 
 func (err InternalServerError) Error() string {
@@ -243,3 +290,60 @@ func (dynamo *DynamoDBFail) GetItem(input *dynamodb.GetItemInput) (*dynamodb.Get
 func (dynamo *DynamoDBFail) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
 	return nil, InternalServerError{}
 }
+
+func (dynamo *DynamoDBFail) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	return nil, InternalServerError{}
+}
+
+type DynamoDBRecorder struct {
+	DynamoDBSuccess
+	Item map[string]*dynamodb.AttributeValue
+}
+
+func (dynamo *DynamoDBRecorder) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	dynamo.Item = input.Item
+
+	return dynamo.DynamoDBSuccess.PutItem(input)
+}
+
+type StaticSigner struct{}
+
+func (signer StaticSigner) PresignGet(path *string, expires time.Duration, disposition string) (string, error) {
+	return "https://signed.example.com/" + *path + "?expires=" + expires.String(), nil
+}
+
+func TestMultimediaItem_AccessURL(t *testing.T) {
+	tests := []struct {
+		name string
+		item MultimediaItem
+		want string
+	}{
+		{
+			name: "Items without visibility are public",
+			item: MultimediaItem{Bucket: aws.String("https://bucket.s3.amazonaws.com"), Filename: aws.String("2019/logo one.png")},
+			want: "https://bucket.s3.amazonaws.com/2019/logo%20one.png",
+		},
+		{
+			name: "Public items use the bucket URL",
+			item: MultimediaItem{Bucket: aws.String("https://cdn.example.com/"), Filename: aws.String("logo.png"), Visibility: aws.String(PUBLIC)},
+			want: "https://cdn.example.com/logo.png",
+		},
+		{
+			name: "Private items are signed",
+			item: MultimediaItem{Bucket: aws.String("https://bucket.s3.amazonaws.com"), Filename: aws.String("contract.pdf"), Visibility: aws.String(PRIVATE)},
+			want: "https://signed.example.com/contract.pdf?expires=5m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.item.AccessURL(StaticSigner{}, 5*time.Minute)
+			if err != nil {
+				t.Errorf("AccessURL() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("AccessURL() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package persistence
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Dialect adapts the queries of the SQLRepository to a database
+type Dialect struct {
+	Name string
+	// Placeholder returns the placeholder of the argument at the given position, starting at 1
+	Placeholder func(position int) string
+	// Migrations are applied in order, their position is the schema version
+	Migrations []string
+}
+
+// PostgresDialect stores the metadata of the items as JSONB and their creation dates as TIMESTAMPTZ, it needs
+// the github.com/lib/pq driver
+var PostgresDialect = Dialect{
+	Name:        "postgres",
+	Placeholder: func(position int) string { return fmt.Sprintf("$%v", position) },
+	Migrations: []string{
+		`CREATE TABLE IF NOT EXISTS multimedia_items (
+			id VARCHAR(36) PRIMARY KEY,
+			bucket TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			type VARCHAR(16) NOT NULL,
+			created_at VARCHAR(40) NOT NULL,
+			visibility VARCHAR(16),
+			metadata JSONB
+		)`,
+		`CREATE INDEX IF NOT EXISTS multimedia_items_type_created_at ON multimedia_items (type, created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS multimedia_items_created_at ON multimedia_items (created_at, id)`,
+		`ALTER TABLE multimedia_items ADD COLUMN hash VARCHAR(64)`,
+		`CREATE INDEX IF NOT EXISTS multimedia_items_hash ON multimedia_items (hash)`,
+		`ALTER TABLE multimedia_items ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at::timestamptz`,
+		`CREATE TABLE IF NOT EXISTS multimedia_references (
+			file TEXT PRIMARY KEY,
+			count INTEGER NOT NULL DEFAULT 0,
+			released INTEGER NOT NULL DEFAULT 0
+		)`,
+	},
+}
+
+// SQLiteDialect stores the metadata of the items as JSON text, it is meant for local development and tests
+var SQLiteDialect = Dialect{
+	Name:        "sqlite",
+	Placeholder: func(position int) string { return "?" },
+	Migrations: []string{
+		`CREATE TABLE IF NOT EXISTS multimedia_items (
+			id VARCHAR(36) PRIMARY KEY,
+			bucket TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			type VARCHAR(16) NOT NULL,
+			created_at VARCHAR(40) NOT NULL,
+			visibility VARCHAR(16),
+			metadata TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS multimedia_items_type_created_at ON multimedia_items (type, created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS multimedia_items_created_at ON multimedia_items (created_at, id)`,
+		`ALTER TABLE multimedia_items ADD COLUMN hash VARCHAR(64)`,
+		`CREATE INDEX IF NOT EXISTS multimedia_items_hash ON multimedia_items (hash)`,
+		`CREATE TABLE IF NOT EXISTS multimedia_references (
+			file TEXT PRIMARY KEY,
+			count INTEGER NOT NULL DEFAULT 0,
+			released INTEGER NOT NULL DEFAULT 0
+		)`,
+	},
+}
+
+// sqlBatchSize is the maximum amount of IDs per query of FindMany, SQLite accepts up to 999 arguments
+const sqlBatchSize = 500
+
+const sqlColumns = "id, bucket, filename, type, created_at, visibility, metadata, hash"
+
+// itemMetadata is stored in the metadata column
+type itemMetadata struct {
+	Video      *VideoMetadata    `json:"video,omitempty"`
+	Image      *ImageMetadata    `json:"image,omitempty"`
+	Document   *DocumentMetadata `json:"document,omitempty"`
+	Audio      *AudioMetadata    `json:"audio,omitempty"`
+	Renditions []Rendition       `json:"renditions,omitempty"`
+}
+
+// SQLRepository stores the items in the multimedia_items table, call Migrate before using it
+type SQLRepository struct {
+	DB      *sql.DB
+	Dialect Dialect
+}
+
+func NewSQLRepository(db *sql.DB, dialect Dialect) *SQLRepository {
+	return &SQLRepository{DB: db, Dialect: dialect}
+}
+
+// Migrate creates or updates the schema, every pending migration is applied in its own transaction
+func (repository *SQLRepository) Migrate() error {
+	_, err := repository.DB.Exec("CREATE TABLE IF NOT EXISTS multimedia_migrations (version INTEGER PRIMARY KEY)")
+
+	if err != nil {
+		return err
+	}
+
+	var version int
+
+	if err = repository.DB.QueryRow("SELECT COALESCE(MAX(version), 0) FROM multimedia_migrations").Scan(&version); err != nil {
+		return err
+	}
+
+	for index := version; index < len(repository.Dialect.Migrations); index++ {
+		err = repository.transaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(repository.Dialect.Migrations[index]); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(repository.query("INSERT INTO multimedia_migrations (version) VALUES (%v)", 1), index+1)
+
+			return err
+		})
+
+		if err != nil {
+			return fmt.Errorf("migration %v: %v", index+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (repository *SQLRepository) Store(item *MultimediaItem) error {
+	if err := validateStoredItem(item, false); err != nil {
+		return err
+	}
+
+	ID := uuid.New().String()
+	metadata, err := marshalMetadata(item)
+
+	if err != nil {
+		return err
+	}
+
+	err = repository.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			repository.query("INSERT INTO multimedia_items ("+sqlColumns+") VALUES (%v, %v, %v, %v, %v, %v, %v, %v)", 1, 2, 3, 4, 5, 6, 7, 8),
+			ID, *item.Bucket, *item.Filename, *item.Type, *item.CreatedAt, nullableString(item.Visibility), metadata, nullableString(item.Hash),
+		)
+
+		return err
+	})
+
+	if err == nil {
+		item.ID = &ID
+	}
+
+	return err
+}
+
+// Update returns an InvalidItemError when the item has no ID and a NotFoundError when it is not stored
+func (repository *SQLRepository) Update(item *MultimediaItem) error {
+	if err := validateStoredItem(item, true); err != nil {
+		return err
+	}
+
+	metadata, err := marshalMetadata(item)
+
+	if err != nil {
+		return err
+	}
+
+	return repository.transaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(
+			repository.query("UPDATE multimedia_items SET bucket = %v, filename = %v, type = %v, created_at = %v, visibility = %v, metadata = %v, hash = %v WHERE id = %v", 1, 2, 3, 4, 5, 6, 7, 8),
+			*item.Bucket, *item.Filename, *item.Type, *item.CreatedAt, nullableString(item.Visibility), metadata, nullableString(item.Hash), *item.ID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+			return NotFoundError{ID: *item.ID}
+		}
+
+		return nil
+	})
+}
+
+func (repository *SQLRepository) Remove(ID *string) error {
+	return repository.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(repository.query("DELETE FROM multimedia_items WHERE id = %v", 1), *ID)
+
+		return err
+	})
+}
+
+func (repository *SQLRepository) Find(ID *string) (*MultimediaItem, error) {
+	row := repository.DB.QueryRow(repository.query("SELECT "+sqlColumns+" FROM multimedia_items WHERE id = %v", 1), *ID)
+	item, err := scanItem(row)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return item, err
+}
+
+// FindMany returns the existing items in the order of the given IDs, missing IDs are ignored
+func (repository *SQLRepository) FindMany(ids []*string) ([]*MultimediaItem, error) {
+	var unique []interface{}
+	seen := make(map[string]bool, len(ids))
+
+	for _, ID := range ids {
+		if ID != nil && !seen[*ID] {
+			seen[*ID] = true
+			unique = append(unique, *ID)
+		}
+	}
+
+	found := make(map[string]*MultimediaItem, len(unique))
+
+	for start := 0; start < len(unique); start += sqlBatchSize {
+		end := start + sqlBatchSize
+
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		placeholders := make([]string, end-start)
+
+		for index := range placeholders {
+			placeholders[index] = repository.Dialect.Placeholder(index + 1)
+		}
+
+		rows, err := repository.DB.Query(
+			"SELECT "+sqlColumns+" FROM multimedia_items WHERE id IN ("+strings.Join(placeholders, ", ")+")",
+			unique[start:end]...,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = collectItems(rows, found); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []*MultimediaItem
+
+	for _, ID := range unique {
+		if item, ok := found[ID.(string)]; ok {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// FindByHash returns the items with the given hash sorted by CreatedAt
+func (repository *SQLRepository) FindByHash(hash string) ([]*MultimediaItem, error) {
+	rows, err := repository.DB.Query(
+		repository.query("SELECT "+sqlColumns+" FROM multimedia_items WHERE hash = %v ORDER BY created_at, id", 1),
+		hash,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanItems(rows)
+}
+
+// List returns the items sorted by CreatedAt, items created at the same time are sorted by ID
+func (repository *SQLRepository) List(options ListOptions) (*Page, error) {
+	after, err := decodeKeyCursor(options.Cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var arguments []interface{}
+	condition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+
+		for index := range values {
+			placeholders[index] = repository.Dialect.Placeholder(len(arguments) + index + 1)
+		}
+
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+		arguments = append(arguments, values...)
+	}
+
+	if options.Type != "" {
+		condition("type = %v", options.Type)
+	}
+
+	if !options.CreatedAfter.IsZero() {
+		condition("created_at >= %v", formatCreatedAt(options.CreatedAfter))
+	}
+
+	if !options.CreatedBefore.IsZero() {
+		condition("created_at <= %v", formatCreatedAt(options.CreatedBefore))
+	}
+
+	order, comparison := "ASC", ">"
+
+	if options.Descending {
+		order, comparison = "DESC", "<"
+	}
+
+	if after != "" {
+		key := strings.SplitN(after, "|", 2)
+		condition("(created_at "+comparison+" %v OR (created_at = %v AND id "+comparison+" %v))", key[0], key[0], key[1])
+	}
+
+	query := "SELECT " + sqlColumns + " FROM multimedia_items"
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := options.pageSize()
+	query += fmt.Sprintf(" ORDER BY created_at %v, id %v LIMIT %v", order, order, limit+1)
+	rows, err := repository.DB.Query(query, arguments...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{}
+
+	if page.Items, err = scanItems(rows); err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.Cursor = encodeKeyCursor(page.Items[limit-1])
+	}
+
+	return page, nil
+}
+
+// query replaces the verbs of the format with the placeholders of the given positions
+func (repository *SQLRepository) query(format string, positions ...int) string {
+	placeholders := make([]interface{}, len(positions))
+
+	for index, position := range positions {
+		placeholders[index] = repository.Dialect.Placeholder(position)
+	}
+
+	return fmt.Sprintf(format, placeholders...)
+}
+
+// transaction runs the function in a transaction that is committed only when the function succeeds
+func (repository *SQLRepository) transaction(function func(tx *sql.Tx) error) error {
+	tx, err := repository.DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	if err = function(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddReference records another item sharing the file in the multimedia_references table
+func (repository *SQLRepository) AddReference(file string) (bool, error) {
+	return repository.updateReferences(
+		file,
+		"UPDATE multimedia_references SET count = count + 1 WHERE file = %v AND released = 0",
+	)
+}
+
+// ReleaseReference decrements the references of the file or releases it when it has none, a single statement
+// decides both so it can not interleave with AddReference
+func (repository *SQLRepository) ReleaseReference(file string) (bool, error) {
+	return repository.updateReferences(
+		file,
+		"UPDATE multimedia_references SET count = CASE WHEN count > 0 THEN count - 1 ELSE 0 END, released = CASE WHEN count > 0 THEN released ELSE 1 END WHERE file = %v",
+	)
+}
+
+// updateReferences runs the update on the counter of the file and reports if the file was not released
+func (repository *SQLRepository) updateReferences(file, update string) (bool, error) {
+	var released int
+
+	err := repository.transaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(repository.query("INSERT INTO multimedia_references (file) VALUES (%v) ON CONFLICT (file) DO NOTHING", 1), file)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(repository.query(update, 1), file); err != nil {
+			return err
+		}
+
+		return tx.QueryRow(repository.query("SELECT released FROM multimedia_references WHERE file = %v", 1), file).Scan(&released)
+	})
+
+	return err == nil && released == 0, err
+}
+
+type scanner interface {
+	Scan(destination ...interface{}) error
+}
+
+func scanItem(row scanner) (*MultimediaItem, error) {
+	item := &MultimediaItem{}
+	var visibility, metadata, hash sql.NullString
+
+	err := row.Scan(&item.ID, &item.Bucket, &item.Filename, &item.Type, createdAtColumn{&item.CreatedAt}, &visibility, &metadata, &hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if visibility.Valid {
+		item.Visibility = &visibility.String
+	}
+
+	if hash.Valid {
+		item.Hash = &hash.String
+	}
+
+	if metadata.Valid && metadata.String != "" {
+		decoded := itemMetadata{}
+
+		if err = json.Unmarshal([]byte(metadata.String), &decoded); err != nil {
+			return nil, err
+		}
+
+		item.Video = decoded.Video
+		item.Image = decoded.Image
+		item.Document = decoded.Document
+		item.Audio = decoded.Audio
+		item.Renditions = decoded.Renditions
+	}
+
+	return item, nil
+}
+
+// createdAtColumn scans the created_at column as formatCreatedAt formats it, the TIMESTAMPTZ columns of
+// Postgres are returned as a time.Time in the time zone of the session
+type createdAtColumn struct {
+	value **string
+}
+
+func (column createdAtColumn) Scan(source interface{}) error {
+	var createdAt string
+
+	switch value := source.(type) {
+	case time.Time:
+		createdAt = formatCreatedAt(value)
+	case string:
+		createdAt = value
+	case []byte:
+		createdAt = string(value)
+	default:
+		return fmt.Errorf("created_at of type %T can not be scanned", source)
+	}
+
+	*column.value = &createdAt
+
+	return nil
+}
+
+func scanItems(rows *sql.Rows) ([]*MultimediaItem, error) {
+	defer rows.Close()
+
+	var items []*MultimediaItem
+
+	for rows.Next() {
+		item, err := scanItem(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func collectItems(rows *sql.Rows, found map[string]*MultimediaItem) error {
+	items, err := scanItems(rows)
+
+	for _, item := range items {
+		found[*item.ID] = item
+	}
+
+	return err
+}
+
+// validateStoredItem checks the columns that can not be NULL, the ID is required to update the item
+func validateStoredItem(item *MultimediaItem, requireID bool) error {
+	required := map[string]*string{"bucket": item.Bucket, "filename": item.Filename, "type": item.Type, "createdAt": item.CreatedAt}
+
+	if requireID {
+		required["id"] = item.ID
+	}
+
+	for _, field := range []string{"id", "bucket", "filename", "type", "createdAt"} {
+		if value, ok := required[field]; ok && value == nil {
+			return InvalidItemError{Field: field, Message: "it is required"}
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339, *item.CreatedAt); err != nil {
+		return InvalidItemError{Field: "createdAt", Message: err.Error()}
+	}
+
+	return nil
+}
+
+// marshalMetadata returns the JSON of the metadata column, nil when the item has no metadata
+func marshalMetadata(item *MultimediaItem) (interface{}, error) {
+	if item.Video == nil && item.Image == nil && item.Document == nil && item.Audio == nil && len(item.Renditions) == 0 {
+		return nil, nil
+	}
+
+	content, err := json.Marshal(itemMetadata{Video: item.Video, Image: item.Image, Document: item.Document, Audio: item.Audio, Renditions: item.Renditions})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return string(content), nil
+}
+
+func nullableString(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	return *value
+}
@@ -0,0 +1,149 @@
+package persistence_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+	"github.com/alejo-lapix/multimedia-go/persistence/persistencetest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLiteRepository returns a migrated repository on an in-memory database, the test is skipped
+// when SQLite is not available e.g. when cgo is disabled
+func newSQLiteRepository(t *testing.T) *persistence.SQLRepository {
+	db, err := sql.Open("sqlite3", ":memory:")
+
+	if err == nil {
+		err = db.Ping()
+	}
+
+	if err != nil {
+		t.Skipf("SQLite is not available: %v", err)
+	}
+
+	// every connection to :memory: opens a different database
+	db.SetMaxOpenConns(1)
+	repository := persistence.NewSQLRepository(db, persistence.SQLiteDialect)
+
+	if err = repository.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	return repository
+}
+
+func TestSQLRepository_Conformance(t *testing.T) {
+	persistencetest.RunRepositorySuite(t, func(t *testing.T) persistence.BasicRepository {
+		return newSQLiteRepository(t)
+	})
+}
+
+func TestSQLRepository_Migrate(t *testing.T) {
+	repository := newSQLiteRepository(t)
+
+	if err := repository.Migrate(); err != nil {
+		t.Errorf("Migrate() error = %v, migrating twice must not fail", err)
+	}
+
+	var version int
+
+	if err := repository.DB.QueryRow("SELECT MAX(version) FROM multimedia_migrations").Scan(&version); err != nil || version != len(persistence.SQLiteDialect.Migrations) {
+		t.Errorf("Migrate() version = %v, error = %v, want %v", version, err, len(persistence.SQLiteDialect.Migrations))
+	}
+}
+
+func TestSQLRepository_StoreRollback(t *testing.T) {
+	repository := newSQLiteRepository(t)
+	item := persistencetest.NewItem("example.png", persistence.IMAGE, 0)
+
+	if _, err := repository.DB.Exec("CREATE TRIGGER reject_items BEFORE INSERT ON multimedia_items BEGIN SELECT RAISE(ABORT, 'rejected'); END"); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	if err := repository.Store(item); err == nil || item.ID != nil {
+		t.Errorf("Store() error = %v, ID = %v, a failed insert must not assign an ID", err, aws.StringValue(item.ID))
+	}
+
+	var count int
+
+	if err := repository.DB.QueryRow("SELECT COUNT(*) FROM multimedia_items").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Store() stored %v items, error = %v, the transaction must be rolled back", count, err)
+	}
+}
+
+func TestIntegrationSQLRepository_Postgres(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+
+	if os.Getenv("INTEGRATION_TEST") != "true" || dsn == "" {
+		return
+	}
+
+	persistencetest.RunRepositorySuite(t, func(t *testing.T) persistence.BasicRepository {
+		db, err := sql.Open("postgres", dsn)
+
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+
+		repository := persistence.NewSQLRepository(db, persistence.PostgresDialect)
+
+		if err = repository.Migrate(); err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+
+		if _, err = db.Exec("DELETE FROM multimedia_items"); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+
+		return repository
+	})
+}
+
+func TestSQLRepository_InvalidItem(t *testing.T) {
+	repository := newSQLiteRepository(t)
+	stored := persistencetest.NewItem("example.png", persistence.IMAGE, 0)
+
+	if err := repository.Store(stored); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		item  func() *persistence.MultimediaItem
+		field string
+	}{
+		{"without bucket", func() *persistence.MultimediaItem { item := *stored; item.Bucket = nil; return &item }, "bucket"},
+		{"without filename", func() *persistence.MultimediaItem { item := *stored; item.Filename = nil; return &item }, "filename"},
+		{"without type", func() *persistence.MultimediaItem { item := *stored; item.Type = nil; return &item }, "type"},
+		{"without createdAt", func() *persistence.MultimediaItem { item := *stored; item.CreatedAt = nil; return &item }, "createdAt"},
+		{"malformed createdAt", func() *persistence.MultimediaItem {
+			item := *stored
+			item.CreatedAt = aws.String("yesterday")
+			return &item
+		}, "createdAt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, save := range map[string]func(*persistence.MultimediaItem) error{"Store": repository.Store, "Update": repository.Update} {
+				err := save(tt.item())
+
+				if invalid, ok := err.(persistence.InvalidItemError); !ok || invalid.Field != tt.field {
+					t.Errorf("%v() error = %v, want an InvalidItemError of %v", name, err, tt.field)
+				}
+			}
+		})
+	}
+
+	withoutID := *stored
+	withoutID.ID = nil
+
+	if err, ok := repository.Update(&withoutID).(persistence.InvalidItemError); !ok || err.Field != "id" {
+		t.Errorf("Update() error = %v, want an InvalidItemError of id", err)
+	}
+}
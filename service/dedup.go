@@ -0,0 +1,202 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// The deduplication modes of the AWSUploader, the files with the same SHA-256, type, bucket and visibility
+// as a stored item are not stored again. FindByHash of the DynamoDB repository reads an eventually consistent
+// index, so the shared files are counted by a persistence.ReferenceCounter with strongly consistent reads
+// before they are referenced or removed
+const (
+	// ReturnDuplicates returns the stored item instead of recording a new one
+	ReturnDuplicates = "return"
+	// ReferenceDuplicates records a new item that shares the file, the renditions and the metadata of the
+	// stored item, the destination of the upload is ignored
+	ReferenceDuplicates = "reference"
+)
+
+// duplicate returns the stored item with the same content as the item, nil when deduplication is disabled
+// or there is none
+func (uploader *AWSUploader) duplicate(item *persistence.MultimediaItem) (*persistence.MultimediaItem, error) {
+	if uploader.Deduplication == "" {
+		return nil, nil
+	}
+
+	repository, ok := uploader.Repository.(persistence.HashFindable)
+
+	if !ok {
+		return nil, InvalidArgumentError{Message: "Deduplication requires a persistence.HashFindable repository"}
+	}
+
+	if uploader.Deduplication != ReturnDuplicates && uploader.Deduplication != ReferenceDuplicates {
+		return nil, InvalidArgumentError{Message: "Deduplication must be ReturnDuplicates or ReferenceDuplicates"}
+	}
+
+	if _, ok = uploader.Repository.(persistence.ReferenceCounter); !ok && uploader.Deduplication == ReferenceDuplicates {
+		return nil, InvalidArgumentError{Message: "ReferenceDuplicates requires a persistence.ReferenceCounter repository"}
+	}
+
+	candidates, err := repository.FindByHash(*item.Hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		if *candidate.Bucket == *item.Bucket && *candidate.Type == *item.Type && aws.StringValue(candidate.Visibility) == uploader.Visibility {
+			return candidate, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// DeduplicatingUploader is implemented by the uploaders that may return a stored item instead of recording
+// the uploaded file
+type DeduplicatingUploader interface {
+	Uploader
+	// UploadHashed uploads a file whose SHA-256 was computed while it was received, an empty hash when it is
+	// unknown. It reports if the returned item was stored before with the same content
+	UploadHashed(filename, destination *string, hash string) (*persistence.MultimediaItem, bool, error)
+	// Deduplicates reports if the uploads are deduplicated, the files are not hashed while they are received
+	// otherwise
+	Deduplicates() bool
+}
+
+// Deduplicates reports if Deduplication is enabled
+func (uploader *AWSUploader) Deduplicates() bool {
+	return uploader.Deduplication != ""
+}
+
+// reference returns the stored item or records the item as a new reference to its file, it reports if the
+// returned item is the stored one. It returns nil when the file of the stored item was released by a delete
+// and it can not be referenced
+func (uploader *AWSUploader) reference(stored, item *persistence.MultimediaItem) (*persistence.MultimediaItem, bool, error) {
+	if uploader.Deduplication == ReturnDuplicates {
+		return stored, true, nil
+	}
+
+	counter := uploader.Repository.(persistence.ReferenceCounter)
+	file := fileReference(stored)
+	added, err := counter.AddReference(file)
+
+	if err != nil || !added {
+		return nil, false, err
+	}
+
+	item.Filename = stored.Filename
+	item.Visibility = stored.Visibility
+	item.Video = stored.Video
+	item.Image = stored.Image
+	item.Document = stored.Document
+	item.Audio = stored.Audio
+	item.Renditions = append([]persistence.Rendition(nil), stored.Renditions...)
+
+	if err = uploader.Repository.Store(item); err != nil {
+		if _, releaseErr := counter.ReleaseReference(file); releaseErr != nil {
+			return nil, false, RollbackError{Err: err, RollbackErr: releaseErr}
+		}
+
+		return nil, false, err
+	}
+
+	return item, false, nil
+}
+
+// shared reports if other items reference the file of the item. The references of ReferenceDuplicates are
+// counted with strongly consistent reads and the file is released when the item is its last reference, the
+// items recorded before the references were counted are looked up with FindByHash as well
+func (uploader *AWSUploader) shared(item *persistence.MultimediaItem) (bool, error) {
+	if counter, ok := uploader.Repository.(persistence.ReferenceCounter); ok && uploader.Deduplication == ReferenceDuplicates && item.Hash != nil {
+		kept, err := counter.ReleaseReference(fileReference(item))
+
+		if err != nil || kept {
+			return kept, err
+		}
+	}
+
+	shared, err := uploader.sharing(item)
+
+	return len(shared) > 0, err
+}
+
+// fileReference identifies the file of the item in the persistence.ReferenceCounter
+func fileReference(item *persistence.MultimediaItem) string {
+	return *item.Bucket + "/" + *item.Filename
+}
+
+// sharing returns the other items that share the file of the item, the files are not shared when
+// Deduplication is disabled or the item does not have a hash
+func (uploader *AWSUploader) sharing(item *persistence.MultimediaItem) ([]*persistence.MultimediaItem, error) {
+	repository, ok := uploader.Repository.(persistence.HashFindable)
+
+	if !ok || uploader.Deduplication == "" || item.Hash == nil {
+		return nil, nil
+	}
+
+	candidates, err := repository.FindByHash(*item.Hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*persistence.MultimediaItem
+
+	for _, candidate := range candidates {
+		if *candidate.ID != *item.ID && *candidate.Bucket == *item.Bucket && *candidate.Filename == *item.Filename {
+			result = append(result, candidate)
+		}
+	}
+
+	return result, nil
+}
+
+// hashLocks serializes the uploads and the deletes of the same content
+type hashLocks struct {
+	mutex sync.Mutex
+	locks map[string]*hashLock
+}
+
+type hashLock struct {
+	sync.Mutex
+	// waiting is the amount of callers holding or waiting for the lock
+	waiting int
+}
+
+// lock waits for the lock of the hash and returns the function that releases it
+func (locks *hashLocks) lock(hash string) func() {
+	locks.mutex.Lock()
+
+	if locks.locks == nil {
+		locks.locks = make(map[string]*hashLock)
+	}
+
+	lock, ok := locks.locks[hash]
+
+	if !ok {
+		lock = &hashLock{}
+		locks.locks[hash] = lock
+	}
+
+	lock.waiting++
+	locks.mutex.Unlock()
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+		locks.mutex.Lock()
+
+		lock.waiting--
+
+		if lock.waiting == 0 {
+			delete(locks.locks, hash)
+		}
+
+		locks.mutex.Unlock()
+	}
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestAWSUploader_UploadDuplicates(t *testing.T) {
+	tests := []struct {
+		name           string
+		deduplication  string
+		visibility     string
+		wantSameID     bool
+		wantSameFile   bool
+		wantStoredKeys int
+	}{
+		{name: "Stores every upload without deduplication", wantStoredKeys: 2},
+		{name: "Returns the stored item", deduplication: ReturnDuplicates, wantSameID: true, wantSameFile: true, wantStoredKeys: 1},
+		{name: "References the stored file", deduplication: ReferenceDuplicates, wantSameFile: true, wantStoredKeys: 1},
+		{name: "Stores again when the visibility differs", deduplication: ReferenceDuplicates, visibility: persistence.PRIVATE, wantStoredKeys: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &RecordingProvider{}
+			uploader := &AWSUploader{
+				Bucket:        aws.String("any-bucket"),
+				Region:        aws.String("us-east-1"),
+				Repository:    persistence.NewMemoryRepository(),
+				Storage:       storage,
+				Deduplication: tt.deduplication,
+			}
+			first, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("first.png"))
+
+			if err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			uploader.Visibility = tt.visibility
+			second, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("second.png"))
+
+			if err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			if tt.deduplication == "" && (first.Hash != nil || second.Hash != nil) {
+				t.Errorf("Upload() hashes = %v and %v, want no hashes without deduplication", aws.StringValue(first.Hash), aws.StringValue(second.Hash))
+			}
+
+			if tt.deduplication != "" && (first.Hash == nil || len(*first.Hash) != 64 || aws.StringValue(second.Hash) != *first.Hash) {
+				t.Errorf("Upload() hashes = %v and %v, want the same SHA-256", aws.StringValue(first.Hash), aws.StringValue(second.Hash))
+			}
+
+			if sameID := *first.ID == *second.ID; sameID != tt.wantSameID {
+				t.Errorf("Upload() IDs = %v and %v, want the same ID %v", *first.ID, *second.ID, tt.wantSameID)
+			}
+
+			if sameFile := *first.Filename == *second.Filename; sameFile != tt.wantSameFile {
+				t.Errorf("Upload() files = %v and %v, want the same file %v", *first.Filename, *second.Filename, tt.wantSameFile)
+			}
+
+			if len(storage.Objects) != tt.wantStoredKeys {
+				t.Errorf("Upload() stored = %v, want %v files", storage.Objects, tt.wantStoredKeys)
+			}
+		})
+	}
+}
+
+func TestAWSUploader_DeleteReferences(t *testing.T) {
+	storage := &RecordingProvider{}
+	repository := persistence.NewMemoryRepository()
+	uploader := &AWSUploader{
+		Bucket:        aws.String("any-bucket"),
+		Region:        aws.String("us-east-1"),
+		Repository:    repository,
+		Storage:       storage,
+		Renditions:    newGenerator(t, storage, RenditionSpec{Name: "small", MaxWidth: 2, MaxHeight: 2}),
+		Deduplication: ReferenceDuplicates,
+	}
+	var items []*persistence.MultimediaItem
+
+	for _, destination := range []string{"logo.png", "logo-copy.png", "logo-again.png"} {
+		item, err := uploader.Upload(aws.String("testdata/image.png"), aws.String(destination))
+
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+
+		items = append(items, item)
+	}
+
+	wantObjects := map[string]bool{"logo.png": true, "logo_small.png": true}
+
+	for index, item := range items {
+		if err := uploader.Delete(item.ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		if found, _ := repository.Find(item.ID); found != nil {
+			t.Errorf("Delete() must remove the record of %v", *item.ID)
+		}
+
+		// the file is removed with its last reference
+		if index == len(items)-1 {
+			wantObjects = map[string]bool{}
+		}
+
+		if len(storage.Objects) != len(wantObjects) || storage.Objects["logo.png"] != wantObjects["logo.png"] {
+			t.Errorf("Delete() stored = %v after %v deletes, want %v", storage.Objects, index+1, wantObjects)
+		}
+	}
+}
+
+func TestAWSUploader_DeduplicationRequiresHashes(t *testing.T) {
+	uploader := &AWSUploader{
+		Bucket:        aws.String("any-bucket"),
+		Region:        aws.String("us-east-1"),
+		Repository:    &SuccessRepository{},
+		Storage:       &RecordingProvider{},
+		Deduplication: ReferenceDuplicates,
+	}
+
+	if _, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo.png")); err == nil {
+		t.Errorf("Upload() error = %v, want an InvalidArgumentError", err)
+	} else if _, ok := err.(InvalidArgumentError); !ok {
+		t.Errorf("Upload() error = %#v, want an InvalidArgumentError", err)
+	}
+}
+
+// MissingIndexRepository fails the hash queries like a DynamoDB table without the hash index
+type MissingIndexRepository struct {
+	*persistence.MemoryRepository
+}
+
+func (repository MissingIndexRepository) FindByHash(hash string) ([]*persistence.MultimediaItem, error) {
+	return nil, errors.New("ValidationException: The table does not have the specified index")
+}
+
+func TestAWSUploader_WithoutDeduplication(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	storage := files.NewLocalProvider(root)
+	repository := MissingIndexRepository{persistence.NewMemoryRepository()}
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: repository,
+		Storage:    storage,
+		Renditions: newGenerator(t, storage),
+	}
+	item, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo.png"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	if _, err = uploader.RegenerateRenditions(item.ID); err != nil {
+		t.Errorf("RegenerateRenditions() error = %v, want the items without deduplication not to query the hashes", err)
+	}
+
+	// the items confirmed by a DirectUploader have a hash as well
+	item.Hash = aws.String("2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+
+	if err = repository.Store(item); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = uploader.Delete(item.ID); err != nil {
+		t.Errorf("Delete() error = %v, want the items without deduplication not to query the hashes", err)
+	}
+}
+
+// SlowRemovingProvider takes a while to remove the files
+type SlowRemovingProvider struct {
+	files.Provider
+}
+
+func (provider *SlowRemovingProvider) Remove(filename *string) error {
+	time.Sleep(50 * time.Millisecond)
+
+	return provider.Provider.Remove(filename)
+}
+
+func TestAWSUploader_ConcurrentReferences(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	storage := &SlowRemovingProvider{files.NewLocalProvider(root)}
+	repository := persistence.NewMemoryRepository()
+	uploader := &AWSUploader{
+		Bucket:        aws.String("any-bucket"),
+		Region:        aws.String("us-east-1"),
+		Repository:    repository,
+		Storage:       storage,
+		Deduplication: ReferenceDuplicates,
+	}
+	first, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo.png"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	copies := 8
+	wait := sync.WaitGroup{}
+	wait.Add(copies + 1)
+
+	go func() {
+		defer wait.Done()
+
+		if err := uploader.Delete(first.ID); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+	}()
+
+	// the uploads start while the delete removes the file
+	time.Sleep(10 * time.Millisecond)
+
+	for index := 0; index < copies; index++ {
+		destination := fmt.Sprintf("logo-%v.png", index)
+
+		go func() {
+			defer wait.Done()
+
+			if _, err := uploader.Upload(aws.String("testdata/image.png"), aws.String(destination)); err != nil {
+				t.Errorf("Upload() error = %v", err)
+			}
+		}()
+	}
+
+	wait.Wait()
+	items, err := repository.FindByHash(*first.Hash)
+
+	if err != nil || len(items) != copies {
+		t.Fatalf("FindByHash() = %v items, %v, want %v", len(items), err, copies)
+	}
+
+	// the shared file is removed only when the delete sees no references
+	for _, item := range items {
+		if !exists(t, storage, *item.Filename) {
+			t.Errorf("Delete() removed the file %v of %v", *item.Filename, *item.ID)
+		}
+	}
+}
+
+// LaggingIndexRepository returns the items of FindByHash from a snapshot, like an eventually consistent index
+// read by other processes
+type LaggingIndexRepository struct {
+	*persistence.MemoryRepository
+	snapshot []*persistence.MultimediaItem
+}
+
+func (repository *LaggingIndexRepository) FindByHash(hash string) ([]*persistence.MultimediaItem, error) {
+	return repository.snapshot, nil
+}
+
+func TestAWSUploader_ReferencesWithLaggingIndex(t *testing.T) {
+	storage := &RecordingProvider{}
+	memory := persistence.NewMemoryRepository()
+	repository := &LaggingIndexRepository{MemoryRepository: memory}
+	uploader := &AWSUploader{
+		Bucket:        aws.String("any-bucket"),
+		Region:        aws.String("us-east-1"),
+		Repository:    memory,
+		Storage:       storage,
+		Deduplication: ReferenceDuplicates,
+	}
+	first, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo.png"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	copied, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo-copy.png"))
+
+	if err != nil || *copied.Filename != "logo.png" {
+		t.Fatalf("Upload() error = %v, want a reference to logo.png", err)
+	}
+
+	// the index does not have the copy yet
+	uploader.Repository = repository
+	repository.snapshot = []*persistence.MultimediaItem{first}
+
+	if err = uploader.Delete(first.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if !storage.Objects["logo.png"] {
+		t.Errorf("Delete() removed logo.png while the copy %v references it", *copied.ID)
+	}
+
+	repository.snapshot = []*persistence.MultimediaItem{copied}
+
+	if err = uploader.Delete(copied.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if storage.Objects["logo.png"] {
+		t.Errorf("Delete() must remove logo.png with its last reference")
+	}
+
+	// the index still has the deleted copy, its released file can not be referenced
+	again, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo-again.png"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	if *again.Filename != "logo-again.png" || !storage.Objects["logo-again.png"] {
+		t.Errorf("Upload() filename = %v, stored = %v, want the released file stored again", *again.Filename, storage.Objects)
+	}
+}
@@ -0,0 +1,584 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/metadata"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPolicyExpiration = 15 * time.Minute
+	DefaultPendingTTL       = 24 * time.Hour
+)
+
+// DefaultMaxSizes are the maximum amount of bytes accepted per persistence type
+var DefaultMaxSizes = map[string]int64{
+	persistence.IMAGE: 10 << 20,
+	persistence.SOUND: 100 << 20,
+	persistence.PDF:   50 << 20,
+	persistence.VIDEO: 2 << 30,
+}
+
+// directContentTypes are the extensions browsers may upload and the Content-Type pinned by their policies,
+// the formats browsers can not display or that can run scripts e.g. SVG are not accepted
+var directContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".pdf":  "application/pdf",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+}
+
+// DirectStorage stores files uploaded by browsers without going through the service
+type DirectStorage interface {
+	PresignPost(policy *files.PostPolicy) (*files.PresignedPost, error)
+	Stat(path *string) (*files.ObjectInfo, error)
+	ReadRange(path *string, byteRange string) (io.ReadCloser, *files.ObjectInfo, error)
+	// StoreStream replaces the uploaded images with their copy without EXIF
+	StoreStream(reader io.Reader, newPath *string, options *files.StoreOptions) error
+	Remove(filename *string) error
+}
+
+// PendingUpload is an upload that was requested but not confirmed yet
+type PendingUpload struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	Type      string    `json:"type"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type PendingUploadRepository interface {
+	Store(upload *PendingUpload) error
+	// Find returns nil when the upload does not exists
+	Find(ID string) (*PendingUpload, error)
+	// Claim removes the upload and returns it, it returns nil when the upload does not exists or was
+	// claimed already, only one of the concurrent calls of an upload returns it
+	Claim(ID string) (*PendingUpload, error)
+	Remove(ID string) error
+	FindExpired(now time.Time) ([]*PendingUpload, error)
+}
+
+// MemoryPendingUploads keeps the pending uploads in memory, it is safe for concurrent use
+type MemoryPendingUploads struct {
+	mutex   sync.Mutex
+	uploads map[string]*PendingUpload
+}
+
+func NewMemoryPendingUploads() *MemoryPendingUploads {
+	return &MemoryPendingUploads{uploads: make(map[string]*PendingUpload)}
+}
+
+func (repository *MemoryPendingUploads) Store(upload *PendingUpload) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	copied := *upload
+	repository.uploads[upload.ID] = &copied
+
+	return nil
+}
+
+func (repository *MemoryPendingUploads) Find(ID string) (*PendingUpload, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	upload, ok := repository.uploads[ID]
+
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *upload
+
+	return &copied, nil
+}
+
+func (repository *MemoryPendingUploads) Claim(ID string) (*PendingUpload, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	upload, ok := repository.uploads[ID]
+
+	if !ok {
+		return nil, nil
+	}
+
+	delete(repository.uploads, ID)
+
+	return upload, nil
+}
+
+func (repository *MemoryPendingUploads) Remove(ID string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	delete(repository.uploads, ID)
+
+	return nil
+}
+
+func (repository *MemoryPendingUploads) FindExpired(now time.Time) ([]*PendingUpload, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var expired []*PendingUpload
+
+	for _, upload := range repository.uploads {
+		if upload.ExpiresAt.Before(now) {
+			copied := *upload
+			expired = append(expired, &copied)
+		}
+	}
+
+	return expired, nil
+}
+
+// UploadTicket is returned to the browsers so they can upload a file directly to the storage
+type UploadTicket struct {
+	ID        string               `json:"id"`
+	Post      *files.PresignedPost `json:"post"`
+	ExpiresAt time.Time            `json:"expiresAt"`
+}
+
+// VerificationError is returned when a file uploaded by a browser does not match its pending upload
+type VerificationError struct {
+	ID      string
+	Message string
+}
+
+func (err VerificationError) Error() string {
+	return fmt.Sprintf("The upload %v is not valid: %v", err.ID, err.Message)
+}
+
+// DirectUploader issues POST policies so browsers upload files directly to S3, the files are
+// recorded as MultimediaItems once their upload is confirmed
+type DirectUploader struct {
+	Bucket *string
+	Region *string
+	// URLs resolves the URL stored as the bucket of the items, the AWS S3 URL of Bucket and Region when nil
+	URLs       files.URLResolver
+	Repository persistence.BasicRepository
+	Storage    DirectStorage
+	Pending    PendingUploadRepository
+	Detector   *FileTypeDetector
+	Extractors map[string]MetadataExtractor
+	// Keys names the uploaded files, DefaultKeyStrategy when nil. The content is unknown when the upload is
+	// requested so ContentHashKeys can not be used
+	Keys KeyStrategy
+	// MaxSizes overrides DefaultMaxSizes per persistence type
+	MaxSizes map[string]int64
+	// PolicyExpiration is the time browsers have to start the upload
+	PolicyExpiration time.Duration
+	// PendingTTL is the time an upload can wait for its confirmation before it expires
+	PendingTTL time.Duration
+	Visibility string
+	// KeepEXIF keeps the EXIF, GPS and XMP metadata of the uploaded images, by default the images are
+	// replaced with a copy without it when they are confirmed
+	KeepEXIF bool
+	// RecordHashes records the SHA-256 of the uploaded files so the AWSUploaders with Deduplication find them,
+	// the files are downloaded to hash them
+	RecordHashes bool
+}
+
+// RequestUpload returns a ticket to upload a file of the given persistence type, the extension of the name
+// must be one of the type. The key and the Content-Type of the upload are the ones of the extension
+func (uploader *DirectUploader) RequestUpload(filename string, fileType string) (*UploadTicket, error) {
+	extension := strings.ToLower(path.Ext(filename))
+	contentType, ok := directContentTypes[extension]
+
+	if !ok || extensionTypes[extension] != fileType || !uploader.detector().isAllowed(fileType) {
+		return nil, UnsupportedFileTypeError{Filename: filename, Type: fileType}
+	}
+
+	options, err := visibilityOptions(uploader.Visibility)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keyOrDefault(uploader.Keys, &UploadedFile{Name: filename, ContentType: contentType})
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ID := uuid.New().String()
+	post, err := uploader.Storage.PresignPost(&files.PostPolicy{
+		Key:         key,
+		ContentType: contentType,
+		MinSize:     1,
+		MaxSize:     uploader.maxSize(fileType),
+		Expires:     durationOrDefault(uploader.PolicyExpiration, DefaultPolicyExpiration),
+		Options:     options,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &PendingUpload{
+		ID:        ID,
+		Key:       key,
+		Type:      fileType,
+		ExpiresAt: now.Add(durationOrDefault(uploader.PendingTTL, DefaultPendingTTL)),
+	}
+
+	if err = uploader.Pending.Store(pending); err != nil {
+		return nil, err
+	}
+
+	return &UploadTicket{ID: ID, Post: post, ExpiresAt: pending.ExpiresAt}, nil
+}
+
+// Confirm verifies the size and the type of an uploaded file, reads its metadata and records it, invalid files
+// are removed. The pending upload is claimed before recording the item so it is recorded only once, it is
+// restored when the item can not be recorded
+func (uploader *DirectUploader) Confirm(ID string) (*persistence.MultimediaItem, error) {
+	pending, err := uploader.Pending.Find(ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pending == nil || pending.ExpiresAt.Before(time.Now()) {
+		return nil, NotFoundError{Message: fmt.Sprintf("The pending upload %v does not exists or expired", ID)}
+	}
+
+	size, err := uploader.verify(pending)
+
+	if err != nil {
+		if _, ok := err.(VerificationError); ok {
+			_ = uploader.discard(pending)
+		}
+
+		return nil, err
+	}
+
+	var filename *string
+	var hash string
+	strip := pending.Type == persistence.IMAGE && !uploader.KeepEXIF
+
+	if strip || uploader.RecordHashes || uploader.extractor(pending.Type) != nil {
+		if filename, hash, err = uploader.download(pending.Key, size); err != nil {
+			return nil, err
+		}
+
+		defer os.Remove(*filename)
+	}
+
+	if strip {
+		if filename, err = uploader.stripEXIF(filename, pending); err != nil {
+			if _, ok := err.(VerificationError); ok {
+				_ = uploader.discard(pending)
+			}
+
+			return nil, err
+		}
+
+		defer os.Remove(*filename)
+	}
+
+	item, err := uploader.newItem(filename, hash, pending)
+
+	if err != nil {
+		if _, ok := err.(InvalidDocumentError); ok {
+			_ = uploader.discard(pending)
+		}
+
+		return nil, err
+	}
+
+	claimed, err := uploader.Pending.Claim(ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claimed == nil {
+		return nil, NotFoundError{Message: fmt.Sprintf("The pending upload %v was confirmed already", ID)}
+	}
+
+	if err = uploader.Repository.Store(item); err != nil {
+		if restoreErr := uploader.Pending.Store(claimed); restoreErr != nil {
+			return nil, RollbackError{Err: err, RollbackErr: restoreErr}
+		}
+
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// newItem returns the item of a verified upload with its hash and its metadata, the local copy is nil when
+// neither of them are needed
+func (uploader *DirectUploader) newItem(filename *string, hash string, pending *PendingUpload) (*persistence.MultimediaItem, error) {
+	bucket := baseURL(uploader.URLs, uploader.Bucket, uploader.Region)
+	item, err := persistence.NewMultimediaItem(&bucket, aws.String(pending.Key), aws.String(pending.Type))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if uploader.Visibility != "" {
+		item.Visibility = aws.String(uploader.Visibility)
+	}
+
+	if hash != "" {
+		item.Hash = &hash
+	}
+
+	if extractor := uploader.extractor(pending.Type); extractor != nil && filename != nil {
+		if err = extractor.Extract(filename, item); err != nil {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
+
+// ExpirePending removes the files and the records of the uploads that were not confirmed in time
+func (uploader *DirectUploader) ExpirePending() (int, error) {
+	expired, err := uploader.Pending.FindExpired(time.Now())
+
+	if err != nil {
+		return 0, err
+	}
+
+	for index, pending := range expired {
+		if err = uploader.discard(pending); err != nil {
+			return index, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+// verify checks the size and the type of the uploaded file and returns its size without downloading it. The
+// type is detected from the content only because the client chooses the extension of the key
+func (uploader *DirectUploader) verify(pending *PendingUpload) (int64, error) {
+	info, err := uploader.Storage.Stat(aws.String(pending.Key))
+
+	if err != nil {
+		return 0, err
+	}
+
+	if maxSize := uploader.maxSize(pending.Type); info.ContentLength > maxSize {
+		return 0, VerificationError{ID: pending.ID, Message: fmt.Sprintf("%v bytes exceeds the limit of %v", info.ContentLength, maxSize)}
+	}
+
+	if info.ContentLength <= 0 {
+		return 0, VerificationError{ID: pending.ID, Message: "the file is empty"}
+	}
+
+	header, err := uploader.readHeader(pending.Key)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return info.ContentLength, uploader.verifyType(header, pending)
+}
+
+// readHeader reads the first bytes of an uploaded file used to detect its type
+func (uploader *DirectUploader) readHeader(key string) ([]byte, error) {
+	body, _, err := uploader.Storage.ReadRange(aws.String(key), fmt.Sprintf("bytes=0-%v", sniffLength-1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer body.Close()
+
+	header := make([]byte, sniffLength)
+	read, err := io.ReadFull(body, header)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return header[:read], nil
+}
+
+// verifyType detects the type of an upload by its magic bytes only and compares it with the type of the upload
+func (uploader *DirectUploader) verifyType(header []byte, pending *PendingUpload) error {
+	// an empty name prevents the classifiers from trusting the extension
+	fileType, err := uploader.detector().DetectHeader(header, "")
+
+	if err != nil {
+		return VerificationError{ID: pending.ID, Message: fmt.Sprintf("the content is not a known %v format", pending.Type)}
+	}
+
+	if *fileType != pending.Type {
+		return VerificationError{ID: pending.ID, Message: fmt.Sprintf("the file is a %v, expected %v", *fileType, pending.Type)}
+	}
+
+	return nil
+}
+
+// download copies at most size bytes of the uploaded file to a temporary file and returns its path and, with
+// RecordHashes, the hexadecimal SHA-256 of the copied content
+func (uploader *DirectUploader) download(key string, size int64) (*string, string, error) {
+	body, _, err := uploader.Storage.ReadRange(aws.String(key), fmt.Sprintf("bytes=0-%v", size-1))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer body.Close()
+
+	file, err := ioutil.TempFile("", "direct-*")
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := file.Name()
+	hash := sha256.New()
+	var content io.Reader = io.LimitReader(body, size)
+
+	if uploader.RecordHashes {
+		content = io.TeeReader(content, hash)
+	}
+
+	_, err = io.Copy(file, content)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(name)
+
+		return nil, "", err
+	}
+
+	if !uploader.RecordHashes {
+		return &name, "", nil
+	}
+
+	return &name, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// stripEXIF removes the metadata of an uploaded image and replaces the uploaded file when it had metadata, it
+// returns the local copy without metadata. The images whose metadata can not be removed are not valid
+func (uploader *DirectUploader) stripEXIF(filename *string, pending *PendingUpload) (*string, error) {
+	stripped, err := stripEXIF(filename, ioutil.Discard)
+
+	switch err.(type) {
+	case nil:
+	case metadata.UnstrippableFormatError, metadata.InvalidFormatError:
+		return nil, VerificationError{ID: pending.ID, Message: err.Error()}
+	default:
+		return nil, err
+	}
+
+	if err = uploader.replace(*filename, *stripped, pending.Key); err != nil {
+		_ = os.Remove(*stripped)
+
+		return nil, err
+	}
+
+	return stripped, nil
+}
+
+// replace stores the stripped copy of an uploaded file under its key unless both have the same content
+func (uploader *DirectUploader) replace(original, stripped, key string) error {
+	originalHash, err := fileHash(original)
+
+	if err != nil {
+		return err
+	}
+
+	strippedHash, err := fileHash(stripped)
+
+	if err != nil || strippedHash == originalHash {
+		return err
+	}
+
+	options, err := visibilityOptions(uploader.Visibility)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(stripped)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return uploader.Storage.StoreStream(file, aws.String(key), options)
+}
+
+// discard removes the uploaded file, if any, and the pending upload
+func (uploader *DirectUploader) discard(pending *PendingUpload) error {
+	if err := uploader.Storage.Remove(aws.String(pending.Key)); err != nil {
+		return err
+	}
+
+	return uploader.Pending.Remove(pending.ID)
+}
+
+func (uploader *DirectUploader) maxSize(fileType string) int64 {
+	if maxSize, ok := uploader.MaxSizes[fileType]; ok {
+		return maxSize
+	}
+
+	return DefaultMaxSizes[fileType]
+}
+
+func (uploader *DirectUploader) extractor(fileType string) MetadataExtractor {
+	if extractor, ok := uploader.Extractors[fileType]; ok {
+		return extractor
+	}
+
+	return defaultExtractors[fileType]
+}
+
+func (uploader *DirectUploader) detector() *FileTypeDetector {
+	if uploader.Detector == nil {
+		return NewFileTypeDetector()
+	}
+
+	return uploader.Detector
+}
+
+func durationOrDefault(duration, defaultDuration time.Duration) time.Duration {
+	if duration <= 0 {
+		return defaultDuration
+	}
+
+	return duration
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+type MemoryDirectStorage struct {
+	Objects  map[string][]byte
+	Policies []*files.PostPolicy
+	Ranges   []string
+	Stored   int
+}
+
+func (storage *MemoryDirectStorage) PresignPost(policy *files.PostPolicy) (*files.PresignedPost, error) {
+	storage.Policies = append(storage.Policies, policy)
+
+	return &files.PresignedPost{URL: "https://bucket.s3.amazonaws.com/", Fields: map[string]string{"key": policy.Key}}, nil
+}
+
+func (storage *MemoryDirectStorage) Stat(path *string) (*files.ObjectInfo, error) {
+	content, ok := storage.Objects[*path]
+
+	if !ok {
+		return nil, NotFoundError{Message: "Not Found"}
+	}
+
+	return &files.ObjectInfo{ContentLength: int64(len(content))}, nil
+}
+
+func (storage *MemoryDirectStorage) ReadRange(path *string, byteRange string) (io.ReadCloser, *files.ObjectInfo, error) {
+	var start, end int
+	content := storage.Objects[*path]
+	storage.Ranges = append(storage.Ranges, byteRange)
+
+	if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); err != nil {
+		return nil, nil, err
+	}
+
+	if end >= len(content) {
+		end = len(content) - 1
+	}
+
+	content = content[start : end+1]
+
+	return ioutil.NopCloser(bytes.NewReader(content)), &files.ObjectInfo{ContentLength: int64(len(content))}, nil
+}
+
+func (storage *MemoryDirectStorage) StoreStream(reader io.Reader, newPath *string, options *files.StoreOptions) error {
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return err
+	}
+
+	storage.Objects[*newPath] = content
+	storage.Stored++
+
+	return nil
+}
+
+func (storage *MemoryDirectStorage) Remove(filename *string) error {
+	delete(storage.Objects, *filename)
+
+	return nil
+}
+
+func newDirectUploader() (*DirectUploader, *MemoryDirectStorage, *RecordingRepository) {
+	storage := &MemoryDirectStorage{Objects: map[string][]byte{}}
+	repository := &RecordingRepository{}
+
+	return &DirectUploader{
+		Bucket:     aws.String("bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: repository,
+		Storage:    storage,
+		Pending:    NewMemoryPendingUploads(),
+		MaxSizes:   map[string]int64{persistence.IMAGE: 1024},
+	}, storage, repository
+}
+
+func TestDirectUploader_RequestUpload(t *testing.T) {
+	uploader, storage, _ := newDirectUploader()
+
+	if _, err := uploader.RequestUpload("script.sh", "script"); err == nil {
+		t.Errorf("RequestUpload() expects an error for unknown types")
+	}
+
+	for _, filename := range []string{"logo.svg", "logo.pdf", "logo.tiff", "logo"} {
+		if _, err := uploader.RequestUpload(filename, persistence.IMAGE); err == nil {
+			t.Errorf("RequestUpload() expects an error for the image %v", filename)
+		}
+	}
+
+	ticket, err := uploader.RequestUpload("logo.png", persistence.IMAGE)
+
+	if err != nil {
+		t.Errorf("RequestUpload() error = %v", err)
+		return
+	}
+
+	policy := storage.Policies[0]
+
+	if policy.ContentType != "image/png" || policy.MaxSize != 1024 {
+		t.Errorf("RequestUpload() policy = %+v, want image/png files up to 1024 bytes", policy)
+	}
+
+	pending, _ := uploader.Pending.Find(ticket.ID)
+
+	if pending == nil || pending.Key != policy.Key || pending.Type != persistence.IMAGE {
+		t.Errorf("RequestUpload() pending upload = %+v", pending)
+	}
+
+	if !regexp.MustCompile(`^\d{14}-\d+\.png$`).MatchString(policy.Key) {
+		t.Errorf("RequestUpload() key = %v, want the default key strategy", policy.Key)
+	}
+
+	uploader.Keys = PrefixKeys{Prefix: "tenant", Keys: OriginalNameKeys{}}
+
+	if _, err = uploader.RequestUpload("../My Logo.PNG", persistence.IMAGE); err != nil {
+		t.Errorf("RequestUpload() error = %v", err)
+		return
+	}
+
+	if key := storage.Policies[1].Key; !regexp.MustCompile(`^tenant/My-Logo-\d+\.png$`).MatchString(key) {
+		t.Errorf("RequestUpload() key = %v, want the sanitized name of the key strategy", key)
+	}
+}
+
+func newPNG(t *testing.T) []byte {
+	buffer := &bytes.Buffer{}
+
+	if err := png.Encode(buffer, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestDirectUploader_Confirm(t *testing.T) {
+	content := newPNG(t)
+	tests := []struct {
+		name         string
+		content      []byte
+		upload       bool
+		recordHashes bool
+		wantErr      bool
+		wantRemoved  bool
+	}{
+		{name: "Records a valid upload", content: content, upload: true},
+		{name: "Records a valid upload with its hash", content: content, upload: true, recordHashes: true},
+		{name: "Error if the file was not uploaded", upload: false, wantErr: true},
+		{name: "Removes files of other types", content: []byte("%PDF-1.4\n"), upload: true, wantErr: true, wantRemoved: true},
+		{name: "Removes files that only have the extension of the type", content: []byte("#!/bin/sh\n"), upload: true, wantErr: true, wantRemoved: true},
+		{name: "Removes files bigger than the limit", content: append(content, make([]byte, 1024)...), upload: true, wantErr: true, wantRemoved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader, storage, repository := newDirectUploader()
+			uploader.RecordHashes = tt.recordHashes
+			ticket, _ := uploader.RequestUpload("logo.png", persistence.IMAGE)
+			key := storage.Policies[0].Key
+
+			if tt.upload {
+				storage.Objects[key] = tt.content
+			}
+
+			got, err := uploader.Confirm(ticket.ID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Confirm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, exists := storage.Objects[key]; exists == tt.wantRemoved && tt.upload {
+				t.Errorf("Confirm() file exists = %v, want removed %v", exists, tt.wantRemoved)
+			}
+			if tt.wantRemoved && len(storage.Ranges) > 0 && !reflect.DeepEqual(storage.Ranges, []string{"bytes=0-511"}) {
+				t.Errorf("Confirm() read the ranges %v, want at most the header of invalid files", storage.Ranges)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got.Filename != key || len(repository.Items) != 1 {
+				t.Errorf("Confirm() got = %+v, records %v", got, len(repository.Items))
+			}
+			if want := (&persistence.ImageMetadata{Width: 3, Height: 2, Orientation: 1, ColorModel: "gray"}); !reflect.DeepEqual(got.Image, want) {
+				t.Errorf("Confirm() image = %+v, want %+v", got.Image, want)
+			}
+			if want := fmt.Sprintf("%x", sha256.Sum256(tt.content)); (got.Hash != nil) != tt.recordHashes || tt.recordHashes && *got.Hash != want {
+				t.Errorf("Confirm() hash = %v, want the SHA-256 of the content %v", aws.StringValue(got.Hash), tt.recordHashes)
+			}
+			if pending, _ := uploader.Pending.Find(ticket.ID); pending != nil {
+				t.Errorf("Confirm() must remove the pending upload")
+			}
+			if _, err = uploader.Confirm(ticket.ID); err == nil {
+				t.Errorf("Confirm() a confirmed upload can not be confirmed again")
+			}
+		})
+	}
+}
+
+func TestDirectUploader_ConfirmStripsEXIF(t *testing.T) {
+	photo := mustReadFile(t, "testdata/photo.jpg")
+	tests := []struct {
+		name        string
+		filename    string
+		content     []byte
+		keepEXIF    bool
+		wantErr     bool
+		wantEXIF    bool
+		wantStored  int
+		wantRemoved bool
+	}{
+		{name: "Replaces the uploaded image with a copy without EXIF", filename: "photo.jpg", content: photo, wantStored: 1},
+		{name: "Keeps the EXIF of the uploaded image", filename: "photo.jpg", content: photo, keepEXIF: true, wantEXIF: true},
+		{name: "Does not replace the images without metadata", filename: "logo.png", content: newPNG(t)},
+		{name: "Removes the images whose EXIF can not be removed", filename: "photo.png", content: []byte("II*\x00\x08\x00\x00\x00GPS-SECRET"), wantErr: true, wantRemoved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader, storage, _ := newDirectUploader()
+			uploader.KeepEXIF = tt.keepEXIF
+			ticket, _ := uploader.RequestUpload(tt.filename, persistence.IMAGE)
+			key := storage.Policies[0].Key
+			storage.Objects[key] = tt.content
+
+			got, err := uploader.Confirm(ticket.ID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Confirm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, exists := storage.Objects[key]; exists == tt.wantRemoved {
+				t.Errorf("Confirm() file exists = %v, want removed %v", exists, tt.wantRemoved)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hasEXIF := bytes.Contains(storage.Objects[key], []byte("GPS-SECRET")); hasEXIF != tt.wantEXIF || storage.Stored != tt.wantStored {
+				t.Errorf("Confirm() stored the GPS data = %v, replaced %v times, want %v and %v", hasEXIF, storage.Stored, tt.wantEXIF, tt.wantStored)
+			}
+			if tt.filename == "photo.jpg" && got.Image.Orientation != 6 {
+				t.Errorf("Confirm() image = %+v, want the orientation of the uploaded image", got.Image)
+			}
+		})
+	}
+}
+
+func TestDirectUploader_ConfirmStoreFailure(t *testing.T) {
+	uploader, storage, repository := newDirectUploader()
+	repository.StoreErr = fmt.Errorf("dynamo is down")
+	ticket, _ := uploader.RequestUpload("logo.png", persistence.IMAGE)
+	storage.Objects[storage.Policies[0].Key] = newPNG(t)
+
+	if got, err := uploader.Confirm(ticket.ID); err == nil || got != nil {
+		t.Errorf("Confirm() = %v, %v, want only the error of the repository", got, err)
+	}
+
+	if pending, _ := uploader.Pending.Find(ticket.ID); pending == nil {
+		t.Errorf("Confirm() must restore the pending upload so it can be confirmed again")
+	}
+
+	repository.StoreErr = nil
+
+	if _, err := uploader.Confirm(ticket.ID); err != nil || len(repository.Items) != 1 {
+		t.Errorf("Confirm() error = %v, records %v, want the item recorded once", err, len(repository.Items))
+	}
+}
+
+func TestDirectUploader_ExpirePending(t *testing.T) {
+	uploader, storage, _ := newDirectUploader()
+	uploader.PendingTTL = time.Nanosecond
+
+	ticket, _ := uploader.RequestUpload("logo.png", persistence.IMAGE)
+	storage.Objects[storage.Policies[0].Key] = []byte("\x89PNG\r\n\x1a\n")
+	time.Sleep(time.Millisecond)
+
+	if _, err := uploader.Confirm(ticket.ID); err == nil {
+		t.Errorf("Confirm() expects an error for expired uploads")
+	} else if _, ok := err.(NotFoundError); !ok {
+		t.Errorf("Confirm() error = %T, want NotFoundError", err)
+	}
+
+	expired, err := uploader.ExpirePending()
+
+	if err != nil || expired != 1 {
+		t.Errorf("ExpirePending() = %v, %v, want 1 expired upload", expired, err)
+	}
+
+	if len(storage.Objects) != 0 {
+		t.Errorf("ExpirePending() must remove the uploaded files")
+	}
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// sniffLength is the amount of bytes needed to detect a content type
+const sniffLength = 512
+
+// TypeDetector resolves the persistence type of a local file
+type TypeDetector interface {
+	Detect(filename *string) (*string, error)
+}
+
+// FileClassifier maps the first bytes and the name of a file to a persistence type,
+// it returns false when it can not classify the file
+type FileClassifier interface {
+	Classify(header []byte, filename string) (string, bool)
+}
+
+// ClassifierFunc allows the use of ordinary functions as classifiers
+type ClassifierFunc func(header []byte, filename string) (string, bool)
+
+// Classify calls fn(header, filename)
+func (fn ClassifierFunc) Classify(header []byte, filename string) (string, bool) {
+	return fn(header, filename)
+}
+
+type UnsupportedFileTypeError struct {
+	Filename    string
+	Type        string
+	ContentType string
+}
+
+func (err UnsupportedFileTypeError) Error() string {
+	if err.Type == "" {
+		return fmt.Sprintf("The file %v has an unknown type %v", err.Filename, err.ContentType)
+	}
+
+	return fmt.Sprintf("The file type %v of %v is not allowed", err.Type, err.Filename)
+}
+
+type FileTypeDetector struct {
+	Classifiers  []FileClassifier
+	AllowedTypes []string
+}
+
+// NewFileTypeDetector returns a detector that classifies by magic bytes, the extension is not trusted so the
+// files whose content does not match a known format are rejected e.g. HTML named .jpg or SVG images. The
+// formats without magic bytes need a registered classifier
+func NewFileTypeDetector() *FileTypeDetector {
+	return &FileTypeDetector{
+		Classifiers: []FileClassifier{
+			ClassifierFunc(classifyByMagicBytes),
+		},
+		AllowedTypes: []string{persistence.SOUND, persistence.IMAGE, persistence.PDF, persistence.VIDEO},
+	}
+}
+
+// Register adds a classifier that takes precedence over the ones already registered
+func (detector *FileTypeDetector) Register(classifier FileClassifier) {
+	detector.Classifiers = append([]FileClassifier{classifier}, detector.Classifiers...)
+}
+
+// Detect reads the header of the given file and returns its persistence type
+func (detector *FileTypeDetector) Detect(filename *string) (*string, error) {
+	header, err := readHeader(*filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return detector.DetectHeader(header, *filename)
+}
+
+// DetectHeader returns the persistence type of the given file header
+func (detector *FileTypeDetector) DetectHeader(header []byte, filename string) (*string, error) {
+	for _, classifier := range detector.Classifiers {
+		fileType, ok := classifier.Classify(header, filename)
+
+		if !ok {
+			continue
+		}
+
+		if !detector.isAllowed(fileType) {
+			return nil, UnsupportedFileTypeError{Filename: filename, Type: fileType}
+		}
+
+		return &fileType, nil
+	}
+
+	return nil, UnsupportedFileTypeError{Filename: filename, ContentType: http.DetectContentType(header)}
+}
+
+// readHeader returns the first bytes of a local file used to detect its type
+func readHeader(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	header := make([]byte, sniffLength)
+	read, err := io.ReadFull(file, header)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return header[:read], nil
+}
+
+func (detector *FileTypeDetector) isAllowed(fileType string) bool {
+	for _, allowed := range detector.AllowedTypes {
+		if allowed == fileType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type magicSignature struct {
+	offset int
+	prefix []byte
+	kind   string
+	// container is the magic at offset zero of the signatures of a container form type e.g. RIFF
+	container []byte
+}
+
+var (
+	riffMagic = []byte("RIFF")
+	iffMagic  = []byte("FORM")
+)
+
+var magicSignatures = []magicSignature{
+	{0, []byte("%PDF-"), persistence.PDF, nil},
+	{0, []byte("\xFF\xD8\xFF"), persistence.IMAGE, nil},
+	{0, []byte("\x89PNG\r\n\x1a\n"), persistence.IMAGE, nil},
+	{0, []byte("GIF87a"), persistence.IMAGE, nil},
+	{0, []byte("GIF89a"), persistence.IMAGE, nil},
+	{0, []byte("II*\x00"), persistence.IMAGE, nil},
+	{0, []byte("MM\x00*"), persistence.IMAGE, nil},
+	{8, []byte("WEBP"), persistence.IMAGE, riffMagic},
+	{8, []byte("WAVE"), persistence.SOUND, riffMagic},
+	{8, []byte("AVI "), persistence.VIDEO, riffMagic},
+	{0, []byte("ID3"), persistence.SOUND, nil},
+	{0, []byte("fLaC"), persistence.SOUND, nil},
+	{0, []byte("OggS"), persistence.SOUND, nil},
+	{8, []byte("AIFF"), persistence.SOUND, iffMagic},
+	{8, []byte("AIFC"), persistence.SOUND, iffMagic},
+	{0, []byte("MThd"), persistence.SOUND, nil},
+	{0, []byte("\x1A\x45\xDF\xA3"), persistence.VIDEO, nil},
+	// the QuickTime movies without a ftyp box start with one of these atoms
+	{4, []byte("moov"), persistence.VIDEO, nil},
+	{4, []byte("mdat"), persistence.VIDEO, nil},
+	{4, []byte("wide"), persistence.VIDEO, nil},
+}
+
+// bmpHeaderSizes are the sizes of the BMP information headers, from BITMAPCOREHEADER to BITMAPV5HEADER
+var bmpHeaderSizes = map[uint32]bool{12: true, 40: true, 52: true, 56: true, 64: true, 108: true, 124: true}
+
+// isBMP checks the file header of a BMP image, its reserved fields are zero, and the size of its information
+// header because the "BM" magic alone matches many text files
+func isBMP(header []byte) bool {
+	if len(header) < 18 || !bytes.HasPrefix(header, []byte("BM")) {
+		return false
+	}
+
+	return binary.LittleEndian.Uint32(header[6:10]) == 0 && bmpHeaderSizes[binary.LittleEndian.Uint32(header[14:18])]
+}
+
+// isoBrands maps ISO base media (MP4) major brands to persistence types
+var isoBrands = map[string]string{
+	"M4A ": persistence.SOUND,
+	"M4B ": persistence.SOUND,
+	"M4P ": persistence.SOUND,
+	"avif": persistence.IMAGE,
+	"heic": persistence.IMAGE,
+	"heix": persistence.IMAGE,
+	"mif1": persistence.IMAGE,
+}
+
+func classifyByMagicBytes(header []byte, filename string) (string, bool) {
+	if len(header) >= 12 && bytes.Equal(header[4:8], []byte("ftyp")) {
+		if kind, ok := isoBrands[string(header[8:12])]; ok {
+			return kind, true
+		}
+
+		return persistence.VIDEO, true
+	}
+
+	for _, signature := range magicSignatures {
+		end := signature.offset + len(signature.prefix)
+
+		if len(header) < end || !bytes.Equal(header[signature.offset:end], signature.prefix) {
+			continue
+		}
+
+		if signature.container == nil || bytes.HasPrefix(header, signature.container) {
+			return signature.kind, true
+		}
+	}
+
+	if isBMP(header) {
+		return persistence.IMAGE, true
+	}
+
+	// MPEG audio frames without an ID3 tag start with an 11 bits frame sync
+	if len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 {
+		return persistence.SOUND, true
+	}
+
+	return "", false
+}
+
+// extensionTypes are the persistence types of the known extensions
+var extensionTypes = map[string]string{
+	".pdf":  persistence.PDF,
+	".jpg":  persistence.IMAGE,
+	".jpeg": persistence.IMAGE,
+	".png":  persistence.IMAGE,
+	".gif":  persistence.IMAGE,
+	".bmp":  persistence.IMAGE,
+	".tif":  persistence.IMAGE,
+	".tiff": persistence.IMAGE,
+	".webp": persistence.IMAGE,
+	".mp3":  persistence.SOUND,
+	".wav":  persistence.SOUND,
+	".ogg":  persistence.SOUND,
+	".oga":  persistence.SOUND,
+	".flac": persistence.SOUND,
+	".m4a":  persistence.SOUND,
+	".aac":  persistence.SOUND,
+	".mp4":  persistence.VIDEO,
+	".m4v":  persistence.VIDEO,
+	".mov":  persistence.VIDEO,
+	".webm": persistence.VIDEO,
+	".mkv":  persistence.VIDEO,
+	".avi":  persistence.VIDEO,
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestFileTypeDetector_DetectHeader(t *testing.T) {
+	type args struct {
+		header   []byte
+		filename string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Detects a PDF by its magic bytes",
+			args:    args{header: []byte("%PDF-1.7\n"), filename: "document.bin"},
+			want:    persistence.PDF,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a PNG image",
+			args:    args{header: []byte("\x89PNG\r\n\x1a\n\x00\x00"), filename: "image"},
+			want:    persistence.IMAGE,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a JPEG image",
+			args:    args{header: []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"), filename: "image"},
+			want:    persistence.IMAGE,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a MP3 with ID3 tag",
+			args:    args{header: []byte("ID3\x03\x00\x00\x00"), filename: "song"},
+			want:    persistence.SOUND,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a MP3 frame without tags",
+			args:    args{header: []byte("\xFF\xFB\x90\x64"), filename: "song"},
+			want:    persistence.SOUND,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a WAV file",
+			args:    args{header: []byte("RIFF\x24\x08\x00\x00WAVEfmt "), filename: "sound"},
+			want:    persistence.SOUND,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a M4A audio from the ISO brand",
+			args:    args{header: []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"), filename: "sound"},
+			want:    persistence.SOUND,
+			wantErr: false,
+		},
+		{
+			name:    "Detects an AIFF file",
+			args:    args{header: []byte("FORM\x00\x00\x10\x00AIFFCOMM"), filename: "sound"},
+			want:    persistence.SOUND,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a BMP image",
+			args:    args{header: []byte("BM\x3A\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00\x28\x00\x00\x00"), filename: "image"},
+			want:    persistence.IMAGE,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a QuickTime movie without ftyp box",
+			args:    args{header: []byte("\x00\x00\x00\x08wide\x00\x10\x00\x00mdat"), filename: "movie"},
+			want:    persistence.VIDEO,
+			wantErr: false,
+		},
+		{
+			name:    "Rejects SVG images",
+			args:    args{header: []byte("<svg xmlns=\"http://www.w3.org/2000/svg\">"), filename: "logo.SVG"},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects content that does not match its extension",
+			args:    args{header: []byte("<html><script>alert(1)</script>"), filename: "photo.jpg"},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects text that starts like a BMP image",
+			args:    args{header: []byte("BMW owners manual, chapter 1"), filename: "image.bmp"},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects form types outside of their container",
+			args:    args{header: []byte("JUNK\x00\x00\x00\x00WAVEfmt "), filename: "sound.wav"},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects IFF files that are not AIFF",
+			args:    args{header: []byte("FORM\x00\x00\x10\x00ILBMBMHD"), filename: "sound.aiff"},
+			wantErr: true,
+		},
+		{
+			name:    "Detects a MP4 video",
+			args:    args{header: []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00"), filename: "movie"},
+			want:    persistence.VIDEO,
+			wantErr: false,
+		},
+		{
+			name:    "Detects a WebM video",
+			args:    args{header: []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01"), filename: "movie"},
+			want:    persistence.VIDEO,
+			wantErr: false,
+		},
+		{
+			name:    "Rejects unknown files",
+			args:    args{header: []byte("package service"), filename: "upload.go"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewFileTypeDetector().DetectHeader(tt.args.header, tt.args.filename)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DetectHeader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if _, ok := err.(UnsupportedFileTypeError); !ok {
+					t.Errorf("DetectHeader() error = %T, want UnsupportedFileTypeError", err)
+				}
+				return
+			}
+			if *got != tt.want {
+				t.Errorf("DetectHeader() got = %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTypeDetector_AllowedTypes(t *testing.T) {
+	detector := NewFileTypeDetector()
+	detector.AllowedTypes = []string{persistence.IMAGE}
+
+	_, err := detector.DetectHeader([]byte("%PDF-1.7\n"), "document.pdf")
+
+	if _, ok := err.(UnsupportedFileTypeError); !ok {
+		t.Errorf("DetectHeader() error = %v, want UnsupportedFileTypeError", err)
+	}
+}
+
+func TestFileTypeDetector_Register(t *testing.T) {
+	detector := NewFileTypeDetector()
+	detector.Register(ClassifierFunc(func(header []byte, filename string) (string, bool) {
+		return persistence.PDF, filename == "contract.custom"
+	}))
+
+	got, err := detector.DetectHeader([]byte("custom format"), "contract.custom")
+
+	if err != nil {
+		t.Errorf("DetectHeader() error = %v", err)
+		return
+	}
+
+	if *got != persistence.PDF {
+		t.Errorf("DetectHeader() got = %v, want %v", *got, persistence.PDF)
+	}
+}
+
+func TestFileTypeDetector_Detect(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename *string
+		want     string
+		wantErr  bool
+	}{
+		{name: "Detects an image file", filename: aws.String("testdata/image.png"), want: persistence.IMAGE},
+		{name: "Detects a pdf file", filename: aws.String("testdata/document.pdf"), want: persistence.PDF},
+		{name: "Error if the file does not exists", filename: aws.String("testdata/missing.png"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewFileTypeDetector().Detect(tt.filename)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Detect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("Detect() got = %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -1,30 +1,98 @@
 package service
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path"
-	"time"
+	"sort"
+	"sync"
 
 	"github.com/alejo-lapix/multimedia-go/persistence"
-
-	"github.com/google/uuid"
 )
 
 type HttpFileUploader struct {
-	Uploader      Uploader
+	Uploader Uploader
+	// MaxMBUploaded is the part of the multipart body kept in memory, the rest is stored in temporary files
 	MaxMBUploaded int64
+	// MaxRequestSize is the maximum amount of bytes of the request body, DefaultMaxRequestSize of MaxSizes when
+	// zero and there is no limit when negative. The batches of several large files need a bigger limit
+	MaxRequestSize int64
+	// MaxSizes overrides DefaultMaxSizes per persistence type
+	MaxSizes map[string]int64
+	// Detector resolves the type of the uploaded files to apply its maximum size, NewFileTypeDetector when nil
+	Detector *FileTypeDetector
+	// Keys names the stored files, DefaultKeyStrategy when nil
+	Keys KeyStrategy
+}
+
+// MultipartOverhead is the allowance for the headers, the boundaries and the other fields of a multipart body
+const MultipartOverhead = 1 << 20
+
+// DefaultMaxRequestSize returns the largest maximum size of a type plus MultipartOverhead, maxSizes overrides
+// DefaultMaxSizes per persistence type
+func DefaultMaxRequestSize(maxSizes map[string]int64) int64 {
+	var largest int64
+
+	for fileType, maxSize := range DefaultMaxSizes {
+		if override, ok := maxSizes[fileType]; ok {
+			maxSize = override
+		}
+
+		if maxSize > largest {
+			largest = maxSize
+		}
+	}
+
+	for _, maxSize := range maxSizes {
+		if maxSize > largest {
+			largest = maxSize
+		}
+	}
+
+	return largest + MultipartOverhead
 }
 
 type IOFileUploader struct {
 	Uploader Uploader
+	// MaxSizes overrides DefaultMaxSizes per persistence type
+	MaxSizes map[string]int64
+	// Detector resolves the type of the uploaded files to apply its maximum size, NewFileTypeDetector when nil
+	Detector *FileTypeDetector
+	// Keys names the stored files, DefaultKeyStrategy when nil
+	Keys KeyStrategy
 }
 
+// TooLargeError is returned when a request or an uploaded file exceeds its maximum size
+type TooLargeError struct {
+	// Filename is empty when the whole request is too large
+	Filename string
+	// Type is the persistence type of the file, it is empty when the type is unknown
+	Type    string
+	MaxSize int64
+}
+
+func (err TooLargeError) Error() string {
+	switch {
+	case err.Filename == "":
+		return fmt.Sprintf("The request exceeds the limit of %v bytes", err.MaxSize)
+	case err.Type == "":
+		return fmt.Sprintf("The file %v exceeds the limit of %v bytes", err.Filename, err.MaxSize)
+	}
+
+	return fmt.Sprintf("The file %v exceeds the limit of %v bytes of the %v files", err.Filename, err.MaxSize, err.Type)
+}
+
+// MoveFile streams at most fileSize bytes of the reader to a temporal file and uploads it, the files larger
+// than the maximum size of their type return a TooLargeError
 func (uploader *IOFileUploader) MoveFile(ioReader io.Reader, fileName string, fileSize int64) (*persistence.MultimediaItem, error) {
-	buffer := make([]byte, fileSize)
 	fileExtension := path.Ext(fileName)
 	temporalFile, err := ioutil.TempFile(os.TempDir(), fmt.Sprintf("upload-*%v", fileExtension))
 
@@ -32,81 +100,394 @@ func (uploader *IOFileUploader) MoveFile(ioReader io.Reader, fileName string, fi
 		return nil, err
 	}
 
+	defer os.Remove(temporalFile.Name())
 	defer temporalFile.Close()
 
-	_, err = ioReader.Read(buffer)
+	limits := sizeLimits{detector: uploader.Detector, maxSizes: uploader.MaxSizes, hash: hashes(uploader.Uploader, uploader.Keys)}
+	hash, err := limits.copy(temporalFile, io.LimitReader(ioReader, fileSize), fileName)
 
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = temporalFile.Write(buffer)
+	item, _, err := upload(uploader.Uploader, uploader.Keys, temporalFile.Name(), fileName, hash)
 
-	if err != nil {
-		return nil, err
+	return item, err
+}
+
+// ParseForm parses the multipart form of the request limiting its body to MaxRequestSize, the larger
+// bodies return a TooLargeError
+func (uploader *HttpFileUploader) ParseForm(request *http.Request) error {
+	if request.MultipartForm != nil {
+		return nil
 	}
 
-	ID := uuid.New().ID()
-	filePath := temporalFile.Name()
-	newFileName := fmt.Sprintf("%v-%v%v", time.Now().Format("20060102150405"), ID, fileExtension)
+	var body *countingReader
+	maxRequestSize := uploader.maxRequestSize()
 
-	item, err := uploader.Uploader.Upload(&filePath, &newFileName)
+	if maxRequestSize > 0 {
+		body = &countingReader{ReadCloser: request.Body}
+		request.Body = http.MaxBytesReader(nil, body, maxRequestSize)
+	}
 
-	if err != nil {
-		return nil, err
+	err := request.ParseMultipartForm(uploader.MaxMBUploaded << 20)
+
+	// MaxBytesReader reads one byte more than the limit to report it was exceeded
+	if err != nil && body != nil && body.read > maxRequestSize {
+		return TooLargeError{MaxSize: maxRequestSize}
 	}
 
-	return item, nil
+	return err
+}
+
+func (uploader *HttpFileUploader) maxRequestSize() int64 {
+	if uploader.MaxRequestSize == 0 {
+		return DefaultMaxRequestSize(uploader.MaxSizes)
+	}
+
+	return uploader.MaxRequestSize
 }
 
 // MoveFile moves a file to the given Uploader configuration
 func (uploader *HttpFileUploader) MoveFile(request *http.Request, key *string) (*persistence.MultimediaItem, error) {
-	var fileExtension string
+	item, _, err := uploader.MoveFileDeduplicated(request, key)
 
-	err := request.ParseMultipartForm(uploader.MaxMBUploaded << 20)
+	return item, err
+}
+
+// MoveFileDeduplicated moves a file like MoveFile and reports if the returned item was stored before with the
+// same content by a DeduplicatingUploader
+func (uploader *HttpFileUploader) MoveFileDeduplicated(request *http.Request, key *string) (*persistence.MultimediaItem, bool, error) {
+	err := uploader.ParseForm(request)
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	file, handler, err := request.FormFile(*key)
 
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer file.Close()
+
+	return uploader.moveFile(file, handler.Filename)
+}
+
+// DefaultUploadWorkers is the amount of files of a batch uploaded at the same time
+const DefaultUploadWorkers = 4
+
+// BatchOptions selects the files of a multipart batch and how they are uploaded
+type BatchOptions struct {
+	// Keys are the form keys of the files, every file of the form is uploaded when empty
+	Keys []string
+	// Workers is the amount of concurrent uploads, DefaultUploadWorkers when zero
+	Workers int
+	// Atomic deletes the items recorded by the batch when any of its files fails
+	Atomic bool
+}
+
+// UploadResult is the outcome of a file of a batch, Item is nil when Err is set
+type UploadResult struct {
+	Key      string
+	Filename string
+	Item     *persistence.MultimediaItem
+	Err      error
+	// Duplicate reports if the Item was stored before with the same content, it is not deleted by a rollback
+	Duplicate bool
+	// RolledBack reports if the item was deleted because another file of an atomic batch failed
+	RolledBack bool
+}
+
+// BatchError is returned when some files of a batch fail, the Results have the error of every file
+type BatchError struct {
+	Failed  int
+	Results []*UploadResult
+}
+
+func (err BatchError) Error() string {
+	return fmt.Sprintf("%v of %v files could not be uploaded", err.Failed, len(err.Results))
+}
+
+// MoveFiles uploads the files under the given keys with a bounded amount of workers so the Uploader must
+// be safe for concurrent use, the results follow the order of the keys and of the files of every key
+func (uploader *HttpFileUploader) MoveFiles(request *http.Request, options BatchOptions) ([]*UploadResult, error) {
+	err := uploader.ParseForm(request)
+
 	if err != nil {
 		return nil, err
 	}
 
+	keys := options.Keys
+
+	if len(keys) == 0 {
+		for key := range request.MultipartForm.File {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+	}
+
+	var results []*UploadResult
+	var headers []*multipart.FileHeader
+
+	for _, key := range keys {
+		for _, header := range request.MultipartForm.File[key] {
+			results = append(results, &UploadResult{Key: key, Filename: header.Filename})
+			headers = append(headers, header)
+		}
+	}
+
+	if len(results) == 0 {
+		return nil, http.ErrMissingFile
+	}
+
+	uploader.moveAll(headers, results, options.Workers)
+	failed := 0
+
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	if failed == 0 {
+		return results, nil
+	}
+
+	batchErr := BatchError{Failed: failed, Results: results}
+
+	if options.Atomic {
+		if rollbackErr := uploader.rollback(results); rollbackErr != nil {
+			return results, RollbackError{Err: batchErr, RollbackErr: rollbackErr}
+		}
+	}
+
+	return results, batchErr
+}
+
+// moveAll fills the results uploading the files from a pool of workers
+func (uploader *HttpFileUploader) moveAll(headers []*multipart.FileHeader, results []*UploadResult, workers int) {
+	if workers <= 0 {
+		workers = DefaultUploadWorkers
+	}
+
+	indexes := make(chan int)
+	wait := sync.WaitGroup{}
+
+	for worker := 0; worker < workers && worker < len(headers); worker++ {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for index := range indexes {
+				result := results[index]
+				result.Item, result.Duplicate, result.Err = uploader.moveHeader(headers[index])
+			}
+		}()
+	}
+
+	for index := range headers {
+		indexes <- index
+	}
+
+	close(indexes)
+	wait.Wait()
+}
+
+// rollback deletes the items recorded by the batch once and returns the first error, the duplicates stored
+// before the batch are kept
+func (uploader *HttpFileUploader) rollback(results []*UploadResult) error {
+	var firstErr error
+	deleted := make(map[string]bool)
+
+	for _, result := range results {
+		if result.Item == nil || result.Duplicate {
+			continue
+		}
+
+		// the files of a batch with the same content may return the same item
+		if deleted[*result.Item.ID] {
+			result.RolledBack = true
+			continue
+		}
+
+		if err := uploader.Uploader.Delete(result.Item.ID); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		deleted[*result.Item.ID] = true
+		result.RolledBack = true
+	}
+
+	return firstErr
+}
+
+func (uploader *HttpFileUploader) moveHeader(header *multipart.FileHeader) (*persistence.MultimediaItem, bool, error) {
+	file, err := header.Open()
+
+	if err != nil {
+		return nil, false, err
+	}
+
 	defer file.Close()
 
-	fileExtension = path.Ext(handler.Filename)
+	return uploader.moveFile(file, header.Filename)
+}
+
+// moveFile copies the file to a temporal file and uploads it with a unique name, it reports if the item was
+// stored before with the same content
+func (uploader *HttpFileUploader) moveFile(file io.Reader, filename string) (*persistence.MultimediaItem, bool, error) {
+	fileExtension := path.Ext(filename)
 	temporalFile, err := ioutil.TempFile(os.TempDir(), fmt.Sprintf("upload-*%v", fileExtension))
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
+	defer os.Remove(temporalFile.Name())
 	defer temporalFile.Close()
 
-	fileBytes, err := ioutil.ReadAll(file)
+	limits := sizeLimits{detector: uploader.Detector, maxSizes: uploader.MaxSizes, hash: hashes(uploader.Uploader, uploader.Keys)}
+	hash, err := limits.copy(temporalFile, file, filename)
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	_, err = temporalFile.Write(fileBytes)
+	return upload(uploader.Uploader, uploader.Keys, temporalFile.Name(), filename, hash)
+}
+
+// upload names the local copy of an uploaded file with the key strategy, DefaultKeyStrategy when nil. The
+// DeduplicatingUploader receives the hash of the file and reports if the item was stored before
+func upload(uploader Uploader, keys KeyStrategy, filename, name, hash string) (*persistence.MultimediaItem, bool, error) {
+	file, err := newUploadedFile(filename, name, hash)
 
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	key, err := keyOrDefault(keys, file)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if deduplicating, ok := uploader.(DeduplicatingUploader); ok {
+		return deduplicating.UploadHashed(&filename, &key, hash)
+	}
+
+	item, err := uploader.Upload(&filename, &key)
+
+	return item, false, err
+}
+
+// hashes reports if the upload needs the SHA-256 of the file, it is used by the uploaders with deduplication
+// enabled and by ContentHashKeys
+func hashes(uploader Uploader, keys KeyStrategy) bool {
+	switch keys.(type) {
+	case ContentHashKeys, *ContentHashKeys:
+		return true
+	}
+
+	deduplicating, ok := uploader.(DeduplicatingUploader)
+
+	return ok && deduplicating.Deduplicates()
+}
+
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+func (reader *countingReader) Read(data []byte) (int, error) {
+	read, err := reader.ReadCloser.Read(data)
+	reader.read += int64(read)
+
+	return read, err
+}
+
+// sizeLimits applies the maximum size of the persistence type of a file while it is copied
+type sizeLimits struct {
+	detector *FileTypeDetector
+	maxSizes map[string]int64
+	// hash computes the SHA-256 of the copied content
+	hash bool
+}
+
+// copy detects the type of the file from its first bytes and stops copying when the file exceeds the maximum
+// size of the type, it returns the hexadecimal SHA-256 of the copied content or an empty string when the
+// limits do not hash
+func (limits sizeLimits) copy(destination io.Writer, source io.Reader, filename string) (string, error) {
+	header := make([]byte, sniffLength)
+	read, err := io.ReadFull(source, header)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	header = header[:read]
+	detector := limits.detector
+
+	if detector == nil {
+		detector = NewFileTypeDetector()
 	}
 
-	ID := uuid.New().ID()
-	filePath := temporalFile.Name()
-	fileName := fmt.Sprintf("%v-%v.%v", time.Now().Format("20060102150405"), ID, fileExtension)
+	var maxSize int64
+	kind := ""
+
+	// the files of unknown types are rejected by the Uploader, meanwhile they can not exceed the largest limit
+	if fileType, err := detector.DetectHeader(header, filename); err == nil {
+		kind = *fileType
+		maxSize = limits.maxSize(kind)
+	} else {
+		for _, fileType := range detector.AllowedTypes {
+			if typeMaxSize := limits.maxSize(fileType); typeMaxSize > maxSize {
+				maxSize = typeMaxSize
+			}
+		}
+	}
 
-	item, err := uploader.Uploader.Upload(&filePath, &fileName)
+	var digest hash.Hash
+	content := io.MultiReader(bytes.NewReader(header), source)
+
+	if limits.hash {
+		digest = sha256.New()
+		content = io.TeeReader(content, digest)
+	}
+
+	// the types without a maximum size are not limited
+	if maxSize > 0 {
+		content = io.LimitReader(content, maxSize+1)
+	}
+
+	written, err := io.Copy(destination, content)
 
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	if maxSize > 0 && written > maxSize {
+		return "", TooLargeError{Filename: filename, Type: kind, MaxSize: maxSize}
+	}
+
+	if digest == nil {
+		return "", nil
+	}
+
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+func (limits sizeLimits) maxSize(fileType string) int64 {
+	if maxSize, ok := limits.maxSizes[fileType]; ok {
+		return maxSize
 	}
 
-	return item, nil
+	return DefaultMaxSizes[fileType]
 }
@@ -2,12 +2,16 @@ package service
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/alejo-lapix/multimedia-go/persistence"
@@ -17,33 +21,66 @@ import (
 
 var _, filePath, _, _ = runtime.Caller(1)
 
+func TestDefaultMaxRequestSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSizes map[string]int64
+		want     int64
+	}{
+		{name: "Allows the largest default size", want: DefaultMaxSizes[persistence.VIDEO] + MultipartOverhead},
+		{name: "Allows the largest overridden size", maxSizes: map[string]int64{persistence.VIDEO: 1 << 20, persistence.SOUND: 200 << 20}, want: 200<<20 + MultipartOverhead},
+		{name: "Allows the size of other types", maxSizes: map[string]int64{"model": 4 << 30}, want: 4<<30 + MultipartOverhead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultMaxRequestSize(tt.maxSizes); got != tt.want {
+				t.Errorf("DefaultMaxRequestSize() = %v, want %v", got, tt.want)
+			}
+			if got := (&HttpFileUploader{MaxSizes: tt.maxSizes}).maxRequestSize(); got != tt.want {
+				t.Errorf("maxRequestSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestHttpFileUploader_MoveFile(t *testing.T) {
 	type fields struct {
-		Uploader  Uploader
-		MaxUpload int64
+		Uploader       Uploader
+		MaxUpload      int64
+		MaxRequestSize int64
+		MaxSizes       map[string]int64
 	}
 	type args struct {
 		request *http.Request
 		key     string
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		wantErr bool
+		name         string
+		fields       fields
+		args         args
+		wantErr      bool
+		wantTooLarge bool
 	}{
-		/**
-		TODO Test with a really big file
 		{
-			name:   "If file is bigger that permitted",
-			fields: fields{MaxUpload: 0},
+			name:   "If the request is bigger that permitted returns a TooLargeError",
+			fields: fields{MaxUpload: 5, MaxRequestSize: 1024, Uploader: &SuccessUploader{}},
 			args: args{
 				request: newMultipartRequest("file", filePath),
 				key:     "file",
 			},
-			wantErr: true,
+			wantErr:      true,
+			wantTooLarge: true,
+		},
+		{
+			name:   "If the file is bigger that permitted for its type returns a TooLargeError",
+			fields: fields{MaxUpload: 5, MaxSizes: map[string]int64{persistence.IMAGE: 10}, Uploader: &SuccessUploader{}},
+			args: args{
+				request: newMultipartRequest("file", "testdata/image.png"),
+				key:     "file",
+			},
+			wantErr:      true,
+			wantTooLarge: true,
 		},
-		*/
 		{
 			name:   "If file key is empty returns an error",
 			fields: fields{MaxUpload: 5},
@@ -64,7 +101,7 @@ func TestHttpFileUploader_MoveFile(t *testing.T) {
 		},
 		{
 			name:   "Should return a MultimediaItem",
-			fields: fields{MaxUpload: 5, Uploader: &SuccessUploader{}},
+			fields: fields{MaxUpload: 5, MaxRequestSize: 10 << 20, Uploader: &SuccessUploader{}},
 			args: args{
 				request: newMultipartRequest("file", filePath),
 				key:     "file",
@@ -75,14 +112,19 @@ func TestHttpFileUploader_MoveFile(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uploader := &HttpFileUploader{
-				Uploader:      tt.fields.Uploader,
-				MaxMBUploaded: tt.fields.MaxUpload,
+				Uploader:       tt.fields.Uploader,
+				MaxMBUploaded:  tt.fields.MaxUpload,
+				MaxRequestSize: tt.fields.MaxRequestSize,
+				MaxSizes:       tt.fields.MaxSizes,
 			}
 			got, err := uploader.MoveFile(tt.args.request, &tt.args.key)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("MoveFile() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if _, ok := err.(TooLargeError); ok != tt.wantTooLarge {
+				t.Errorf("MoveFile() error = %#v, wantTooLarge %v", err, tt.wantTooLarge)
+			}
 			if !tt.wantErr && got == nil {
 				t.Errorf("MoveFile() returns nil")
 			}
@@ -180,6 +222,7 @@ func TestIOFileUploader_MoveFile(t *testing.T) {
 	thisFileReader, name, size := thisFileIOReader()
 	type fields struct {
 		Uploader Uploader
+		MaxSizes map[string]int64
 	}
 	type args struct {
 		ioReader io.Reader
@@ -205,24 +248,281 @@ func TestIOFileUploader_MoveFile(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Returns a TooLargeError if the file is bigger than the limit of its type",
+			fields: fields{
+				Uploader: &SuccessUploader{},
+				MaxSizes: map[string]int64{persistence.IMAGE: 10},
+			},
+			args: args{
+				ioReader: bytes.NewReader(append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)),
+				fileName: "image.png",
+				fileSize: 108,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uploader := &IOFileUploader{
 				Uploader: tt.fields.Uploader,
+				MaxSizes: tt.fields.MaxSizes,
 			}
 			got, err := uploader.MoveFile(tt.args.ioReader, tt.args.fileName, tt.args.fileSize)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("MoveFile() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got == nil {
+			if tooLarge, ok := err.(TooLargeError); tt.wantErr && (!ok || tooLarge.Type != persistence.IMAGE) {
+				t.Errorf("MoveFile() error = %#v, want a TooLargeError of an image", err)
+			}
+			if !tt.wantErr && got == nil {
 				t.Errorf("MoveFile() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestIOFileUploader_MoveFileContentHashKeys(t *testing.T) {
+	photo, err := ioutil.ReadFile("testdata/photo.jpg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &RecordingProvider{}
+	repository := persistence.NewMemoryRepository()
+	uploader := &IOFileUploader{
+		Uploader: &AWSUploader{
+			Bucket:        aws.String("any-bucket"),
+			Region:        aws.String("us-east-1"),
+			Repository:    repository,
+			Storage:       storage,
+			Deduplication: ReferenceDuplicates,
+		},
+		Keys: ContentHashKeys{},
+	}
+	item, err := uploader.MoveFile(bytes.NewReader(photo), "photo.jpg", int64(len(photo)))
+
+	if err != nil {
+		t.Fatalf("MoveFile() error = %v", err)
+	}
+
+	// the key and the hash are computed from the uploaded bytes, before the EXIF is removed
+	if *item.Filename != *item.Hash+".jpg" {
+		t.Errorf("MoveFile() filename = %v, want the hash %v of the item", *item.Filename, *item.Hash)
+	}
+
+	uploader.Uploader = &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &RecordingRepository{StoreErr: InternalServerError{}},
+		Storage:    storage,
+	}
+
+	if _, err = uploader.MoveFile(bytes.NewReader(photo), "copy.jpg", int64(len(photo))); err == nil {
+		t.Fatalf("MoveFile() expects the error of the repository")
+	}
+
+	if !storage.Objects[*item.Filename] {
+		t.Errorf("MoveFile() the failed upload must not remove the file of %v", *item.ID)
+	}
+}
+
+func TestSizeLimits_CopyHash(t *testing.T) {
+	content := []byte("\x89PNG\r\n\x1a\n")
+	tests := []struct {
+		name     string
+		uploader Uploader
+		keys     KeyStrategy
+		want     string
+	}{
+		{name: "Does not hash without deduplication", uploader: &AWSUploader{}},
+		{name: "Does not hash with other uploaders", uploader: &SuccessUploader{}},
+		{name: "Hashes with deduplication", uploader: &AWSUploader{Deduplication: ReturnDuplicates}, want: "4c4b6a3be1314ab86138bef4314dde022e600960d8689a2c8f8631802d20dab6"},
+		{name: "Hashes with content hash keys", uploader: &SuccessUploader{}, keys: ContentHashKeys{}, want: "4c4b6a3be1314ab86138bef4314dde022e600960d8689a2c8f8631802d20dab6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := sizeLimits{hash: hashes(tt.uploader, tt.keys)}
+			copied := &bytes.Buffer{}
+			got, err := limits.copy(copied, bytes.NewReader(content), "image.png")
+
+			if err != nil || got != tt.want {
+				t.Errorf("copy() got = %v, error = %v, want %v", got, err, tt.want)
+			}
+
+			if !bytes.Equal(copied.Bytes(), content) {
+				t.Errorf("copy() copied = %q, want %q", copied.Bytes(), content)
+			}
+		})
+	}
+}
+
+// ContentUploader fails the files with the content "fail" and records the uploaded and deleted items
+type ContentUploader struct {
+	mutex     sync.Mutex
+	Uploaded  int
+	Deleted   []string
+	DeleteErr error
+}
+
+func (uploader *ContentUploader) Upload(filename *string, destination *string) (*persistence.MultimediaItem, error) {
+	content, err := ioutil.ReadFile(*filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if string(content) == "fail" {
+		return nil, UploadFileError{}
+	}
+
+	uploader.mutex.Lock()
+	defer uploader.mutex.Unlock()
+
+	uploader.Uploaded++
+
+	return &persistence.MultimediaItem{ID: aws.String(string(content)), Filename: destination}, nil
+}
+
+func (uploader *ContentUploader) Delete(ID *string) error {
+	uploader.mutex.Lock()
+	defer uploader.mutex.Unlock()
+
+	if uploader.DeleteErr != nil {
+		return uploader.DeleteErr
+	}
+
+	uploader.Deleted = append(uploader.Deleted, *ID)
+
+	return nil
+}
+
+// newBatchRequest creates a multipart request with a file per content under the given keys
+func newBatchRequest(files map[string][]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for key, contents := range files {
+		for index, content := range contents {
+			part, _ := writer.CreateFormFile(key, fmt.Sprintf("%v-%v.png", key, index))
+			_, _ = io.WriteString(part, content)
+		}
+	}
+
+	_ = writer.WriteField("title", "Gallery")
+	_ = writer.Close()
+
+	request, _ := http.NewRequest("POST", "http://localhost:8080", body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	return request
+}
+
+func TestHttpFileUploader_MoveFiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string][]string
+		options      BatchOptions
+		deleteErr    error
+		wantIDs      []string
+		wantFailed   int
+		wantDeleted  int
+		wantErr      bool
+		wantRollback bool
+	}{
+		{
+			name:    "Uploads every file of the form sorted by key",
+			files:   map[string][]string{"photos": {"a", "b", "c"}, "cover": {"d"}},
+			wantIDs: []string{"d", "a", "b", "c"},
+		},
+		{
+			name:    "Uploads only the files of the given keys",
+			files:   map[string][]string{"photos": {"a", "b"}, "cover": {"d"}},
+			options: BatchOptions{Keys: []string{"photos"}, Workers: 1},
+			wantIDs: []string{"a", "b"},
+		},
+		{
+			name:       "Returns the error of every failed file",
+			files:      map[string][]string{"photos": {"a", "fail", "c", "fail"}},
+			wantIDs:    []string{"a", "", "c", ""},
+			wantFailed: 2,
+			wantErr:    true,
+		},
+		{
+			name:        "Deletes the uploaded files of an atomic batch",
+			files:       map[string][]string{"photos": {"a", "fail", "c"}},
+			options:     BatchOptions{Atomic: true, Workers: 2},
+			wantIDs:     []string{"a", "", "c"},
+			wantFailed:  1,
+			wantDeleted: 2,
+			wantErr:     true,
+		},
+		{
+			name:        "Deletes once the items returned for several files of an atomic batch",
+			files:       map[string][]string{"photos": {"a", "a", "fail"}},
+			options:     BatchOptions{Atomic: true, Workers: 1},
+			wantIDs:     []string{"a", "a", ""},
+			wantFailed:  1,
+			wantDeleted: 1,
+			wantErr:     true,
+		},
+		{
+			name:         "Returns a RollbackError when the items of an atomic batch can not be deleted",
+			files:        map[string][]string{"photos": {"a", "fail"}},
+			options:      BatchOptions{Atomic: true},
+			deleteErr:    UploadFileError{},
+			wantIDs:      []string{"a", ""},
+			wantFailed:   1,
+			wantErr:      true,
+			wantRollback: true,
+		},
+		{
+			name:    "Error if the form does not have files",
+			files:   map[string][]string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader := &ContentUploader{DeleteErr: tt.deleteErr}
+			httpUploader := &HttpFileUploader{Uploader: uploader, MaxMBUploaded: 5}
+			results, err := httpUploader.MoveFiles(newBatchRequest(tt.files), tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MoveFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, ok := err.(RollbackError); ok != tt.wantRollback {
+				t.Errorf("MoveFiles() error = %#v, wantRollback %v", err, tt.wantRollback)
+			}
+			if batchErr, ok := err.(BatchError); ok && batchErr.Failed != tt.wantFailed {
+				t.Errorf("MoveFiles() failed = %v, want %v", batchErr.Failed, tt.wantFailed)
+			}
+			var IDs []string
+			for _, result := range results {
+				if result.Item == nil {
+					IDs = append(IDs, "")
+					continue
+				}
+				IDs = append(IDs, *result.Item.ID)
+				if key := *result.Item.Filename; strings.Contains(key, "..") || !strings.HasSuffix(key, ".png") {
+					t.Errorf("MoveFiles() key = %v, want a single .png extension", key)
+				}
+				if result.RolledBack != (tt.wantDeleted > 0) {
+					t.Errorf("MoveFiles() %v RolledBack = %v", *result.Item.ID, result.RolledBack)
+				}
+			}
+			if !reflect.DeepEqual(IDs, tt.wantIDs) {
+				t.Errorf("MoveFiles() items = %v, want %v", IDs, tt.wantIDs)
+			}
+			if len(uploader.Deleted) != tt.wantDeleted {
+				t.Errorf("MoveFiles() deleted = %v, want %v items", uploader.Deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
 func thisFileIOReader() (file io.Reader, filename string, size int64) {
 	ioReader, err := os.Open(filePath)
 
@@ -238,3 +538,62 @@ func thisFileIOReader() (file io.Reader, filename string, size int64) {
 
 	return ioReader, "http_test.go", stats.Size()
 }
+
+func TestHttpFileUploader_MoveFilesDuplicates(t *testing.T) {
+	photo := string(mustReadFile(t, "testdata/image.png"))
+	tests := []struct {
+		name          string
+		stored        bool
+		wantDuplicate []bool
+		wantRecords   int
+	}{
+		{name: "Keeps the items stored before the batch", stored: true, wantDuplicate: []bool{true, true, false}, wantRecords: 1},
+		{name: "Deletes the items recorded by the batch", wantDuplicate: []bool{false, true, false}, wantRecords: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := persistence.NewMemoryRepository()
+			uploader := &AWSUploader{
+				Bucket:        aws.String("any-bucket"),
+				Region:        aws.String("us-east-1"),
+				Repository:    repository,
+				Storage:       &RecordingProvider{},
+				Deduplication: ReturnDuplicates,
+			}
+
+			if tt.stored {
+				if _, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("logo.png")); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+			}
+
+			httpUploader := &HttpFileUploader{Uploader: uploader, MaxMBUploaded: 5}
+			files := map[string][]string{"photos": {photo, photo, "%PDF-1.4 without objects"}}
+			results, err := httpUploader.MoveFiles(newBatchRequest(files), BatchOptions{Atomic: true, Workers: 1})
+
+			if _, ok := err.(BatchError); !ok {
+				t.Fatalf("MoveFiles() error = %#v, want a BatchError", err)
+			}
+
+			for index, result := range results {
+				if result.Duplicate != tt.wantDuplicate[index] {
+					t.Errorf("MoveFiles() file %v Duplicate = %v, want %v", index, result.Duplicate, tt.wantDuplicate[index])
+				}
+			}
+
+			if items, _ := repository.FindByHash(*results[0].Item.Hash); len(items) != tt.wantRecords {
+				t.Errorf("MoveFiles() records = %v, want %v", len(items), tt.wantRecords)
+			}
+		})
+	}
+}
+
+func mustReadFile(t *testing.T, filename string) []byte {
+	content, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
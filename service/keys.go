@@ -0,0 +1,260 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxNameLength limits the sanitized names and prefixes
+const maxNameLength = 100
+
+// UploadedFile is the local copy of an uploaded file
+type UploadedFile struct {
+	// Path is the local file
+	Path string
+	// Name is the name given by the client
+	Name string
+	// ContentType is detected from the first bytes of the file
+	ContentType string
+	// Hash is the hexadecimal SHA-256 of the file computed while it was received, empty when it is unknown
+	Hash string
+}
+
+// KeyStrategy names the stored object of an uploaded file
+type KeyStrategy interface {
+	Key(file *UploadedFile) (string, error)
+}
+
+// KeyStrategyFunc allows the use of ordinary functions as key strategies
+type KeyStrategyFunc func(file *UploadedFile) (string, error)
+
+// Key calls fn(file)
+func (fn KeyStrategyFunc) Key(file *UploadedFile) (string, error) {
+	return fn(file)
+}
+
+// extensions are the normalized extensions of the content types detected by http.DetectContentType
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"application/pdf": ".pdf",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"audio/aiff":      ".aiff",
+	"audio/midi":      ".mid",
+	"application/ogg": ".ogg",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/avi":       ".avi",
+}
+
+// Extension returns the extension of the detected content type, the lowercase extension of the name when the
+// content type is unknown or an empty string when the name does not have a valid extension
+func (file *UploadedFile) Extension() string {
+	contentType := strings.TrimSpace(strings.Split(file.ContentType, ";")[0])
+
+	if extension, ok := extensions[contentType]; ok {
+		return extension
+	}
+
+	extension := strings.ToLower(path.Ext(file.Name))
+
+	if len(extension) < 2 || len(extension) > 10 {
+		return ""
+	}
+
+	for _, character := range extension[1:] {
+		if (character < 'a' || character > 'z') && (character < '0' || character > '9') {
+			return ""
+		}
+	}
+
+	if extension == ".jpeg" {
+		return ".jpg"
+	}
+
+	return extension
+}
+
+// newUploadedFile detects the content type of the local copy of an uploaded file
+func newUploadedFile(filename, name, hash string) (*UploadedFile, error) {
+	header, err := readHeader(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadedFile{Path: filename, Name: name, ContentType: http.DetectContentType(header), Hash: hash}, nil
+}
+
+// DefaultKeyStrategy names the files with the upload time and a random ID, e.g. 20190817103000-3412.jpg
+var DefaultKeyStrategy KeyStrategy = TimestampKeys{}
+
+// TimestampKeys names the files with the upload time and a random ID
+type TimestampKeys struct{}
+
+func (strategy TimestampKeys) Key(file *UploadedFile) (string, error) {
+	return fmt.Sprintf("%v-%v%v", time.Now().Format("20060102150405"), uuid.New().ID(), file.Extension()), nil
+}
+
+// DatePartitionedKeys prefixes the keys of the strategy with the upload date, e.g. 2019/08/17/name.jpg
+type DatePartitionedKeys struct {
+	// Keys names the files inside the date prefix, DefaultKeyStrategy when nil
+	Keys KeyStrategy
+}
+
+func (strategy DatePartitionedKeys) Key(file *UploadedFile) (string, error) {
+	key, err := keyOrDefault(strategy.Keys, file)
+
+	if err != nil {
+		return "", err
+	}
+
+	return time.Now().Format("2006/01/02/") + key, nil
+}
+
+// ContentHashKeys names the files with the SHA-256 of their content so the same content has the same key,
+// it is the Hash of the items recorded with deduplication. The images are hashed before their EXIF is removed
+type ContentHashKeys struct{}
+
+func (strategy ContentHashKeys) Key(file *UploadedFile) (string, error) {
+	hash := file.Hash
+
+	if hash == "" {
+		var err error
+
+		if hash, err = fileHash(file.Path); err != nil {
+			return "", err
+		}
+	}
+
+	return hash + file.Extension(), nil
+}
+
+// contentKey reports if the key was named by ContentHashKeys, its name without the extension is a SHA-256
+func contentKey(key string) bool {
+	name := path.Base(key)
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+
+	_, err := hex.DecodeString(name)
+
+	return err == nil
+}
+
+// PrefixKeys prefixes the keys of the strategy with a tenant or owner, every segment of the prefix is sanitized
+type PrefixKeys struct {
+	Prefix string
+	// Keys names the files inside the prefix, DefaultKeyStrategy when nil
+	Keys KeyStrategy
+}
+
+func (strategy PrefixKeys) Key(file *UploadedFile) (string, error) {
+	var segments []string
+
+	for _, segment := range strings.Split(strategy.Prefix, "/") {
+		if segment = sanitizeName(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	if len(segments) == 0 {
+		return "", InvalidArgumentError{Message: fmt.Sprintf("The prefix %q does not have valid segments", strategy.Prefix)}
+	}
+
+	key, err := keyOrDefault(strategy.Keys, file)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(segments, "/") + "/" + key, nil
+}
+
+// OriginalNameKeys keeps the sanitized name given by the client followed by a random ID to avoid
+// overwriting the files with the same name, e.g. Holiday-photo-3412.jpg
+type OriginalNameKeys struct{}
+
+func (strategy OriginalNameKeys) Key(file *UploadedFile) (string, error) {
+	name := sanitizeName(strings.TrimSuffix(path.Base(file.Name), path.Ext(file.Name)))
+
+	if name == "" {
+		name = "file"
+	}
+
+	return fmt.Sprintf("%v-%v%v", name, uuid.New().ID(), file.Extension()), nil
+}
+
+func keyOrDefault(strategy KeyStrategy, file *UploadedFile) (string, error) {
+	if strategy == nil {
+		strategy = DefaultKeyStrategy
+	}
+
+	return strategy.Key(file)
+}
+
+// sanitizeName replaces the characters that are not ASCII letters, digits, dots, dashes or underscores
+// with dashes and trims the dots and dashes, so the names can not traverse paths
+func sanitizeName(name string) string {
+	sanitized := strings.Builder{}
+	dash := false
+
+	for _, character := range name {
+		valid := character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' ||
+			character >= '0' && character <= '9' || character == '.' || character == '_' || character == '-'
+
+		if !valid {
+			if !dash {
+				sanitized.WriteByte('-')
+			}
+
+			dash = true
+			continue
+		}
+
+		sanitized.WriteRune(character)
+		dash = character == '-'
+	}
+
+	result := strings.Trim(sanitized.String(), ".-")
+
+	if len(result) > maxNameLength {
+		result = strings.Trim(result[:maxNameLength], ".-")
+	}
+
+	return result
+}
+
+// fileHash returns the hexadecimal SHA-256 of the file
+func fileHash(filename string) (string, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestUploadedFile_Extension(t *testing.T) {
+	tests := []struct {
+		name string
+		file UploadedFile
+		want string
+	}{
+		{name: "Uses the detected content type", file: UploadedFile{Name: "photo.JPEG.exe", ContentType: "image/jpeg"}, want: ".jpg"},
+		{name: "Ignores the content type parameters", file: UploadedFile{Name: "song", ContentType: "audio/mpeg; codecs=mp3"}, want: ".mp3"},
+		{name: "Lowercases the extension of unknown types", file: UploadedFile{Name: "song.FLAC", ContentType: "application/octet-stream"}, want: ".flac"},
+		{name: "Normalizes the JPEG extension", file: UploadedFile{Name: "photo.jpeg", ContentType: "text/plain"}, want: ".jpg"},
+		{name: "Drops invalid extensions", file: UploadedFile{Name: "archive.tar/../x", ContentType: "text/plain"}, want: ""},
+		{name: "Drops missing extensions", file: UploadedFile{Name: "README", ContentType: "text/plain"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.file.Extension(); got != tt.want {
+				t.Errorf("Extension() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyStrategy_Key(t *testing.T) {
+	root, err := ioutil.TempDir("", "keys")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	filename := filepath.Join(root, "upload-1.png")
+	_ = ioutil.WriteFile(filename, []byte("\x89PNG\r\n\x1a\ncontent"), 0644)
+	file, err := newUploadedFile(filename, "../Holiday photo (1).PNG", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Now().Format("2006/01/02")
+	tests := []struct {
+		name     string
+		strategy KeyStrategy
+		want     string
+		wantErr  bool
+	}{
+		{name: "Names with the upload time", strategy: TimestampKeys{}, want: `^\d{14}-\d+\.png$`},
+		{name: "Partitions by date", strategy: DatePartitionedKeys{}, want: `^` + date + `/\d{14}-\d+\.png$`},
+		{name: "Names with the content hash", strategy: ContentHashKeys{}, want: `^[0-9a-f]{64}\.png$`},
+		{name: "Keeps the sanitized original name", strategy: OriginalNameKeys{}, want: `^Holiday-photo-1-\d+\.png$`},
+		{
+			name:     "Prefixes with the sanitized tenant",
+			strategy: PrefixKeys{Prefix: "/tenants/../acme corp/", Keys: OriginalNameKeys{}},
+			want:     `^tenants/acme-corp/Holiday-photo-1-\d+\.png$`,
+		},
+		{
+			name:     "Combines prefixes and partitions",
+			strategy: PrefixKeys{Prefix: "owner-7", Keys: DatePartitionedKeys{Keys: ContentHashKeys{}}},
+			want:     `^owner-7/` + date + `/[0-9a-f]{64}\.png$`,
+		},
+		{name: "Error if the prefix does not have valid segments", strategy: PrefixKeys{Prefix: "/../"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Key(file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Key() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("Key() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentHashKeys_Key(t *testing.T) {
+	root, err := ioutil.TempDir("", "keys")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	var keys []string
+
+	for index, content := range []string{"same", "same", "other"} {
+		filename := filepath.Join(root, string(rune('a'+index)))
+		_ = ioutil.WriteFile(filename, []byte(content), 0644)
+		key, err := ContentHashKeys{}.Key(&UploadedFile{Path: filename, Name: "notes.txt"})
+
+		if err != nil {
+			t.Fatalf("Key() error = %v", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if keys[0] != keys[1] || keys[0] == keys[2] {
+		t.Errorf("Key() = %v, want the same key for the same content", keys)
+	}
+
+	if key, err := (ContentHashKeys{}).Key(&UploadedFile{Path: "missing", Name: "notes.txt", Hash: "abc"}); err != nil || key != "abc.txt" {
+		t.Errorf("Key() = %v, %v, want the hash computed while the file was received", key, err)
+	}
+}
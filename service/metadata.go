@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/alejo-lapix/multimedia-go/metadata"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+)
+
+// MetadataExtractor fills the metadata of an item reading its local file
+type MetadataExtractor interface {
+	Extract(filename *string, item *persistence.MultimediaItem) error
+}
+
+// defaultExtractors are used for the types without an extractor in AWSUploader.Extractors
+var defaultExtractors = map[string]MetadataExtractor{
+	persistence.VIDEO: &VideoExtractor{},
+	persistence.IMAGE: &ImageExtractor{},
+	persistence.PDF:   &PDFExtractor{},
+	persistence.SOUND: &AudioExtractor{},
+}
+
+// InvalidDocumentError is returned when a PDF document is malformed or protected by a password
+type InvalidDocumentError struct {
+	Filename string
+	Message  string
+	// PasswordProtected reports if the document can not be opened without a password
+	PasswordProtected bool
+}
+
+func (err InvalidDocumentError) Error() string {
+	return fmt.Sprintf("The document %v is not valid: %v", err.Filename, err.Message)
+}
+
+type VideoExtractor struct{}
+
+// Extract parses the container headers of a MP4 or WebM video, the videos in other containers e.g. AVI or with
+// unreadable headers are stored without metadata
+func (extractor *VideoExtractor) Extract(filename *string, item *persistence.MultimediaItem) error {
+	file, err := os.Open(*filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	video, err := metadata.ParseVideo(file)
+
+	switch err.(type) {
+	case nil:
+		item.Video = video
+
+		return nil
+	case metadata.InvalidFormatError:
+		return nil
+	}
+
+	return err
+}
+
+type ImageExtractor struct{}
+
+// Extract reads the size, the color model and the EXIF orientation of the image, the images in formats that
+// can not be decoded e.g. BMP, TIFF, HEIC or AVIF are stored without metadata
+func (extractor *ImageExtractor) Extract(filename *string, item *persistence.MultimediaItem) error {
+	file, err := os.Open(*filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	image, err := metadata.ParseImage(file)
+
+	switch err.(type) {
+	case nil:
+		item.Image = image
+
+		return nil
+	case metadata.InvalidFormatError:
+		return nil
+	}
+
+	return err
+}
+
+type PDFExtractor struct{}
+
+// Extract reads the page count, the title, the author and the encryption of the document, the malformed
+// and password-protected documents return an InvalidDocumentError
+func (extractor *PDFExtractor) Extract(filename *string, item *persistence.MultimediaItem) error {
+	file, err := os.Open(*filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	document, err := metadata.ParsePDF(file)
+
+	switch err.(type) {
+	case nil:
+		item.Document = document
+
+		return nil
+	case metadata.InvalidFormatError:
+		return InvalidDocumentError{Filename: *item.Filename, Message: err.Error()}
+	case metadata.PasswordProtectedError:
+		return InvalidDocumentError{Filename: *item.Filename, Message: err.Error(), PasswordProtected: true}
+	}
+
+	return err
+}
+
+type AudioExtractor struct{}
+
+// Extract reads the duration, the bitrate, the sample rate, the channels and the tags of MP3, Ogg, WAV and
+// FLAC files, the sounds in other formats or with unreadable headers are stored without metadata
+func (extractor *AudioExtractor) Extract(filename *string, item *persistence.MultimediaItem) error {
+	file, err := os.Open(*filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	audio, _, err := metadata.ParseAudio(file)
+
+	switch err.(type) {
+	case nil:
+		item.Audio = audio
+
+		return nil
+	case metadata.InvalidFormatError:
+		return nil
+	}
+
+	return err
+}
+
+// stripEXIF writes a copy of the image without its EXIF to a temporary file and returns its path, the
+// original content is written to hash as well. The caller must remove the temporary file
+func stripEXIF(filename *string, hash io.Writer) (*string, error) {
+	file, err := os.Open(*filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	stripped, err := ioutil.TempFile("", "multimedia-*"+filepath.Ext(*filename))
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := stripped.Name()
+	err = metadata.StripEXIF(io.TeeReader(file, hash), stripped)
+
+	if closeErr := stripped.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(name)
+
+		return nil, err
+	}
+
+	return &name, nil
+}
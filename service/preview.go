@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRenderTimeout bounds the time the command takes to render a page
+const DefaultRenderTimeout = 30 * time.Second
+
+// DefaultPreviews is a 800px copy of the first page of the PDF documents
+var DefaultPreviews = []RenditionSpec{
+	{Name: "preview", MaxWidth: 800, MaxHeight: 800},
+}
+
+// PageRenderer rasterizes the first page of a PDF document, the standard library can not render PDF
+// files so the implementations usually call an external tool
+type PageRenderer interface {
+	RenderFirstPage(filename string) (image.Image, error)
+}
+
+// CommandPageRenderer renders the first page with the pdftoppm command of Poppler
+type CommandPageRenderer struct {
+	// Command is "pdftoppm" when empty
+	Command string
+	// Resolution in DPI, 72 when zero
+	Resolution int
+	// Timeout stops the command, DefaultRenderTimeout when zero
+	Timeout time.Duration
+	// MaxPixels is the largest width * height of the rendered page decoded, DefaultMaxPixels when zero
+	MaxPixels int
+}
+
+func NewCommandPageRenderer() *CommandPageRenderer {
+	return &CommandPageRenderer{Command: "pdftoppm", Resolution: 72}
+}
+
+// RenderFirstPage runs the command with the PNG output written to the standard output, the command is killed
+// after the Timeout and the pages larger than MaxPixels return an ImageTooLargeError
+func (renderer *CommandPageRenderer) RenderFirstPage(filename string) (image.Image, error) {
+	// an absolute path can not be confused with an option of the command
+	path, err := filepath.Abs(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := durationOrDefault(renderer.Timeout, DefaultRenderTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, errors := &bytes.Buffer{}, &bytes.Buffer{}
+	command := exec.CommandContext(ctx, renderer.command(), "-f", "1", "-l", "1", "-r", strconv.Itoa(renderer.resolution()), "-png", "-singlefile", path, "-")
+	command.Stdout = output
+	command.Stderr = errors
+
+	if err = command.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("The first page of %v was not rendered in %v", filename, timeout)
+		}
+
+		return nil, fmt.Errorf("%v: %v", err, strings.TrimSpace(errors.String()))
+	}
+
+	config, err := png.DecodeConfig(bytes.NewReader(output.Bytes()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if maxPixels := renderer.maxPixels(); config.Width*config.Height > maxPixels {
+		return nil, ImageTooLargeError{Width: config.Width, Height: config.Height, MaxPixels: maxPixels}
+	}
+
+	return png.Decode(output)
+}
+
+func (renderer *CommandPageRenderer) maxPixels() int {
+	if renderer.MaxPixels <= 0 {
+		return DefaultMaxPixels
+	}
+
+	return renderer.MaxPixels
+}
+
+func (renderer *CommandPageRenderer) command() string {
+	if renderer.Command == "" {
+		return "pdftoppm"
+	}
+
+	return renderer.Command
+}
+
+func (renderer *CommandPageRenderer) resolution() int {
+	if renderer.Resolution <= 0 {
+		return 72
+	}
+
+	return renderer.Resolution
+}
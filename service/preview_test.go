@@ -0,0 +1,92 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCommandPageRenderer_RenderFirstPage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake command is a shell script")
+	}
+
+	root, err := ioutil.TempDir("", "renderer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	image, err := filepath.Abs("testdata/image.png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake command writes a PNG image to the standard output like pdftoppm
+	fake := filepath.Join(root, "pdftoppm")
+	script := "#!/bin/sh\ncase \"$*\" in *\"-singlefile /\"*\" -\") cat \"" + image + "\";; *) echo \"bad arguments $*\" >&2; exit 1;; esac\n"
+
+	if err = ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := (&CommandPageRenderer{Command: fake}).RenderFirstPage("testdata/document.pdf")
+
+	if err != nil {
+		t.Fatalf("RenderFirstPage() error = %v", err)
+	}
+
+	if bounds := page.Bounds(); bounds.Dx() != 4 || bounds.Dy() != 3 {
+		t.Errorf("RenderFirstPage() bounds = %v, want 4x3", bounds)
+	}
+
+	if _, err = (&CommandPageRenderer{Command: filepath.Join(root, "missing")}).RenderFirstPage("testdata/document.pdf"); err == nil {
+		t.Errorf("RenderFirstPage() expects an error when the command does not exist")
+	}
+
+	if _, err = (&CommandPageRenderer{Command: fake, MaxPixels: 11}).RenderFirstPage("testdata/document.pdf"); err == nil {
+		t.Errorf("RenderFirstPage() expects an error for pages larger than MaxPixels")
+	} else if _, ok := err.(ImageTooLargeError); !ok {
+		t.Errorf("RenderFirstPage() error = %v, want ImageTooLargeError", err)
+	}
+
+	slow := filepath.Join(root, "slow")
+
+	if err = ioutil.WriteFile(slow, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+
+	if _, err = (&CommandPageRenderer{Command: slow, Timeout: 50 * time.Millisecond}).RenderFirstPage("testdata/document.pdf"); err == nil {
+		t.Errorf("RenderFirstPage() expects an error when the command exceeds the timeout")
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("RenderFirstPage() took %v, want the command stopped after the timeout", elapsed)
+	}
+}
+
+func TestCommandPageRenderer_Pdftoppm(t *testing.T) {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		t.Skip("pdftoppm is not installed")
+	}
+
+	page, err := NewCommandPageRenderer().RenderFirstPage("testdata/document.pdf")
+
+	if err != nil {
+		t.Fatalf("RenderFirstPage() error = %v", err)
+	}
+
+	// a letter page at 72 DPI
+	if bounds := page.Bounds(); bounds.Dx() != 612 || bounds.Dy() != 792 {
+		t.Errorf("RenderFirstPage() bounds = %v, want 612x792", bounds)
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/imaging"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// RenditionSpec configures a resized copy of the IMAGE items
+type RenditionSpec struct {
+	// Name is appended to the key of the original file e.g. "thumbnail"
+	Name string
+	// MaxWidth and MaxHeight bound the size of the rendition, zero does not limit the dimension
+	MaxWidth  int
+	MaxHeight int
+	// Format is imaging.JPEG, imaging.PNG or a format registered with imaging.RegisterEncoder, JPEG when empty.
+	// The transparent images are composited onto white in JPEG renditions
+	Format string
+}
+
+// DefaultMaxPixels bounds the images decoded to generate renditions, 50 megapixels need 200MB once decoded
+const DefaultMaxPixels = 50 * 1000 * 1000
+
+// DefaultRenditions are a 200px thumbnail and a 800px medium copy
+var DefaultRenditions = []RenditionSpec{
+	{Name: "thumbnail", MaxWidth: 200, MaxHeight: 200},
+	{Name: "medium", MaxWidth: 800, MaxHeight: 800},
+}
+
+// DefaultCovers is a 500px copy of the album art embedded in the sounds
+var DefaultCovers = []RenditionSpec{
+	{Name: "cover", MaxWidth: 500, MaxHeight: 500},
+}
+
+// RenditionGenerator stores resized copies of the images next to the original files
+type RenditionGenerator struct {
+	Specs   []RenditionSpec
+	Storage files.Provider
+	// MaxPixels is the largest width * height decoded, DefaultMaxPixels when zero
+	MaxPixels int
+}
+
+// ImageTooLargeError is returned when the dimensions of an image exceed the pixels that can be decoded
+type ImageTooLargeError struct {
+	Width     int
+	Height    int
+	MaxPixels int
+}
+
+func (err ImageTooLargeError) Error() string {
+	return fmt.Sprintf("The image of %vx%v pixels exceeds the limit of %v pixels", err.Width, err.Height, err.MaxPixels)
+}
+
+// NewRenditionGenerator returns a generator of the specs, DefaultRenditions when there are none. The specs
+// in formats without a registered encoder return an imaging.UnsupportedFormatError
+func NewRenditionGenerator(storage files.Provider, specs ...RenditionSpec) (*RenditionGenerator, error) {
+	if len(specs) == 0 {
+		specs = DefaultRenditions
+	}
+
+	for _, spec := range specs {
+		if _, err := imaging.EncoderFor(specFormat(spec)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RenditionGenerator{Specs: specs, Storage: storage}, nil
+}
+
+// Generate stores the renditions of the image and records them in the item, the stored renditions are
+// removed when one of them fails. The image is rotated by the EXIF orientation of the item first
+func (generator *RenditionGenerator) Generate(source image.Image, item *persistence.MultimediaItem, options *files.StoreOptions) error {
+	renditions, err := generator.render(upright(source, item), *item.Filename, options, nil)
+
+	if err != nil {
+		return err
+	}
+
+	item.Renditions = renditions
+
+	return nil
+}
+
+// Regenerate reads the original file of the item and replaces its renditions with the ones of the
+// current specs, the renditions that are not in the specs anymore are removed
+func (generator *RenditionGenerator) Regenerate(item *persistence.MultimediaItem, options *files.StoreOptions) error {
+	body, _, err := generator.Storage.ReadStream(item.Filename)
+
+	if err != nil {
+		return err
+	}
+
+	source, err := generator.decode(body)
+	body.Close()
+
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[string]bool, len(item.Renditions))
+
+	for _, rendition := range item.Renditions {
+		previous[rendition.Key] = true
+	}
+
+	renditions, err := generator.render(upright(source, item), *item.Filename, options, previous)
+
+	if err != nil {
+		return err
+	}
+
+	for _, rendition := range renditions {
+		delete(previous, rendition.Key)
+	}
+
+	for key := range previous {
+		if err = generator.Storage.Remove(aws.String(key)); err != nil {
+			return err
+		}
+	}
+
+	item.Renditions = renditions
+
+	return nil
+}
+
+// Remove removes the stored renditions of the item
+func (generator *RenditionGenerator) Remove(item *persistence.MultimediaItem) error {
+	return removeRenditions(generator.Storage, item.Renditions)
+}
+
+// upright rotates the image by the EXIF orientation of the item, the items without image metadata are not rotated
+func upright(source image.Image, item *persistence.MultimediaItem) image.Image {
+	if item.Image == nil {
+		return source
+	}
+
+	return imaging.Orient(source, item.Image.Orientation)
+}
+
+// render stores a rendition per spec, on failure it removes the stored renditions that are not kept
+func (generator *RenditionGenerator) render(img image.Image, original string, options *files.StoreOptions, keep map[string]bool) ([]persistence.Rendition, error) {
+	// the source is converted once instead of once per spec
+	source := imaging.ToRGBA(img)
+	bounds := source.Bounds()
+	renditions := make([]persistence.Rendition, 0, len(generator.Specs))
+
+	for _, spec := range generator.Specs {
+		rendition, err := generator.renderSpec(source, bounds, original, spec, options)
+
+		if err != nil {
+			var stored []persistence.Rendition
+
+			for _, rendition := range renditions {
+				if !keep[rendition.Key] {
+					stored = append(stored, rendition)
+				}
+			}
+
+			_ = removeRenditions(generator.Storage, stored)
+
+			return nil, err
+		}
+
+		renditions = append(renditions, *rendition)
+	}
+
+	return renditions, nil
+}
+
+// decode checks the dimensions declared by the image before decoding it, the larger images return an
+// ImageTooLargeError
+func (generator *RenditionGenerator) decode(reader io.Reader) (image.Image, error) {
+	header := &bytes.Buffer{}
+	config, _, err := image.DecodeConfig(io.TeeReader(reader, header))
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxPixels := generator.MaxPixels
+
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ImageTooLargeError{Width: config.Width, Height: config.Height, MaxPixels: maxPixels}
+	}
+
+	source, _, err := image.Decode(io.MultiReader(header, reader))
+
+	return source, err
+}
+
+func specFormat(spec RenditionSpec) string {
+	if spec.Format == "" {
+		return imaging.JPEG
+	}
+
+	return spec.Format
+}
+
+func (generator *RenditionGenerator) renderSpec(source image.Image, bounds image.Rectangle, original string, spec RenditionSpec, options *files.StoreOptions) (*persistence.Rendition, error) {
+	encoder, err := imaging.EncoderFor(specFormat(spec))
+
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := imaging.Fit(bounds.Dx(), bounds.Dy(), spec.MaxWidth, spec.MaxHeight)
+	buffer := &bytes.Buffer{}
+
+	if err = encoder.Encode(buffer, imaging.Resize(source, width, height)); err != nil {
+		return nil, err
+	}
+
+	key := renditionKey(original, spec.Name, encoder.Extension())
+
+	if err = generator.Storage.StoreStream(bytes.NewReader(buffer.Bytes()), aws.String(key), options); err != nil {
+		return nil, err
+	}
+
+	return &persistence.Rendition{
+		Name:        spec.Name,
+		Key:         key,
+		Width:       width,
+		Height:      height,
+		ContentType: encoder.ContentType(),
+	}, nil
+}
+
+// renditionKey returns the key of a rendition next to the original e.g. "2019/logo_thumbnail.jpg"
+func renditionKey(original, name, extension string) string {
+	return strings.TrimSuffix(original, path.Ext(original)) + "_" + name + extension
+}
+
+func removeRenditions(storage files.Provider, renditions []persistence.Rendition) error {
+	for _, rendition := range renditions {
+		if err := storage.Remove(aws.String(rendition.Key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
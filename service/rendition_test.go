@@ -0,0 +1,285 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/imaging"
+	"github.com/alejo-lapix/multimedia-go/persistence"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func newTestImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 200, G: 100, B: 50, A: 255}}, image.Point{}, draw.Src)
+
+	return img
+}
+
+// writeTestImage writes a PNG image to the directory and returns its path
+func writeTestImage(t *testing.T, directory string, width, height int) string {
+	filename := filepath.Join(directory, "original.png")
+	file, err := os.Create(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	if err = png.Encode(file, newTestImage(width, height)); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func exists(t *testing.T, storage files.Provider, key string) bool {
+	body, _, err := storage.ReadStream(aws.String(key))
+
+	if err != nil {
+		if !files.IsNotFound(err) {
+			t.Fatalf("ReadStream(%v) error = %v", key, err)
+		}
+
+		return false
+	}
+
+	body.Close()
+
+	return true
+}
+
+func newGenerator(t *testing.T, storage files.Provider, specs ...RenditionSpec) *RenditionGenerator {
+	generator, err := NewRenditionGenerator(storage, specs...)
+
+	if err != nil {
+		t.Fatalf("NewRenditionGenerator() error = %v", err)
+	}
+
+	return generator
+}
+
+func TestNewRenditionGenerator(t *testing.T) {
+	if _, err := NewRenditionGenerator(&SuccessProvider{}, RenditionSpec{Name: "webp", Format: "webp"}); err == nil {
+		t.Errorf("NewRenditionGenerator() expects an error for WebP specs without a WebP encoder")
+	} else if _, ok := err.(imaging.UnsupportedFormatError); !ok {
+		t.Errorf("NewRenditionGenerator() error = %v, want imaging.UnsupportedFormatError", err)
+	}
+
+	generator, err := NewRenditionGenerator(&SuccessProvider{})
+
+	if err != nil || len(generator.Specs) != len(DefaultRenditions) {
+		t.Errorf("NewRenditionGenerator() = %v, %v, want the DefaultRenditions", generator, err)
+	}
+}
+
+func TestRenditionGenerator_Generate(t *testing.T) {
+	root, err := ioutil.TempDir("", "renditions")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	storage := files.NewLocalProvider(root)
+	item := &persistence.MultimediaItem{Filename: aws.String("2019/logo.png")}
+	generator := newGenerator(t, storage, append(DefaultRenditions, RenditionSpec{Name: "small", MaxWidth: 50, Format: imaging.PNG})...)
+
+	if err = generator.Generate(newTestImage(1000, 500), item, nil); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	want := []persistence.Rendition{
+		{Name: "thumbnail", Key: "2019/logo_thumbnail.jpg", Width: 200, Height: 100, ContentType: "image/jpeg"},
+		{Name: "medium", Key: "2019/logo_medium.jpg", Width: 800, Height: 400, ContentType: "image/jpeg"},
+		{Name: "small", Key: "2019/logo_small.png", Width: 50, Height: 25, ContentType: "image/png"},
+	}
+
+	if !reflect.DeepEqual(item.Renditions, want) {
+		t.Fatalf("Generate() renditions = %+v, want %+v", item.Renditions, want)
+	}
+
+	for _, rendition := range want {
+		body, _, err := storage.ReadStream(aws.String(rendition.Key))
+
+		if err != nil {
+			t.Fatalf("ReadStream(%v) error = %v", rendition.Key, err)
+		}
+
+		config, _, err := image.DecodeConfig(body)
+		body.Close()
+
+		if err != nil || config.Width != rendition.Width || config.Height != rendition.Height {
+			t.Errorf("Generate() stored %v as %vx%v, error = %v, want %vx%v", rendition.Key, config.Width, config.Height, err, rendition.Width, rendition.Height)
+		}
+	}
+
+	if err = generator.Remove(item); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	for _, rendition := range want {
+		if exists(t, storage, rendition.Key) {
+			t.Errorf("Remove() must remove %v", rendition.Key)
+		}
+	}
+}
+
+func TestRenditionGenerator_GenerateCleanup(t *testing.T) {
+	storage := &RecordingProvider{}
+	item := &persistence.MultimediaItem{Filename: aws.String("logo.png")}
+	generator := &RenditionGenerator{Storage: storage, Specs: []RenditionSpec{{Name: "thumbnail", MaxWidth: 20}, {Name: "webp", MaxWidth: 20, Format: "webp"}}}
+	err := generator.Generate(newTestImage(40, 40), item, nil)
+
+	if _, ok := err.(imaging.UnsupportedFormatError); !ok {
+		t.Fatalf("Generate() error = %v, want imaging.UnsupportedFormatError without a WebP encoder", err)
+	}
+
+	if storage.Objects["logo_thumbnail.jpg"] || item.Renditions != nil {
+		t.Errorf("Generate() must remove the stored renditions on failure, objects = %v", storage.Objects)
+	}
+}
+
+func TestAWSUploader_UploadRenditions(t *testing.T) {
+	root, err := ioutil.TempDir("", "renditions")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	storage := files.NewLocalProvider(filepath.Join(root, "storage"))
+	repository := persistence.NewMemoryRepository()
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: repository,
+		Storage:    storage,
+		Renditions: newGenerator(t, storage),
+	}
+	item, err := uploader.Upload(aws.String(writeTestImage(t, root, 1600, 1200)), aws.String("photo.png"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	if len(item.Renditions) != 2 || item.Renditions[0].Width != 200 || item.Renditions[1].Height != 600 {
+		t.Fatalf("Upload() renditions = %+v, want a thumbnail and a medium copy", item.Renditions)
+	}
+
+	if stored, _ := repository.Find(item.ID); stored == nil || !reflect.DeepEqual(stored.Renditions, item.Renditions) {
+		t.Errorf("Upload() must store the renditions in the repository, got %+v", stored)
+	}
+
+	uploader.Renditions = newGenerator(t, storage, RenditionSpec{Name: "square", MaxWidth: 100, MaxHeight: 100, Format: imaging.PNG})
+	regenerated, err := uploader.RegenerateRenditions(item.ID)
+
+	if err != nil {
+		t.Fatalf("RegenerateRenditions() error = %v", err)
+	}
+
+	want := []persistence.Rendition{{Name: "square", Key: "photo_square.png", Width: 100, Height: 75, ContentType: "image/png"}}
+
+	if stored, _ := repository.Find(item.ID); !reflect.DeepEqual(regenerated.Renditions, want) || !reflect.DeepEqual(stored.Renditions, want) {
+		t.Errorf("RegenerateRenditions() renditions = %+v, stored %+v, want %+v", regenerated.Renditions, stored.Renditions, want)
+	}
+
+	if exists(t, storage, "photo_thumbnail.jpg") || exists(t, storage, "photo_medium.jpg") || !exists(t, storage, "photo_square.png") {
+		t.Errorf("RegenerateRenditions() must replace the previous renditions")
+	}
+
+	if err = uploader.Delete(item.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if exists(t, storage, "photo.png") || exists(t, storage, "photo_square.png") {
+		t.Errorf("Delete() must remove the original file and its renditions")
+	}
+}
+
+func TestRenditionGenerator_MaxPixels(t *testing.T) {
+	root, err := ioutil.TempDir("", "renditions")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	storage := &RecordingProvider{}
+	generator := newGenerator(t, storage)
+	generator.MaxPixels = 100 * 99
+	filename := writeTestImage(t, root, 100, 100)
+	file, err := os.Open(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	if _, err = generator.decode(file); err != (ImageTooLargeError{Width: 100, Height: 100, MaxPixels: 100 * 99}) {
+		t.Errorf("decode() error = %v, want ImageTooLargeError", err)
+	}
+
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &SuccessRepository{},
+		Storage:    storage,
+		Renditions: generator,
+	}
+	item, err := uploader.Upload(aws.String(filename), aws.String("photo.png"))
+
+	if err != nil || len(item.Renditions) != 0 {
+		t.Errorf("Upload() = %+v, %v, want the image stored without renditions", item, err)
+	}
+}
+
+func TestAWSUploader_RegenerateRenditions(t *testing.T) {
+	repository := persistence.NewMemoryRepository()
+	document := &persistence.MultimediaItem{
+		Bucket:    aws.String("any-bucket"),
+		Filename:  aws.String("document.pdf"),
+		Type:      aws.String(persistence.PDF),
+		CreatedAt: aws.String("2019-01-01T00:00:00Z"),
+	}
+
+	if err := repository.Store(document); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		repository persistence.BasicRepository
+		renditions *RenditionGenerator
+		ID         *string
+	}{
+		{name: "without generator", repository: repository, ID: document.ID},
+		{name: "not updatable", repository: &SuccessRepository{}, renditions: newGenerator(t, &SuccessProvider{}), ID: aws.String("any")},
+		{name: "missing item", repository: repository, renditions: newGenerator(t, &SuccessProvider{}), ID: aws.String("missing")},
+		{name: "not an image", repository: repository, renditions: newGenerator(t, &SuccessProvider{}), ID: document.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader := &AWSUploader{Repository: tt.repository, Storage: &SuccessProvider{}, Renditions: tt.renditions}
+
+			if _, err := uploader.RegenerateRenditions(tt.ID); err == nil {
+				t.Errorf("RegenerateRenditions() expects an error")
+			}
+		})
+	}
+}
@@ -1,14 +1,21 @@
 package service
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"image"
+	"os"
 
 	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/metadata"
 	"github.com/alejo-lapix/multimedia-go/persistence"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
@@ -20,10 +27,35 @@ type Uploader interface {
 }
 
 type AWSUploader struct {
-	Bucket     *string
-	Region     *string
+	Bucket *string
+	Region *string
+	// URLs resolves the URL stored as the bucket of the items, the AWS S3 URL of Bucket and Region when nil
+	URLs       files.URLResolver
 	Repository persistence.BasicRepository
 	Storage    files.Provider
+	Detector   TypeDetector
+	Extractors map[string]MetadataExtractor
+	// Renditions stores resized copies of the uploaded images, no renditions are generated when nil
+	Renditions *RenditionGenerator
+	// Pages renders the first page of the uploaded PDF documents, the Previews are generated from it
+	// when both are set
+	Pages    PageRenderer
+	Previews *RenditionGenerator
+	// Covers stores resized copies of the album art embedded in the uploaded sounds, no covers are generated
+	// when nil
+	Covers *RenditionGenerator
+	// Visibility is persistence.PUBLIC or persistence.PRIVATE, the provider defaults are used when empty
+	Visibility string
+	// KeepEXIF stores the images with their EXIF, GPS and XMP metadata, it is meant for trusted sources
+	// because the metadata is removed by default for privacy reasons
+	KeepEXIF bool
+	// Deduplication is ReturnDuplicates or ReferenceDuplicates, every upload is stored when empty. The
+	// Repository must implement persistence.HashFindable, and persistence.ReferenceCounter for
+	// ReferenceDuplicates. It must stay enabled while items share files since Delete only looks for the
+	// items that share a file when it is set
+	Deduplication string
+	// locks serializes the uploads and the deletes of the same content
+	locks hashLocks
 }
 
 type InvalidArgumentError struct {
@@ -56,44 +88,389 @@ func NewAWSUploader(tableName, bucket, region *string) (*AWSUploader, error) {
 	return &AWSUploader{
 		Bucket:     bucket,
 		Region:     region,
+		URLs:       files.Endpoint{Bucket: *bucket, Region: *region},
 		Repository: repository,
 		Storage:    storage,
+		Detector:   NewFileTypeDetector(),
 	}, nil
 }
 
-func (uploader *AWSUploader) Upload(filename, destination *string) (*persistence.MultimediaItem, error) {
-	urlRegion := ""
+// NewS3CompatibleUploader returns an uploader that stores the files in the bucket of a S3 compatible
+// endpoint e.g. MinIO, nil credentials use the default AWS credential chain
+func NewS3CompatibleUploader(repository persistence.BasicRepository, endpoint files.Endpoint, creds *credentials.Credentials) (*AWSUploader, error) {
+	if endpoint.Bucket == "" {
+		return nil, InvalidArgumentError{Message: "Bucket can no be empty"}
+	}
 
-	if *uploader.Region != "us-east-1" {
-		urlRegion = fmt.Sprintf("-%v", *uploader.Region)
+	if _, err := endpoint.BucketURL(); err != nil {
+		return nil, InvalidArgumentError{Message: err.Error()}
 	}
 
-	bucket := fmt.Sprintf("https://%v.s3%v.amazonaws.com", *uploader.Bucket, urlRegion)
-	fileType, err := getFileType(filename)
+	storage, err := files.NewS3CompatibleProvider(endpoint, creds)
 
 	if err != nil {
 		return nil, err
 	}
 
+	return &AWSUploader{
+		Bucket:     aws.String(endpoint.Bucket),
+		Region:     aws.String(endpoint.Region),
+		URLs:       endpoint,
+		Repository: repository,
+		Storage:    storage,
+		Detector:   NewFileTypeDetector(),
+	}, nil
+}
+
+// Upload stores the file in the provider and then records its metadata in the repository,
+// the stored file is removed when the metadata can not be recorded. The files with the same content
+// as a stored item are not stored again when Deduplication is enabled
+func (uploader *AWSUploader) Upload(filename, destination *string) (*persistence.MultimediaItem, error) {
+	item, _, err := uploader.UploadHashed(filename, destination, "")
+
+	return item, err
+}
+
+// UploadHashed uploads a file whose SHA-256 was computed while it was received, the file is hashed while its
+// EXIF is removed or read once more when the hash is empty and Deduplication is enabled. It reports if the
+// returned item was stored before with the same content
+func (uploader *AWSUploader) UploadHashed(filename, destination *string, hash string) (*persistence.MultimediaItem, bool, error) {
+	bucket := baseURL(uploader.URLs, uploader.Bucket, uploader.Region)
+	fileType, err := uploader.detector().Detect(filename)
+
+	if err != nil {
+		return nil, false, err
+	}
+
 	item, err := persistence.NewMultimediaItem(&bucket, destination, fileType)
 
 	if err != nil {
+		return nil, false, err
+	}
+
+	strip := *fileType == persistence.IMAGE && !uploader.KeepEXIF
+	digest := sha256.New()
+
+	// the images are hashed before their EXIF is removed, like the keys of ContentHashKeys
+	if strip {
+		if filename, err = stripEXIF(filename, digest); err != nil {
+			return nil, false, err
+		}
+
+		defer os.Remove(*filename)
+	}
+
+	if uploader.Deduplication != "" {
+		switch {
+		case hash == "" && strip:
+			hash = hex.EncodeToString(digest.Sum(nil))
+		case hash == "":
+			if hash, err = fileHash(*filename); err != nil {
+				return nil, false, err
+			}
+		}
+
+		item.Hash = &hash
+		defer uploader.locks.lock(hash)()
+	}
+
+	stored, err := uploader.duplicate(item)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if stored != nil {
+		referenced, duplicate, err := uploader.reference(stored, item)
+
+		// the file of the stored item is removed by a delete, the upload is stored again
+		if err != nil || referenced != nil {
+			return referenced, duplicate, err
+		}
+	}
+
+	if extractor := uploader.extractor(*fileType); extractor != nil {
+		if err = extractor.Extract(filename, item); err != nil {
+			return nil, false, err
+		}
+	}
+
+	existed, err := uploader.exists(destination)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = uploader.store(filename, destination, item)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err = uploader.render(filename, item); err != nil {
+		return nil, false, uploader.rollback(err, item, existed)
+	}
+
+	err = uploader.Repository.Store(item)
+
+	if err != nil {
+		return nil, false, uploader.rollback(err, item, existed)
+	}
+
+	return item, false, nil
+}
+
+// exists reports if an object is stored under a content-derived key, it belongs to the item stored before with
+// the same content so a rollback keeps it. The other keys are unique and they are not checked
+func (uploader *AWSUploader) exists(key *string) (bool, error) {
+	if !contentKey(*key) {
+		return false, nil
+	}
+
+	storage, ok := uploader.Storage.(files.Stater)
+
+	if !ok {
+		return false, InvalidArgumentError{Message: "A files.Stater storage is required to upload with content hash keys"}
+	}
+
+	_, err := storage.Stat(key)
+
+	switch {
+	case err == nil:
+		return true, nil
+	case files.IsNotFound(err):
+		return false, nil
+	case files.IsForbidden(err):
+		return false, fmt.Errorf("The existence of %v can not be checked, the s3:ListBucket permission is required to upload with content hash keys: %v", *key, err)
+	default:
+		return false, err
+	}
+}
+
+// rollback removes the files stored by a failed upload and returns the error of the upload. The files stored
+// under the destination before the upload belong to another item e.g. with ContentHashKeys, they are kept
+func (uploader *AWSUploader) rollback(err error, item *persistence.MultimediaItem, existed bool) error {
+	if existed {
+		return err
+	}
+
+	if removeErr := uploader.removeFiles(item); removeErr != nil {
+		return RollbackError{Err: err, RollbackErr: removeErr}
+	}
+
+	return err
+}
+
+// RegenerateRenditions replaces the renditions of a stored image with the ones of the current specs
+func (uploader *AWSUploader) RegenerateRenditions(ID *string) (*persistence.MultimediaItem, error) {
+	repository, ok := uploader.Repository.(persistence.Updatable)
+
+	if !ok || uploader.Renditions == nil {
+		return nil, InvalidArgumentError{Message: "Renditions and a persistence.Updatable repository are required"}
+	}
+
+	item, err := uploader.Repository.Find(ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if item == nil {
+		return nil, NotFoundError{Message: fmt.Sprintf("The multimedia item %v does not exists", aws.StringValue(ID))}
+	}
+
+	if *item.Type != persistence.IMAGE {
+		return nil, InvalidArgumentError{Message: fmt.Sprintf("The multimedia item %v is not an image", *ID)}
+	}
+
+	if uploader.Deduplication != "" && item.Hash != nil {
+		defer uploader.locks.lock(*item.Hash)()
+	}
+
+	options, err := visibilityOptions(aws.StringValue(item.Visibility))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = uploader.Renditions.Regenerate(item, options); err != nil {
 		return nil, err
 	}
 
-	err = uploader.Storage.Store(filename, destination)
+	shared, err := uploader.sharing(item)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// the items that share the file share its renditions as well
+	for _, other := range append(shared, item) {
+		other.Renditions = item.Renditions
+
+		if err = repository.Update(other); err != nil {
+			return nil, err
+		}
+	}
+
 	return item, nil
 }
 
-func getFileType(filename *string) (*string, error) {
-	image := persistence.IMAGE
+// render stores the renditions of the images, the previews of the PDF documents and the covers of the sounds,
+// the images in unknown formats, with corrupted content or larger than the MaxPixels of the generator are stored
+// without renditions
+func (uploader *AWSUploader) render(filename *string, item *persistence.MultimediaItem) error {
+	var generator *RenditionGenerator
+	var source image.Image
+	var err error
+
+	switch {
+	case *item.Type == persistence.IMAGE && uploader.Renditions != nil:
+		generator = uploader.Renditions
+		source, err = decodeImage(generator, *filename)
+	case *item.Type == persistence.PDF && uploader.Pages != nil && uploader.Previews != nil:
+		generator = uploader.Previews
+		source, err = uploader.Pages.RenderFirstPage(*filename)
+	case *item.Type == persistence.SOUND && uploader.Covers != nil:
+		generator = uploader.Covers
+		source, err = decodeCover(generator, *filename)
+	}
 
-	return &image, nil
+	if err != nil || source == nil {
+		return err
+	}
+
+	options, err := visibilityOptions(uploader.Visibility)
+
+	if err != nil {
+		return err
+	}
+
+	return generator.Generate(source, item, options)
+}
+
+// decodeImage returns nil when the image can not be decoded or it is too large to be decoded
+func decodeImage(generator *RenditionGenerator, filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	source, err := generator.decode(file)
+
+	if err != nil {
+		return nil, nil
+	}
+
+	return source, nil
+}
+
+// decodeCover returns the album art of a sound, nil when there is none or it can not be decoded
+func decodeCover(generator *RenditionGenerator, filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	_, picture, err := metadata.ParseAudio(file)
+
+	if err != nil || picture == nil {
+		return nil, nil
+	}
+
+	source, err := generator.decode(bytes.NewReader(picture.Data))
+
+	if err != nil {
+		return nil, nil
+	}
+
+	return source, nil
+}
+
+// removeFiles removes the renditions and the file of the item
+func (uploader *AWSUploader) removeFiles(item *persistence.MultimediaItem) error {
+	if err := removeRenditions(uploader.Storage, item.Renditions); err != nil {
+		return err
+	}
+
+	return uploader.Storage.Remove(item.Filename)
+}
+
+// baseURL returns the URL stored as the bucket of the items, the AWS S3 URL of the bucket when there is no resolver
+func baseURL(resolver files.URLResolver, bucket, region *string) string {
+	if resolver != nil {
+		return resolver.BaseURL()
+	}
+
+	return files.Endpoint{Bucket: aws.StringValue(bucket), Region: aws.StringValue(region)}.BaseURL()
+}
+
+// visibilityOptions returns the store options of a visibility, nil options use the provider defaults
+func visibilityOptions(visibility string) (*files.StoreOptions, error) {
+	switch visibility {
+	case "":
+		return nil, nil
+	case persistence.PUBLIC:
+		return &files.StoreOptions{ACL: s3.ObjectCannedACLPublicRead}, nil
+	case persistence.PRIVATE:
+		return &files.StoreOptions{ACL: s3.ObjectCannedACLPrivate}, nil
+	}
+
+	return nil, InvalidArgumentError{Message: fmt.Sprintf("Invalid visibility %v", visibility)}
+}
+
+// store streams the file to the provider with the ACL of the uploader visibility
+func (uploader *AWSUploader) store(filename, destination *string, item *persistence.MultimediaItem) error {
+	options, err := visibilityOptions(uploader.Visibility)
+
+	if err != nil {
+		return err
+	}
+
+	if uploader.Visibility != "" {
+		item.Visibility = aws.String(uploader.Visibility)
+	}
+
+	file, err := os.Open(*filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return uploader.Storage.StoreStream(file, destination, options)
+}
+
+func (uploader *AWSUploader) detector() TypeDetector {
+	if uploader.Detector == nil {
+		return NewFileTypeDetector()
+	}
+
+	return uploader.Detector
+}
+
+func (uploader *AWSUploader) extractor(fileType string) MetadataExtractor {
+	if extractor, ok := uploader.Extractors[fileType]; ok {
+		return extractor
+	}
+
+	return defaultExtractors[fileType]
+}
+
+// RollbackError is returned when an operation fails and its compensation fails as well
+type RollbackError struct {
+	Err         error
+	RollbackErr error
+}
+
+func (err RollbackError) Error() string {
+	return fmt.Sprintf("%v (rollback failed: %v)", err.Err, err.RollbackErr)
 }
 
 type NotFoundError struct {
@@ -104,6 +481,39 @@ func (err NotFoundError) Error() string {
 	return err.Message
 }
 
+// Delete removes the stored file of the given item and then its record. The file is kept while other
+// items reference it, only the record is removed then. The references are only looked up when
+// Deduplication is enabled
 func (uploader *AWSUploader) Delete(ID *string) error {
-	return uploader.Storage.Remove(ID)
+	item, err := uploader.Repository.Find(ID)
+
+	if err != nil {
+		return err
+	}
+
+	if item == nil {
+		return NotFoundError{Message: fmt.Sprintf("The multimedia item %v does not exists", aws.StringValue(ID))}
+	}
+
+	if uploader.Deduplication != "" && item.Hash != nil {
+		defer uploader.locks.lock(*item.Hash)()
+	}
+
+	shared, err := uploader.shared(item)
+
+	if err != nil {
+		return err
+	}
+
+	if shared {
+		return uploader.Repository.Remove(ID)
+	}
+
+	err = uploader.removeFiles(item)
+
+	if err != nil {
+		return err
+	}
+
+	return uploader.Repository.Remove(ID)
 }
@@ -1,12 +1,26 @@
 package service
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/alejo-lapix/multimedia-go/files"
+	"github.com/alejo-lapix/multimedia-go/imaging"
+	"github.com/alejo-lapix/multimedia-go/metadata"
 	"github.com/alejo-lapix/multimedia-go/persistence"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func TestAWSUploader_Delete(t *testing.T) {
@@ -56,8 +70,8 @@ func TestAWSUploader_Delete(t *testing.T) {
 			},
 		},
 		{
-			name:    "Should not return error if the repository can remove or not",
-			wantErr: false,
+			name:    "Should return error if the repository can not remove the record",
+			wantErr: true,
 			fields: fields{
 				Bucket:     aws.String("any-bucket"),
 				Region:     aws.String("any-region"),
@@ -81,6 +95,32 @@ func TestAWSUploader_Delete(t *testing.T) {
 	}
 }
 
+func TestAWSUploader_DeleteByID(t *testing.T) {
+	item := &persistence.MultimediaItem{ID: aws.String("item-id"), Filename: aws.String("stored.png")}
+	repository := &RecordingRepository{Items: map[string]*persistence.MultimediaItem{"stored.png": item}}
+	storage := &RecordingProvider{Objects: map[string]bool{"stored.png": true}}
+	uploader := &AWSUploader{Repository: repository, Storage: storage}
+
+	if err := uploader.Delete(aws.String("unknown-id")); err == nil {
+		t.Errorf("Delete() expects an error for unknown IDs")
+	} else if _, ok := err.(NotFoundError); !ok {
+		t.Errorf("Delete() error = %T, want NotFoundError", err)
+	}
+
+	if err := uploader.Delete(aws.String("item-id")); err != nil {
+		t.Errorf("Delete() error = %v", err)
+		return
+	}
+
+	if storage.Objects["stored.png"] {
+		t.Errorf("Delete() did not remove the stored file")
+	}
+
+	if len(repository.Items) != 0 {
+		t.Errorf("Delete() did not remove the record")
+	}
+}
+
 func TestAWSUploader_Upload(t *testing.T) {
 	type fields struct {
 		Bucket     *string
@@ -115,15 +155,30 @@ func TestAWSUploader_Upload(t *testing.T) {
 			},
 		*/
 		{
-			name:    "Should return error if the repository can remove or not",
+			name:    "Should return error if the file can not be stored",
 			wantErr: true,
 			fields: fields{
-				Bucket:  aws.String("any-bucket"),
-				Region:  aws.String("any-region"),
-				Storage: &FailProvider{},
+				Bucket:     aws.String("any-bucket"),
+				Region:     aws.String("any-region"),
+				Repository: &SuccessRepository{},
+				Storage:    &FailProvider{},
 			},
 			args: args{
-				filename:    aws.String("filename"),
+				filename:    aws.String("testdata/image.png"),
+				destination: aws.String("destination"),
+			},
+		},
+		{
+			name:    "Should return error if the item can not be recorded",
+			wantErr: true,
+			fields: fields{
+				Bucket:     aws.String("any-bucket"),
+				Region:     aws.String("any-region"),
+				Repository: &ServerErrorRepository{},
+				Storage:    &SuccessProvider{},
+			},
+			args: args{
+				filename:    aws.String("testdata/image.png"),
 				destination: aws.String("destination"),
 			},
 		},
@@ -131,12 +186,13 @@ func TestAWSUploader_Upload(t *testing.T) {
 			name:    "Should return a MultimediaItem",
 			wantErr: false,
 			fields: fields{
-				Bucket:  aws.String("any-bucket"),
-				Region:  aws.String("any-region"),
-				Storage: &SuccessProvider{},
+				Bucket:     aws.String("any-bucket"),
+				Region:     aws.String("any-region"),
+				Repository: &SuccessRepository{},
+				Storage:    &SuccessProvider{},
 			},
 			args: args{
-				filename:    aws.String("filename"),
+				filename:    aws.String("testdata/image.png"),
 				destination: aws.String("destination"),
 			},
 			want: &persistence.MultimediaItem{},
@@ -162,6 +218,512 @@ func TestAWSUploader_Upload(t *testing.T) {
 	}
 }
 
+func TestAWSUploader_UploadCompensation(t *testing.T) {
+	hashKey := strings.Repeat("ab", sha256.Size) + ".png"
+	type fields struct {
+		Repository *RecordingRepository
+		Storage    *RecordingProvider
+	}
+	tests := []struct {
+		name        string
+		fields      fields
+		destination string
+		wantErr     bool
+		wantStored  bool
+		wantRecords int
+	}{
+		{
+			name: "Should not record the item if the file can not be stored",
+			fields: fields{
+				Repository: &RecordingRepository{},
+				Storage:    &RecordingProvider{StoreErr: InternalServerError{}},
+			},
+			wantErr:     true,
+			wantStored:  false,
+			wantRecords: 0,
+		},
+		{
+			name: "Should remove the stored file if the item can not be recorded",
+			fields: fields{
+				Repository: &RecordingRepository{StoreErr: InternalServerError{}},
+				Storage:    &RecordingProvider{},
+			},
+			wantErr:     true,
+			wantStored:  false,
+			wantRecords: 0,
+		},
+		{
+			name: "Should return a rollback error if the stored file can not be removed",
+			fields: fields{
+				Repository: &RecordingRepository{StoreErr: InternalServerError{}},
+				Storage:    &RecordingProvider{RemoveErr: InternalServerError{}},
+			},
+			wantErr:     true,
+			wantStored:  true,
+			wantRecords: 0,
+		},
+		{
+			name: "Should keep the file stored before the upload with the same content key if the item can not be recorded",
+			fields: fields{
+				Repository: &RecordingRepository{StoreErr: InternalServerError{}},
+				Storage:    &RecordingProvider{Objects: map[string]bool{hashKey: true}},
+			},
+			destination: hashKey,
+			wantErr:     true,
+			wantStored:  true,
+			wantRecords: 0,
+		},
+		{
+			name: "Should remove the file stored with a new content key if the item can not be recorded",
+			fields: fields{
+				Repository: &RecordingRepository{StoreErr: InternalServerError{}},
+				Storage:    &RecordingProvider{},
+			},
+			destination: hashKey,
+			wantErr:     true,
+			wantStored:  false,
+			wantRecords: 0,
+		},
+		{
+			name: "Should not store the file if the existence of the content key is forbidden",
+			fields: fields{
+				Repository: &RecordingRepository{},
+				Storage:    &RecordingProvider{StatErr: &os.PathError{Op: "stat", Path: hashKey, Err: os.ErrPermission}},
+			},
+			destination: hashKey,
+			wantErr:     true,
+			wantStored:  false,
+			wantRecords: 0,
+		},
+		{
+			name: "Should not store the file if the existence of the content key can not be checked",
+			fields: fields{
+				Repository: &RecordingRepository{},
+				Storage:    &RecordingProvider{StatErr: InternalServerError{}},
+			},
+			destination: hashKey,
+			wantErr:     true,
+			wantStored:  false,
+			wantRecords: 0,
+		},
+		{
+			name: "Should store the file and record the item",
+			fields: fields{
+				Repository: &RecordingRepository{},
+				Storage:    &RecordingProvider{},
+			},
+			wantErr:     false,
+			wantStored:  true,
+			wantRecords: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader := &AWSUploader{
+				Bucket:     aws.String("any-bucket"),
+				Region:     aws.String("us-east-1"),
+				Repository: tt.fields.Repository,
+				Storage:    tt.fields.Storage,
+			}
+			destination := tt.destination
+			if destination == "" {
+				destination = "destination.png"
+			}
+			_, err := uploader.Upload(aws.String("testdata/image.png"), aws.String(destination))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, ok := err.(RollbackError); ok != (tt.fields.Storage.RemoveErr != nil) {
+				t.Errorf("Upload() error = %T, rollback error expected %v", err, tt.fields.Storage.RemoveErr != nil)
+			}
+			if stored := tt.fields.Storage.Objects[destination]; stored != tt.wantStored {
+				t.Errorf("Upload() stored = %v, want %v", stored, tt.wantStored)
+			}
+			if records := len(tt.fields.Repository.Items); records != tt.wantRecords {
+				t.Errorf("Upload() records = %v, want %v", records, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestAWSUploader_UploadVideo(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploads")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	clip := filepath.Join(root, "clip.avi")
+	_ = ioutil.WriteFile(clip, []byte("RIFF\x24\x00\x00\x00AVI LIST\x04\x00\x00\x00hdrl"), 0644)
+
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &SuccessRepository{},
+		Storage:    &SuccessProvider{},
+	}
+	tests := []struct {
+		name     string
+		filename string
+		want     *persistence.VideoMetadata
+	}{
+		{name: "Reads the metadata of MP4 videos", filename: "testdata/video.mp4", want: &persistence.VideoMetadata{Duration: 1.5, Width: 320, Height: 240, Codec: "avc1"}},
+		{name: "Stores the videos of other containers without metadata", filename: clip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uploader.Upload(aws.String(tt.filename), aws.String(filepath.Base(tt.filename)))
+
+			if err != nil {
+				t.Errorf("Upload() error = %v", err)
+				return
+			}
+
+			if *got.Type != persistence.VIDEO || !reflect.DeepEqual(got.Video, tt.want) {
+				t.Errorf("Upload() got = %v %+v, want %v %+v", *got.Type, got.Video, persistence.VIDEO, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSUploader_UploadImage(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploads")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	storage := files.NewLocalProvider(root)
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &SuccessRepository{},
+		Storage:    storage,
+		Renditions: newGenerator(t, storage, RenditionSpec{Name: "small", MaxWidth: 100, MaxHeight: 100, Format: imaging.PNG}),
+	}
+	tests := []struct {
+		name     string
+		keepEXIF bool
+		wantEXIF bool
+	}{
+		{name: "Strips the EXIF by default", wantEXIF: false},
+		{name: "Keeps the EXIF of trusted sources", keepEXIF: true, wantEXIF: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploader.KeepEXIF = tt.keepEXIF
+			got, err := uploader.Upload(aws.String("testdata/photo.jpg"), aws.String("photo.jpg"))
+
+			if err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			want := &persistence.ImageMetadata{Width: 8, Height: 6, Orientation: 6, ColorModel: "ycbcr"}
+
+			if !reflect.DeepEqual(got.Image, want) {
+				t.Errorf("Upload() image = %+v, want %+v", got.Image, want)
+			}
+
+			stored, err := storage.Read(aws.String("photo.jpg"))
+
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+
+			if hasEXIF := bytes.Contains(stored, []byte("GPS-SECRET")); hasEXIF != tt.wantEXIF {
+				t.Errorf("Upload() stored the GPS data = %v, want %v", hasEXIF, tt.wantEXIF)
+			}
+
+			// the orientation 6 is rotated 90 degrees so the renditions are displayed upright
+			if len(got.Renditions) != 1 || got.Renditions[0].Width != 6 || got.Renditions[0].Height != 8 {
+				t.Errorf("Upload() renditions = %+v, want an upright 6x8 rendition", got.Renditions)
+			}
+		})
+	}
+}
+
+func TestAWSUploader_UploadUndecodableImage(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploads")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		keepEXIF bool
+		wantErr  bool
+	}{
+		{name: "Stores BMP images without metadata", filename: "logo.bmp", content: "BM\x3A\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00\x28\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00\x00\x01\x00\x18\x00" + strings.Repeat("\x00", 28)},
+		{name: "Error if the EXIF of a TIFF image can not be removed", filename: "photo.tiff", content: "II*\x00\x08\x00\x00\x00 GPS-SECRET", wantErr: true},
+		{name: "Stores TIFF images of trusted sources without metadata", filename: "photo.tiff", content: "II*\x00\x08\x00\x00\x00 GPS-SECRET", keepEXIF: true},
+		{name: "Error if the EXIF of a HEIC image can not be removed", filename: "photo.heic", content: "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00 GPS-SECRET", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(root, tt.filename)
+
+			if err := ioutil.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			storage := &RecordingProvider{}
+			uploader := &AWSUploader{
+				Bucket:     aws.String("any-bucket"),
+				Region:     aws.String("us-east-1"),
+				Repository: &SuccessRepository{},
+				Storage:    storage,
+				Renditions: newGenerator(t, storage),
+				KeepEXIF:   tt.keepEXIF,
+			}
+			got, err := uploader.Upload(aws.String(filename), aws.String(tt.filename))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if _, ok := err.(metadata.UnstrippableFormatError); !ok {
+					t.Errorf("Upload() error = %#v, want a metadata.UnstrippableFormatError", err)
+				}
+
+				if len(storage.Objects) != 0 {
+					t.Errorf("Upload() stored = %v, want no files", storage.Objects)
+				}
+
+				return
+			}
+
+			if *got.Type != persistence.IMAGE || got.Image != nil || len(got.Renditions) != 0 {
+				t.Errorf("Upload() = %+v, want an image without metadata and renditions", got)
+			}
+		})
+	}
+}
+
+type StaticPageRenderer struct {
+	Page image.Image
+	Err  error
+}
+
+func (renderer *StaticPageRenderer) RenderFirstPage(filename string) (image.Image, error) {
+	return renderer.Page, renderer.Err
+}
+
+func TestAWSUploader_UploadDocument(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploads")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	malformed := filepath.Join(root, "malformed.pdf")
+	protected := filepath.Join(root, "protected.pdf")
+	_ = ioutil.WriteFile(malformed, []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n"), 0644)
+	_ = ioutil.WriteFile(protected, []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n2 0 obj\n<< /Filter /Adobe.PubSec >>\nendobj\ntrailer\n<< /Root 1 0 R /Encrypt 2 0 R >>\n%%EOF\n"), 0644)
+
+	storage := &RecordingProvider{}
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &SuccessRepository{},
+		Storage:    storage,
+		Pages:      &StaticPageRenderer{Page: image.NewRGBA(image.Rect(0, 0, 1224, 1584))},
+		Previews:   newGenerator(t, storage, DefaultPreviews...),
+	}
+	got, err := uploader.Upload(aws.String("testdata/document.pdf"), aws.String("contract.pdf"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	want := &persistence.DocumentMetadata{Pages: 1, Title: "Contract", Author: "Jane Doe"}
+
+	if !reflect.DeepEqual(got.Document, want) {
+		t.Errorf("Upload() document = %+v, want %+v", got.Document, want)
+	}
+
+	preview := []persistence.Rendition{{Name: "preview", Key: "contract_preview.jpg", Width: 618, Height: 800, ContentType: "image/jpeg"}}
+
+	if !reflect.DeepEqual(got.Renditions, preview) || !storage.Objects["contract_preview.jpg"] {
+		t.Errorf("Upload() renditions = %+v, want %+v", got.Renditions, preview)
+	}
+
+	tests := []struct {
+		name                  string
+		filename              string
+		wantPasswordProtected bool
+	}{
+		{name: "Rejects malformed documents", filename: malformed},
+		{name: "Rejects password-protected documents", filename: protected, wantPasswordProtected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage.Objects = nil
+			_, err := uploader.Upload(aws.String(tt.filename), aws.String("invalid.pdf"))
+			invalid, ok := err.(InvalidDocumentError)
+
+			if !ok || invalid.PasswordProtected != tt.wantPasswordProtected {
+				t.Errorf("Upload() error = %#v, want InvalidDocumentError with PasswordProtected %v", err, tt.wantPasswordProtected)
+			}
+
+			if len(storage.Objects) > 0 {
+				t.Errorf("Upload() must not store invalid documents, stored %v", storage.Objects)
+			}
+		})
+	}
+}
+
+// newFLACWithCover returns a FLAC file of 2 seconds whose PICTURE block is a PNG front cover
+func newFLACWithCover(t *testing.T, width, height int) []byte {
+	cover := &bytes.Buffer{}
+
+	if err := png.Encode(cover, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+
+	block := func(kind byte, data []byte) []byte {
+		return append([]byte{kind, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+	}
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:], 44100<<44|1<<41|15<<36|88200)
+	// the picture type, the MIME type, an empty description, the dimensions and the data
+	picture := make([]byte, 8, 41+cover.Len())
+	binary.BigEndian.PutUint32(picture, 3)
+	binary.BigEndian.PutUint32(picture[4:], 9)
+	picture = append(append(picture, "image/png"...), make([]byte, 24)...)
+	binary.BigEndian.PutUint32(picture[len(picture)-4:], uint32(cover.Len()))
+	picture = append(picture, cover.Bytes()...)
+
+	return bytes.Join([][]byte{[]byte("fLaC"), block(0, streamInfo), block(0x86, picture), make([]byte, 100)}, nil)
+}
+
+func TestAWSUploader_UploadSound(t *testing.T) {
+	root, err := ioutil.TempDir("", "uploads")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	song := filepath.Join(root, "song.flac")
+	unsupported := filepath.Join(root, "song.aiff")
+	_ = ioutil.WriteFile(song, newFLACWithCover(t, 1000, 1000), 0644)
+	_ = ioutil.WriteFile(unsupported, []byte("FORM\x00\x00\x00\x04AIFF"), 0644)
+
+	storage := &RecordingProvider{}
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &SuccessRepository{},
+		Storage:    storage,
+		Covers:     newGenerator(t, storage, DefaultCovers...),
+	}
+	got, err := uploader.Upload(aws.String(song), aws.String("song.flac"))
+
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	if got.Audio == nil || got.Audio.Duration != 2 || got.Audio.SampleRate != 44100 || got.Audio.Codec != "flac" {
+		t.Errorf("Upload() audio = %+v, want 2 seconds of flac at 44100 Hz", got.Audio)
+	}
+
+	cover := []persistence.Rendition{{Name: "cover", Key: "song_cover.jpg", Width: 500, Height: 500, ContentType: "image/jpeg"}}
+
+	if !reflect.DeepEqual(got.Renditions, cover) || !storage.Objects["song_cover.jpg"] {
+		t.Errorf("Upload() renditions = %+v, want %+v", got.Renditions, cover)
+	}
+
+	got, err = uploader.Upload(aws.String(unsupported), aws.String("song.aiff"))
+
+	if err != nil || got.Audio != nil || len(got.Renditions) > 0 {
+		t.Errorf("Upload() = %+v, %v, want the sound without metadata", got, err)
+	}
+}
+
+func TestAWSUploader_UploadPrivate(t *testing.T) {
+	storage := &RecordingProvider{}
+	uploader := &AWSUploader{
+		Bucket:     aws.String("any-bucket"),
+		Region:     aws.String("us-east-1"),
+		Repository: &RecordingRepository{},
+		Storage:    storage,
+		Visibility: persistence.PRIVATE,
+	}
+	got, err := uploader.Upload(aws.String("testdata/document.pdf"), aws.String("contract.pdf"))
+
+	if err != nil {
+		t.Errorf("Upload() error = %v", err)
+		return
+	}
+
+	if !got.IsPrivate() || storage.Options == nil || storage.Options.ACL != s3.ObjectCannedACLPrivate {
+		t.Errorf("Upload() must store private items with a private ACL, options = %+v", storage.Options)
+	}
+
+	uploader.Visibility = "hidden"
+
+	if _, err = uploader.Upload(aws.String("testdata/document.pdf"), aws.String("contract.pdf")); err == nil {
+		t.Errorf("Upload() expects an error with an invalid visibility")
+	}
+}
+
+func TestAWSUploader_UploadURLs(t *testing.T) {
+	uploader := &AWSUploader{
+		Bucket:     aws.String("media"),
+		Region:     aws.String("us-west-2"),
+		Repository: &SuccessRepository{},
+		Storage:    &SuccessProvider{},
+	}
+	got, err := uploader.Upload(aws.String("testdata/image.png"), aws.String("image.png"))
+
+	if err != nil || *got.Bucket != "https://media.s3-us-west-2.amazonaws.com" {
+		t.Errorf("Upload() bucket = %v, error = %v", got, err)
+		return
+	}
+
+	uploader.URLs = files.Endpoint{Bucket: "media", URL: "http://localhost:9000", PathStyle: true, PublicURL: "https://cdn.example.com"}
+	got, err = uploader.Upload(aws.String("testdata/image.png"), aws.String("image.png"))
+
+	if err != nil || *got.Bucket != "https://cdn.example.com" {
+		t.Errorf("Upload() bucket = %v, error = %v, want the public URL", got, err)
+	}
+}
+
+func TestNewS3CompatibleUploader(t *testing.T) {
+	endpoint := files.Endpoint{Bucket: "media", URL: "http://localhost:9000", PathStyle: true}
+	got, err := NewS3CompatibleUploader(persistence.NewMemoryRepository(), endpoint, nil)
+
+	if err != nil {
+		t.Errorf("NewS3CompatibleUploader() error = %v", err)
+		return
+	}
+
+	if got.URLs.BaseURL() != "http://localhost:9000/media" {
+		t.Errorf("NewS3CompatibleUploader() base URL = %v", got.URLs.BaseURL())
+	}
+
+	if _, err = NewS3CompatibleUploader(persistence.NewMemoryRepository(), files.Endpoint{URL: "http://localhost:9000"}, nil); err == nil {
+		t.Errorf("NewS3CompatibleUploader() expects an error without bucket")
+	}
+}
+
 func TestNewAWSUploader(t *testing.T) {
 	type args struct {
 		tableName *string
@@ -277,9 +839,18 @@ type FailProvider struct{}
 func (provider FailProvider) Store(currentPath *string, newPath *string) error {
 	return InternalServerError{}
 }
+func (provider FailProvider) StoreStream(reader io.Reader, newPath *string, options *files.StoreOptions) error {
+	return InternalServerError{}
+}
 func (provider FailProvider) Read(path *string) ([]byte, error) {
 	return nil, InternalServerError{}
 }
+func (provider FailProvider) ReadStream(path *string) (io.ReadCloser, *files.ObjectInfo, error) {
+	return nil, nil, InternalServerError{}
+}
+func (provider FailProvider) ReadRange(path *string, byteRange string) (io.ReadCloser, *files.ObjectInfo, error) {
+	return nil, nil, InternalServerError{}
+}
 func (provider FailProvider) Remove(filename *string) error {
 	return InternalServerError{}
 }
@@ -289,9 +860,118 @@ type SuccessProvider struct{}
 func (provider SuccessProvider) Store(currentPath *string, newPath *string) error {
 	return nil
 }
+func (provider SuccessProvider) StoreStream(reader io.Reader, newPath *string, options *files.StoreOptions) error {
+	return nil
+}
 func (provider SuccessProvider) Read(path *string) ([]byte, error) {
 	return []byte("Example content"), nil
 }
+func (provider SuccessProvider) ReadStream(path *string) (io.ReadCloser, *files.ObjectInfo, error) {
+	return ioutil.NopCloser(strings.NewReader("Example content")), &files.ObjectInfo{ContentType: "text/plain", ContentLength: 15}, nil
+}
+func (provider SuccessProvider) ReadRange(path *string, byteRange string) (io.ReadCloser, *files.ObjectInfo, error) {
+	return ioutil.NopCloser(strings.NewReader("Example content")), &files.ObjectInfo{ContentType: "text/plain", ContentLength: 15}, nil
+}
 func (provider SuccessProvider) Remove(filename *string) error {
 	return nil
 }
+
+type RecordingRepository struct {
+	StoreErr error
+	Items    map[string]*persistence.MultimediaItem
+}
+
+func (repository *RecordingRepository) Store(item *persistence.MultimediaItem) error {
+	if repository.StoreErr != nil {
+		return repository.StoreErr
+	}
+
+	if repository.Items == nil {
+		repository.Items = make(map[string]*persistence.MultimediaItem)
+	}
+
+	repository.Items[*item.Filename] = item
+
+	return nil
+}
+func (repository *RecordingRepository) Find(ID *string) (*persistence.MultimediaItem, error) {
+	for _, item := range repository.Items {
+		if item.ID != nil && *item.ID == *ID {
+			return item, nil
+		}
+	}
+
+	return nil, nil
+}
+func (repository *RecordingRepository) FindMany(ids []*string) ([]*persistence.MultimediaItem, error) {
+	return make([]*persistence.MultimediaItem, 0), nil
+}
+func (repository *RecordingRepository) Remove(ID *string) error {
+	for key, item := range repository.Items {
+		if item.ID != nil && *item.ID == *ID {
+			delete(repository.Items, key)
+		}
+	}
+
+	return nil
+}
+
+type RecordingProvider struct {
+	StoreErr  error
+	RemoveErr error
+	StatErr   error
+	Objects   map[string]bool
+	Options   *files.StoreOptions
+}
+
+func (provider *RecordingProvider) Store(currentPath *string, newPath *string) error {
+	if provider.StoreErr != nil {
+		return provider.StoreErr
+	}
+
+	if provider.Objects == nil {
+		provider.Objects = make(map[string]bool)
+	}
+
+	provider.Objects[*newPath] = true
+
+	return nil
+}
+func (provider *RecordingProvider) StoreStream(reader io.Reader, newPath *string, options *files.StoreOptions) error {
+	provider.Options = options
+
+	return provider.Store(nil, newPath)
+}
+func (provider *RecordingProvider) Read(path *string) ([]byte, error) {
+	return []byte("Example content"), nil
+}
+func (provider *RecordingProvider) ReadStream(path *string) (io.ReadCloser, *files.ObjectInfo, error) {
+	return ioutil.NopCloser(strings.NewReader("Example content")), &files.ObjectInfo{ContentType: "text/plain", ContentLength: 15}, nil
+}
+func (provider *RecordingProvider) ReadRange(path *string, byteRange string) (io.ReadCloser, *files.ObjectInfo, error) {
+	if !provider.Objects[*path] {
+		return nil, nil, &os.PathError{Op: "open", Path: *path, Err: os.ErrNotExist}
+	}
+
+	return ioutil.NopCloser(strings.NewReader("Example content")), &files.ObjectInfo{ContentType: "text/plain", ContentLength: 15}, nil
+}
+func (provider *RecordingProvider) Stat(path *string) (*files.ObjectInfo, error) {
+	if provider.StatErr != nil {
+		return nil, provider.StatErr
+	}
+
+	if !provider.Objects[*path] {
+		return nil, &os.PathError{Op: "stat", Path: *path, Err: os.ErrNotExist}
+	}
+
+	return &files.ObjectInfo{ContentType: "text/plain", ContentLength: 15}, nil
+}
+func (provider *RecordingProvider) Remove(filename *string) error {
+	if provider.RemoveErr != nil {
+		return provider.RemoveErr
+	}
+
+	delete(provider.Objects, *filename)
+
+	return nil
+}